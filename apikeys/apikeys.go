@@ -0,0 +1,113 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/AllanM007/simpler-test/models"
+	"gorm.io/gorm"
+)
+
+// keyPrefix starts every issued key, so that leaked keys are easy to spot.
+const keyPrefix = "sk_"
+
+// prefixLength is how much of a key is stored in the clear.
+const prefixLength = len(keyPrefix) + 8
+
+var (
+	ErrNotFound      = errors.New("no active api key with this name")
+	ErrDuplicateName = errors.New("an active api key with this name already exists")
+	ErrInvalidName   = errors.New("api key name must not be empty")
+)
+
+// Store issues, revokes and looks up admin API keys. Keys are only known in
+// full when they are created.
+type Store struct {
+	DB *gorm.DB
+}
+
+func NewStore(db *gorm.DB) *Store {
+	return &Store{DB: db}
+}
+
+// Create issues a key named name and returns it with its record. Names are
+// unique among keys that are not revoked.
+func (s *Store) Create(ctx context.Context, name string) (string, models.APIKey, error) {
+	if name == "" {
+		return "", models.APIKey{}, ErrInvalidName
+	}
+	key, err := newKey()
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+
+	record := models.APIKey{Name: name, Hash: hash(key), Prefix: key[:prefixLength]}
+	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.APIKey{}).Where("name = ? AND revoked_at IS NULL", name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDuplicateName
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+	return key, record, nil
+}
+
+// Revoke revokes the active key named name, which stops authenticating
+// straight away.
+func (s *Store) Revoke(ctx context.Context, name string) (models.APIKey, error) {
+	var record models.APIKey
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("name = ? AND revoked_at IS NULL", name).First(&record).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		revokedAt := time.Now()
+		record.RevokedAt = &revokedAt
+		return tx.Model(&record).Update("revoked_at", revokedAt).Error
+	})
+	return record, err
+}
+
+// Lookup returns the active key matching key, or ErrNotFound. Keys that were
+// never issued by the store are rejected without a query.
+func (s *Store) Lookup(ctx context.Context, key string) (models.APIKey, error) {
+	var record models.APIKey
+	if !strings.HasPrefix(key, keyPrefix) {
+		return record, ErrNotFound
+	}
+	err := s.DB.WithContext(ctx).Where("hash = ? AND revoked_at IS NULL", hash(key)).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return record, ErrNotFound
+	}
+	return record, err
+}
+
+func newKey() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return keyPrefix + hex.EncodeToString(secret), nil
+}
+
+// hash returns the stored form of key. Keys are random, so a plain SHA-256
+// needs no salt or stretching.
+func hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"github.com/AllanM007/simpler-test/models"
+	"gorm.io/gorm"
+)
+
+const (
+	ActionCreate     = "create"
+	ActionUpdate     = "update"
+	ActionDelete     = "delete"
+	ActionRestore    = "restore"
+	ActionPurge      = "purge"
+	ActionSale       = "sale"
+	ActionAdjust     = "adjust"
+	ActionActivate   = "activate"
+	ActionDeactivate = "deactivate"
+	ActionApprove    = "approve"
+	ActionReceive    = "receive"
+	ActionRedeliver  = "redeliver"
+)
+
+const (
+	EntityProduct         = "product"
+	EntitySupplier        = "supplier"
+	EntityPurchaseOrder   = "purchase_order"
+	EntityWebhook         = "webhook"
+	EntityWebhookDelivery = "webhook_delivery"
+)
+
+// Entry describes a change to one entity. Before and After are the entity's
+// API representation around the change; Before is nil for creations and
+// After for deletions.
+type Entry struct {
+	Actor      string
+	Action     string
+	EntityType string
+	EntityID   uint
+	Before     interface{}
+	After      interface{}
+	RequestID  string
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx naming the caller whose changes are made
+// with it.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor names the caller ctx makes changes for, or returns an empty string.
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// Record stores the entry using tx, so that it is committed or rolled back
+// together with the change it describes.
+func Record(tx *gorm.DB, entry Entry) error {
+	changes, err := Diff(entry.Before, entry.After)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&models.AuditLog{
+		Actor:      entry.Actor,
+		Action:     entry.Action,
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID,
+		Changes:    changes,
+		RequestID:  entry.RequestID,
+	}).Error
+}
+
+// Diff compares the JSON representations of before and after, either of which
+// may be nil, and returns the top-level fields whose values differ.
+func Diff(before, after interface{}) (map[string]models.FieldChange, error) {
+	beforeFields, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]models.FieldChange{}
+	for name, value := range beforeFields {
+		if afterValue, ok := afterFields[name]; !ok || !reflect.DeepEqual(value, afterValue) {
+			changes[name] = models.FieldChange{Before: value, After: afterValue}
+		}
+	}
+	for name, value := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			changes[name] = models.FieldChange{After: value}
+		}
+	}
+	return changes, nil
+}
+
+func fields(value interface{}) (map[string]interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]interface{}
+	err = json.Unmarshal(encoded, &decoded)
+	return decoded, err
+}
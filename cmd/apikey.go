@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/AllanM007/simpler-test/apikeys"
+)
+
+const apikeyUsage = "apikey create|revoke <name>"
+
+// apikeyCommand issues and revokes admin API keys. A created key is printed
+// once, alone on standard output, and cannot be recovered later.
+func apikeyCommand(flags *flag.FlagSet) runFunc {
+	return func(ctx context.Context, env *env, args []string) error {
+		if len(args) != 2 || (args[0] != "create" && args[0] != "revoke") {
+			return usageError(apikeyUsage)
+		}
+		db, err := env.database(ctx)
+		if err != nil {
+			return err
+		}
+
+		keys := apikeys.NewStore(db)
+		if args[0] == "revoke" {
+			record, err := keys.Revoke(ctx, args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(env.out, "revoked api key %s (%s...)\n", record.Name, record.Prefix)
+			return nil
+		}
+
+		key, _, err := keys.Create(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.out, key)
+		return nil
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/AllanM007/simpler-test/health"
+	"github.com/AllanM007/simpler-test/migrations"
+)
+
+const checkUsage = "check"
+
+// checkCommand reports whether the server could start: the configuration is
+// valid once the command runs, so it only connects to the database, once
+// rather than retrying, and reports its schema version. A schema behind the
+// latest migration is reported but does not fail the check.
+func checkCommand(flags *flag.FlagSet) runFunc {
+	return func(ctx context.Context, env *env, args []string) error {
+		if len(args) > 0 {
+			return usageError(checkUsage)
+		}
+		fmt.Fprintln(env.out, "configuration: ok")
+
+		env.cfg.Database.ConnectAttempts = 1
+		db, err := env.database(ctx)
+		if err != nil {
+			fmt.Fprintln(env.out, "database: unreachable")
+			return err
+		}
+		if err := health.Database(db)(ctx); err != nil {
+			fmt.Fprintln(env.out, "database: unreachable")
+			return &exitError{code: exitUnavailable, err: err}
+		}
+		fmt.Fprintln(env.out, "database: ok")
+
+		migrator, err := migrations.New(db)
+		if err != nil {
+			return err
+		}
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.out, "schema: version %d (latest %d)\n", version, migrator.Latest())
+		return nil
+	}
+}
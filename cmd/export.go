@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/AllanM007/simpler-test/controllers"
+	"gorm.io/gorm"
+)
+
+const exportUsage = "export [-format csv|ndjson|json] [-include-deleted] [-o file]"
+
+// exportCommand writes every product, inactive ones included, like the export
+// endpoint does for admins.
+func exportCommand(flags *flag.FlagSet) runFunc {
+	format := flags.String("format", "csv", "export format: csv, ndjson or json")
+	includeDeleted := flags.Bool("include-deleted", false, "export soft-deleted products too")
+	output := flags.String("o", "", "file to write, standard output when omitted")
+	return func(ctx context.Context, env *env, args []string) error {
+		if len(args) > 0 {
+			return usageError(exportUsage)
+		}
+		if *format != "csv" && *format != "ndjson" && *format != "json" {
+			return &exitError{code: exitUsage, err: fmt.Errorf("invalid format %q, expected csv, ndjson or json", *format)}
+		}
+		db, err := env.database(ctx)
+		if err != nil {
+			return err
+		}
+
+		if *output == "" {
+			return export(ctx, db, env.out, *format, *includeDeleted)
+		}
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := export(ctx, db, file, *format, *includeDeleted); err != nil {
+			return err
+		}
+		return file.Close()
+	}
+}
+
+func export(ctx context.Context, db *gorm.DB, out io.Writer, format string, includeDeleted bool) error {
+	w := bufio.NewWriter(out)
+	filter := controllers.ProductFilter{IncludeInactive: true, IncludeDeleted: includeDeleted}
+	if err := controllers.NewProductService(db, nil).Export(ctx, w, format, filter); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/imports"
+	"github.com/AllanM007/simpler-test/notifications"
+)
+
+const importUsage = "import [-mode insert|upsert] [-dry-run] [-format csv|ndjson] <file|->"
+
+// importCommand imports a file like the import endpoint and prints its report
+// as JSON, sending low stock alerts to the configured sink. It fails when any
+// row failed, after importing the others.
+func importCommand(flags *flag.FlagSet) runFunc {
+	mode := flags.String("mode", controllers.ImportInsert, "insert fails rows naming an existing product, upsert updates it")
+	dryRun := flags.Bool("dry-run", false, "validate and report without writing anything")
+	format := flags.String("format", "", "file format, detected from the file extension when omitted")
+	return func(ctx context.Context, env *env, args []string) error {
+		if len(args) != 1 {
+			return usageError(importUsage)
+		}
+		if *mode != controllers.ImportInsert && *mode != controllers.ImportUpsert {
+			return &exitError{code: exitUsage, err: fmt.Errorf("invalid mode %q, expected insert or upsert", *mode)}
+		}
+		fileFormat := *format
+		if fileFormat == "" {
+			fileFormat = imports.FormatOf(args[0])
+		}
+		if fileFormat != imports.FormatCSV && fileFormat != imports.FormatNDJSON {
+			return &exitError{code: exitUsage, err: fmt.Errorf("unknown format of %s, name it with -format csv or ndjson", args[0])}
+		}
+
+		var file io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			file = f
+		}
+		decoder, err := imports.NewDecoder(fileFormat, file, &controllers.ProductImportRecord{})
+		if err != nil {
+			return err
+		}
+		db, err := env.database(ctx)
+		if err != nil {
+			return err
+		}
+
+		notifier, err := notifications.New(env.cfg.LowStock)
+		if err != nil {
+			return fmt.Errorf("low stock notifier setup: %w", err)
+		}
+
+		report, err := controllers.ImportsRepository(db, notifier, env.cfg.Imports).Import(ctx, decoder, *mode, *dryRun)
+		if report != nil {
+			encoder := json.NewEncoder(env.out)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(report); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if report.Summary.Failed > 0 {
+			return fmt.Errorf("%d of %d rows failed", report.Summary.Failed, report.Summary.Total)
+		}
+		return nil
+	}
+}
@@ -1,12 +1,25 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/config"
 	_ "github.com/AllanM007/simpler-test/docs"
 	"github.com/AllanM007/simpler-test/initializers"
-	"github.com/AllanM007/simpler-test/routes"
+	"github.com/AllanM007/simpler-test/logging"
+	"gorm.io/gorm"
 )
 
 // @title           Simpler Test API
@@ -29,13 +42,179 @@ import (
 // @externalDocs.description  OpenAPI
 // @externalDocs.url          https://swagger.io/resources/open-api/
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// Exit codes, so that scripts can tell why a command failed.
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitUsage       = 2
+	exitConfig      = 3
+	exitUnavailable = 4
+)
+
+// cliActor names the admin commands in audit entries.
+const cliActor = "cli"
+
+// Where commands write and how they connect to the database, replaced in
+// tests.
+var (
+	stdout    io.Writer = os.Stdout
+	stderr    io.Writer = os.Stderr
+	connectDB           = initializers.ConnectDB
+)
+
+// runFunc runs a command with the arguments left after its flags.
+type runFunc func(ctx context.Context, env *env, args []string) error
+
+// command is a subcommand of the binary. setup adds the flags of the command
+// to flags, next to the configuration flags, and returns the function running
+// it.
+type command struct {
+	name    string
+	usage   string
+	summary string
+	setup   func(flags *flag.FlagSet) runFunc
+}
+
+var commands = []command{
+	{"serve", serveUsage, "Serve the REST, gRPC and GraphQL APIs, the default command.", serveCommand},
+	{"migrate", migrateUsage, "Apply, roll back or list the schema migrations.", migrateCommand},
+	{"seed", seedUsage, "Create count fake products, the same ones for the same seed.", seedCommand},
+	{"import", importUsage, "Create or update products from a CSV or NDJSON file, printing the import report.", importCommand},
+	{"export", exportUsage, "Write every product to a file or standard output.", exportCommand},
+	{"apikey", apikeyUsage, "Issue or revoke a named admin API key.", apikeyCommand},
+	{"stock", stockUsage, "Add delta, which may be negative, to the stock of a product.", stockCommand},
+	{"check", checkUsage, "Check the configuration and that the database can be reached.", checkCommand},
+}
+
+// run runs the command named by the first argument, serve when it names none,
+// and returns the exit code.
+func run(args []string) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage(stdout)
+		return exitOK
+	}
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", name)
+		printUsage(stderr)
+		return exitUsage
+	}
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: main %s\n\n%s\n\nflags:\n", cmd.usage, cmd.summary)
+		flags.PrintDefaults()
+	}
+	runCommand := cmd.setup(flags)
+
+	cfg, args, err := config.LoadFlags(flags, args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, config.ErrInvalidFlags):
+		//the flag set has already printed the error and usage
+		return exitUsage
+	case err != nil:
+		slog.Error("failed to load configuration", "error", err)
+		return exitConfig
+	}
+	time.Local = cfg.Location()
+	slog.SetDefault(logging.New(cfg.Log, stderr))
+
+	//stop connecting, migrating or serving on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	env := &env{cfg: cfg, out: stdout}
+	defer env.close()
+	if err := runCommand(audit.WithActor(ctx, cliActor), env, args); err != nil {
+		slog.Error(name+" failed", "error", err)
+		return exitCode(err)
+	}
+	return exitOK
+}
 
-	os.Setenv("TZ", "Africa/Nairobi")
-	initializers.LoadEnvVariables()
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: main [command] [flags] [arguments]")
+	fmt.Fprintln(w, "\ncommands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nEvery command takes the configuration flags, see main <command> -h.")
+}
+
+// env holds what commands share: the configuration, the database once a
+// command connects to it, and where results are written.
+type env struct {
+	cfg *config.Config
+	db  *gorm.DB
+	out io.Writer
+}
 
-	db, err := initializers.ConnectDB()
+// database connects to the database on first use. Failures exit with
+// exitUnavailable.
+func (e *env) database(ctx context.Context) (*gorm.DB, error) {
+	if e.db != nil {
+		return e.db, nil
+	}
+	db, err := connectDB(ctx, e.cfg.Database, e.cfg.TimeZone)
 	if err != nil {
-		log.Fatalf("failed to initialize database: %v", err)
+		return nil, &exitError{code: exitUnavailable, err: err}
+	}
+	e.db = db
+	return db, nil
+}
+
+func (e *env) close() {
+	if e.db == nil {
+		return
+	}
+	if sqlDB, err := e.db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// exitError is an error exiting with code rather than exitFailure.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func usageError(usage string) error {
+	return &exitError{code: exitUsage, err: errors.New("usage: main " + usage)}
+}
+
+func exitCode(err error) int {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
 	}
-	routes.Router(db).Run(":8080")
+	return exitFailure
 }
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/migrations"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/testharness"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// runCommand runs the binary with args, configured with a database that
+// cannot be reached unless the test connects commands to SQLite, and returns
+// its exit code and what it wrote to standard output.
+func runCommand(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	t.Setenv("DB_HOST", "127.0.0.1")
+	t.Setenv("DB_PORT", "1")
+	t.Setenv("DB_USER", "test")
+	t.Setenv("DB_NAME", "test")
+	t.Setenv("DB_CONNECT_ATTEMPTS", "1")
+
+	var out, errOut bytes.Buffer
+	stdout, stderr = &out, &errOut
+	t.Cleanup(func() {
+		stdout, stderr = os.Stdout, os.Stderr
+	})
+
+	code := run(args)
+	if t.Failed() || code != exitOK {
+		t.Logf("main %s: exit %d\n%s", strings.Join(args, " "), code, errOut.String())
+	}
+	return code, out.String()
+}
+
+// useSQLite connects commands to the in-memory SQLite database called name
+// and returns it. The database lives until the test ends, across commands.
+func useSQLite(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+	db, err := testharness.OpenSQLite(name)
+	if err != nil {
+		t.Fatalf("error opening database: %v", err)
+	}
+	connect := connectDB
+	connectDB = func(ctx context.Context, cfg config.Database, timeZone string) (*gorm.DB, error) {
+		return testharness.OpenSQLite(name)
+	}
+	t.Cleanup(func() {
+		connectDB = connect
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestRunExitCodes(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"help", []string{"help"}, exitOK},
+		{"flag help", []string{"check", "-h"}, exitOK},
+		{"unknown command", []string{"frobnicate"}, exitUsage},
+		{"unknown flag", []string{"check", "-no-such-flag"}, exitUsage},
+		{"malformed flag", []string{"seed", "-seed", "many", "3"}, exitUsage},
+		{"missing argument", []string{"seed"}, exitUsage},
+		{"invalid count", []string{"seed", "none"}, exitUsage},
+		{"invalid delta", []string{"stock", "adjust", "1", "lots"}, exitUsage},
+		{"unknown subcommand", []string{"stock", "set", "1", "2"}, exitUsage},
+		{"invalid export format", []string{"export", "-format", "xml"}, exitUsage},
+		{"invalid import mode", []string{"import", "-mode", "merge", "products.csv"}, exitUsage},
+		{"invalid configuration", []string{"check", "-log-level", "loud"}, exitConfig},
+		{"missing configuration file", []string{"check", "-config", "missing.yaml"}, exitConfig},
+		{"unreachable database", []string{"check"}, exitUnavailable},
+		{"unreachable database for a write", []string{"seed", "3"}, exitUnavailable},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _ := runCommand(t, tc.args...)
+			assert.Equal(t, tc.code, code)
+		})
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	db := useSQLite(t, "cmd_check")
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("error loading migrations: %v", err)
+	}
+	latest := migrator.Latest()
+
+	//test databases are migrated when opened
+	code, out := runCommand(t, "check")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "configuration: ok\n")
+	assert.Contains(t, out, "database: ok\n")
+	assert.Contains(t, out, fmt.Sprintf("schema: version %d (latest %d)\n", latest, latest))
+}
+
+func TestSeedCommand(t *testing.T) {
+	seeded := func(db *gorm.DB) []models.Product {
+		var products []models.Product
+		if err := db.Order("name").Find(&products).Error; err != nil {
+			t.Fatalf("error listing products: %v", err)
+		}
+		for i := range products {
+			products[i].Model = gorm.Model{}
+		}
+		return products
+	}
+
+	//the same seed creates the same products
+	first := useSQLite(t, "cmd_seed_first")
+	code, out := runCommand(t, "seed", "-seed", "7", "5")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "created 5 products, 0 already existed\n", out)
+
+	second := useSQLite(t, "cmd_seed_second")
+	code, _ = runCommand(t, "seed", "-seed", "7", "5")
+	assert.Equal(t, exitOK, code)
+	assert.Len(t, seeded(first), 5)
+	assert.Equal(t, seeded(first), seeded(second))
+
+	//seeding again only creates the missing products
+	code, out = runCommand(t, "seed", "-seed", "7", "8")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "created 3 products, 5 already existed\n", out)
+
+	other := useSQLite(t, "cmd_seed_other")
+	code, _ = runCommand(t, "seed", "-seed", "8", "5")
+	assert.Equal(t, exitOK, code)
+	assert.NotEqual(t, seeded(first), seeded(other))
+}
+
+func TestImportExportCommands(t *testing.T) {
+	db := useSQLite(t, "cmd_import_export")
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "products.csv")
+	csv := "name,description,price,stock,reorder_point\n" +
+		"CLI Kettle,Imported from the command line,19.5,12,3\n" +
+		"CLI Toaster,Imported from the command line,24,7,0\n" +
+		"CLI Broken,No price,,3,0\n"
+	if err := os.WriteFile(file, []byte(csv), 0o644); err != nil {
+		t.Fatalf("error writing import file: %v", err)
+	}
+
+	//failed rows fail the command after the others are imported
+	code, out := runCommand(t, "import", file)
+	assert.Equal(t, exitFailure, code)
+	var report controllers.ImportReport
+	if assert.NoError(t, json.Unmarshal([]byte(out), &report)) {
+		assert.Equal(t, 2, report.Summary.Created)
+		assert.Equal(t, 1, report.Summary.Failed)
+	}
+
+	//dry runs report without writing
+	if err := os.WriteFile(file, []byte("name,description,price,stock,reorder_point\nCLI Kettle,Repriced,21,12,3\n"), 0o644); err != nil {
+		t.Fatalf("error writing import file: %v", err)
+	}
+	code, _ = runCommand(t, "import", "-mode", "upsert", "-dry-run", file)
+	assert.Equal(t, exitOK, code)
+	var kettle models.Product
+	if assert.NoError(t, db.Where("name = ?", "CLI Kettle").First(&kettle).Error) {
+		assert.Equal(t, 19.5, kettle.Price)
+	}
+	code, _ = runCommand(t, "import", "-mode", "upsert", file)
+	assert.Equal(t, exitOK, code)
+
+	exported := filepath.Join(dir, "products.ndjson")
+	code, _ = runCommand(t, "export", "-format", "ndjson", "-o", exported)
+	assert.Equal(t, exitOK, code)
+	data, err := os.ReadFile(exported)
+	if err != nil {
+		t.Fatalf("error reading export: %v", err)
+	}
+	products := map[string]controllers.ProductData{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var product controllers.ProductData
+		if assert.NoError(t, json.Unmarshal([]byte(line), &product)) {
+			products[product.Name] = product
+		}
+	}
+	if assert.Len(t, products, 2) {
+		assert.Equal(t, 21.0, products["CLI Kettle"].Price)
+		assert.Equal(t, "Repriced", products["CLI Kettle"].Description)
+		assert.Equal(t, 3, products["CLI Kettle"].ReorderPoint)
+		assert.Equal(t, 7, products["CLI Toaster"].Stock)
+	}
+
+	//deleted products are only exported when asked for
+	assert.NoError(t, db.Where("name = ?", "CLI Toaster").Delete(&models.Product{}).Error)
+	code, out = runCommand(t, "export", "-format", "csv")
+	assert.Equal(t, exitOK, code)
+	assert.NotContains(t, out, "CLI Toaster")
+	code, out = runCommand(t, "export", "-format", "csv", "-include-deleted")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "CLI Toaster")
+}
+
+func TestExportReimportCommands(t *testing.T) {
+	for _, format := range []string{"csv", "ndjson"} {
+		t.Run(format, func(t *testing.T) {
+			db := useSQLite(t, "cmd_reimport_"+format)
+			products := []models.Product{
+				{Name: "-20% Sale", Description: "=Discounted", Price: 8, StockLevel: 4, ReorderPoint: 1},
+				{Name: "'Quoted' Kettle", Description: "@Home", Price: 19.5, StockLevel: 12, ReorderPoint: 3, ReorderQuantity: 10},
+				{Name: "Plain Toaster", Description: "Two slices", Price: 24, StockLevel: 7},
+			}
+			if err := db.Create(&products).Error; err != nil {
+				t.Fatalf("error creating products: %v", err)
+			}
+
+			file := filepath.Join(t.TempDir(), "products."+format)
+			code, _ := runCommand(t, "export", "-format", format, "-o", file)
+			assert.Equal(t, exitOK, code)
+
+			//upserting the export finds every product unchanged
+			code, out := runCommand(t, "import", "-mode", "upsert", file)
+			assert.Equal(t, exitOK, code)
+			var report controllers.ImportReport
+			if assert.NoError(t, json.Unmarshal([]byte(out), &report)) {
+				assert.Equal(t, controllers.ImportSummary{Total: 3, Unchanged: 3}, report.Summary)
+			}
+
+			//inserting it into an empty catalogue recreates the products
+			assert.NoError(t, db.Unscoped().Where("1 = 1").Delete(&models.Product{}).Error)
+			code, _ = runCommand(t, "import", file)
+			assert.Equal(t, exitOK, code)
+			for _, product := range products {
+				var imported models.Product
+				if assert.NoError(t, db.Where("name = ?", product.Name).First(&imported).Error, product.Name) {
+					assert.Equal(t, product.Description, imported.Description)
+					assert.Equal(t, product.Price, imported.Price)
+					assert.Equal(t, product.StockLevel, imported.StockLevel)
+					assert.Equal(t, product.ReorderPoint, imported.ReorderPoint)
+					assert.Equal(t, product.ReorderQuantity, imported.ReorderQuantity)
+				}
+			}
+		})
+	}
+}
+
+func TestStockCommand(t *testing.T) {
+	db := useSQLite(t, "cmd_stock")
+	product := testharness.CreateProduct(t, db, "CLI Stocked Widget", testharness.WithStock(10))
+	id := strconv.FormatUint(uint64(product.ID), 10)
+
+	code, out := runCommand(t, "stock", "adjust", id, "-3")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, `product `+id+` "CLI Stocked Widget" stock is now 7`+"\n", out)
+
+	code, _ = runCommand(t, "stock", "adjust", id, "-8")
+	assert.Equal(t, exitFailure, code)
+	code, _ = runCommand(t, "stock", "adjust", "999999", "1")
+	assert.Equal(t, exitFailure, code)
+
+	var stocked models.Product
+	if assert.NoError(t, db.First(&stocked, product.ID).Error) {
+		assert.Equal(t, 7, stocked.StockLevel)
+	}
+
+	//changes are audited as made by the command line
+	var entry models.AuditLog
+	if assert.NoError(t, db.Where("entity_id = ? AND action = ?", product.ID, audit.ActionAdjust).First(&entry).Error) {
+		assert.Equal(t, cliActor, entry.Actor)
+	}
+}
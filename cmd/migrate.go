@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/AllanM007/simpler-test/migrations"
+	"gorm.io/gorm"
+)
+
+const migrateUsage = "migrate up|down [steps]|status|to <version>"
+
+func migrateCommand(flags *flag.FlagSet) runFunc {
+	return func(ctx context.Context, env *env, args []string) error {
+		if len(args) == 0 {
+			return usageError(migrateUsage)
+		}
+		db, err := env.database(ctx)
+		if err != nil {
+			return err
+		}
+		return runMigrate(ctx, db, args, env.out)
+	}
+}
+
+// runMigrate applies, rolls back or reports on the embedded schema migrations.
+func runMigrate(ctx context.Context, db *gorm.DB, args []string, out io.Writer) error {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return usageError(migrateUsage)
+	}
+
+	var changed []int
+	switch args[0] {
+	case "up":
+		changed, err = migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil {
+				return &exitError{code: exitUsage, err: fmt.Errorf("invalid steps %q: %w", args[1], err)}
+			}
+		}
+		changed, err = migrator.Down(ctx, steps)
+	case "to":
+		if len(args) < 2 {
+			return usageError(migrateUsage)
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return &exitError{code: exitUsage, err: fmt.Errorf("invalid version %q: %w", args[1], convErr)}
+		}
+		changed, err = migrator.To(ctx, version)
+	case "status":
+		return printMigrationStatus(ctx, migrator, out)
+	default:
+		return usageError(migrateUsage)
+	}
+
+	for _, version := range changed {
+		fmt.Fprintf(out, "migrated %d\n", version)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "schema at version %d (latest %d)\n", version, migrator.Latest())
+	return nil
+}
+
+func printMigrationStatus(ctx context.Context, migrator *migrations.Migrator, out io.Writer) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.Applied {
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+	return w.Flush()
+}
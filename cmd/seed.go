@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+
+	"github.com/AllanM007/simpler-test/controllers"
+)
+
+const seedUsage = "seed [-seed n] <count>"
+
+var (
+	seedAdjectives = []string{"Compact", "Deluxe", "Ergonomic", "Heavy Duty", "Portable", "Rugged", "Sleek", "Smart", "Vintage", "Wireless"}
+	seedNouns      = []string{"Backpack", "Blender", "Desk Lamp", "Headphones", "Kettle", "Keyboard", "Monitor", "Speaker", "Toolbox", "Water Bottle"}
+)
+
+// seedCommand creates fake products for development and load tests. The same
+// seed always creates the same products, so seeding again only creates the
+// products that are missing.
+func seedCommand(flags *flag.FlagSet) runFunc {
+	seed := flags.Uint64("seed", 1, "seed of the generated products")
+	return func(ctx context.Context, env *env, args []string) error {
+		if len(args) != 1 {
+			return usageError(seedUsage)
+		}
+		count, err := strconv.Atoi(args[0])
+		if err != nil || count < 1 {
+			return &exitError{code: exitUsage, err: fmt.Errorf("invalid count %q, expected a positive number", args[0])}
+		}
+		db, err := env.database(ctx)
+		if err != nil {
+			return err
+		}
+
+		products := controllers.NewProductService(db, nil)
+		random := rand.New(rand.NewPCG(*seed, *seed))
+		created, existing := 0, 0
+		for n := 1; n <= count; n++ {
+			_, err := products.Create(ctx, seedProduct(random, n))
+			if errors.Is(err, controllers.ErrDuplicateProduct) {
+				existing++
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("creating product %d: %w", n, err)
+			}
+			created++
+		}
+
+		fmt.Fprintf(env.out, "created %d products, %d already existed\n", created, existing)
+		return nil
+	}
+}
+
+// seedProduct returns the nth product of the sequence drawn from random. Its
+// number keeps its name unique.
+func seedProduct(random *rand.Rand, n int) controllers.ProductCreateReq {
+	adjective := seedAdjectives[random.IntN(len(seedAdjectives))]
+	noun := seedNouns[random.IntN(len(seedNouns))]
+	reorderPoint := random.IntN(20)
+	return controllers.ProductCreateReq{
+		Name:            fmt.Sprintf("%s %s %04d", adjective, noun, n),
+		Description:     fmt.Sprintf("A %s %s for testing.", adjective, noun),
+		Price:           math.Round((1+random.Float64()*499)*100) / 100,
+		StockLevel:      1 + random.IntN(200),
+		ReorderPoint:    reorderPoint,
+		ReorderQuantity: reorderPoint * 2,
+	}
+}
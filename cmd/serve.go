@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/AllanM007/simpler-test/apikeys"
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/events"
+	"github.com/AllanM007/simpler-test/grpcapi"
+	"github.com/AllanM007/simpler-test/health"
+	"github.com/AllanM007/simpler-test/metrics"
+	"github.com/AllanM007/simpler-test/migrations"
+	"github.com/AllanM007/simpler-test/notifications"
+	"github.com/AllanM007/simpler-test/routes"
+	"github.com/AllanM007/simpler-test/server"
+	"github.com/AllanM007/simpler-test/stream"
+	"github.com/AllanM007/simpler-test/tracing"
+	"github.com/AllanM007/simpler-test/webhooks"
+	"gorm.io/gorm"
+)
+
+const serveUsage = "serve"
+
+// serveCommand runs the REST and gRPC servers until ctx is done.
+func serveCommand(flags *flag.FlagSet) runFunc {
+	return func(ctx context.Context, env *env, args []string) error {
+		if len(args) > 0 {
+			return usageError(serveUsage)
+		}
+		db, err := env.database(ctx)
+		if err != nil {
+			return err
+		}
+		cfg := env.cfg
+
+		//trace requests and the queries they run
+		shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+		if err != nil {
+			return fmt.Errorf("tracing setup: %w", err)
+		}
+		if err := db.Use(tracing.GormPlugin{}); err != nil {
+			return fmt.Errorf("tracing database queries: %w", err)
+		}
+
+		//export connection pool statistics alongside the request metrics
+		if err := metrics.RegisterDB(db, cfg.Database.Name); err != nil {
+			return fmt.Errorf("registering database metrics: %w", err)
+		}
+
+		//check the sinks and migrations before starting anything that must be stopped again
+		sink, err := notifications.New(cfg.LowStock)
+		if err != nil {
+			return fmt.Errorf("low stock notifier setup: %w", err)
+		}
+		publisher, err := events.New(cfg.Events)
+		if err != nil {
+			return fmt.Errorf("event publisher setup: %w", err)
+		}
+		migrator, err := migrations.New(db)
+		if err != nil {
+			return fmt.Errorf("loading migrations: %w", err)
+		}
+
+		//readiness needs a reachable database on the latest schema and no shutdown in progress
+		checks := health.NewRegistry(cfg.Health.CheckTimeout)
+		checks.AddReadinessCheck("database", health.Database(db))
+		checks.AddReadinessCheck("migrations", health.Migrations(migrator))
+		checks.AddReadinessCheck("shutdown", health.Running(ctx))
+
+		slog.Info("starting server", "config", cfg.String())
+
+		//deliver low stock alerts in the background so slow sinks never block sales
+		notifier := notifications.NewAsyncNotifier(sink, cfg.LowStock.QueueSize)
+		stockStream := stream.NewBroker(cfg.Stream)
+
+		//serve the gRPC API on its own port with the same product logic as the REST API,
+		//before the workers start so that a taken port leaves only the notifier and tracing to stop
+		grpcServer := grpcapi.NewServer(cfg.GRPC, controllers.NewProductService(db, notifier), stockStream, cfg.Auth.AdminAPIKey, apikeys.NewStore(db))
+		if err := grpcServer.Start(); err != nil {
+			stopCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+			defer cancel()
+			return errors.Join(fmt.Errorf("starting grpc server: %w", err), notifier.Close(stopCtx), shutdownTracing(stopCtx))
+		}
+
+		//publish domain events recorded in the outbox, queueing webhook deliveries for subscribers
+		relay := events.NewRelay(db, publisher, cfg.Events, webhooks.Queue{})
+		relay.Start()
+
+		//push committed stock changes to connected stream clients, whether or not they are published yet
+		follower := events.NewFollower(db, cfg.Events, stockStream)
+		follower.Start()
+
+		//send webhook deliveries as they fall due
+		dispatcher := webhooks.NewDispatcher(db, cfg.Webhooks)
+		dispatcher.Start()
+
+		srv := server.New(cfg.Server, routes.Router(db, cfg, notifier, stockStream, checks))
+		//end open streams as soon as shutdown starts so they don't hold it up
+		srv.RegisterOnShutdown(stockStream.Close)
+		if err := server.Run(ctx, srv, cfg.Server.ShutdownTimeout, grpcServer.Close, notifier.Close, relay.Close, follower.Close, dispatcher.Close, closeDB(db), shutdownTracing); err != nil {
+			return fmt.Errorf("server stopped: %w", err)
+		}
+		slog.Info("server stopped")
+		return nil
+	}
+}
+
+func closeDB(db *gorm.DB) server.Hook {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.Close()
+	}
+}
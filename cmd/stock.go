@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/notifications"
+	"gorm.io/gorm"
+)
+
+const stockUsage = "stock adjust <product id> <delta>"
+
+// stockCommand adjusts stock like an adjust_stock batch operation, sending
+// low stock alerts to the configured sink.
+func stockCommand(flags *flag.FlagSet) runFunc {
+	return func(ctx context.Context, env *env, args []string) error {
+		if len(args) != 3 || args[0] != "adjust" {
+			return usageError(stockUsage)
+		}
+		if _, err := strconv.ParseUint(args[1], 10, 64); err != nil {
+			return &exitError{code: exitUsage, err: fmt.Errorf("invalid product id %q", args[1])}
+		}
+		delta, err := strconv.Atoi(args[2])
+		if err != nil {
+			return &exitError{code: exitUsage, err: fmt.Errorf("invalid delta %q", args[2])}
+		}
+		db, err := env.database(ctx)
+		if err != nil {
+			return err
+		}
+
+		notifier, err := notifications.New(env.cfg.LowStock)
+		if err != nil {
+			return fmt.Errorf("low stock notifier setup: %w", err)
+		}
+		product, err := controllers.NewProductService(db, notifier).AdjustStock(ctx, args[1], delta)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("product %s not found", args[1])
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.out, "product %d %q stock is now %d\n", product.ID, product.Name, product.StockLevel)
+		return nil
+	}
+}
@@ -0,0 +1,426 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config is the complete service configuration. Every field is tagged with
+// the environment variable that sets it; the same name, lower-cased with
+// dashes, is accepted as a command line flag (DB_HOST becomes -db-host).
+// Fields tagged secret are redacted when the configuration is printed.
+type Config struct {
+	TimeZone string   `yaml:"timezone" env:"APP_TIMEZONE" desc:"IANA time zone used by the service and database session"`
+	Log      Log      `yaml:"log"`
+	Server   Server   `yaml:"server"`
+	GRPC     GRPC     `yaml:"grpc"`
+	Database Database `yaml:"database"`
+	Auth     Auth     `yaml:"auth"`
+	CORS     CORS     `yaml:"cors"`
+	Health   Health   `yaml:"health"`
+	Tracing  Tracing  `yaml:"tracing"`
+	LowStock LowStock `yaml:"low_stock"`
+	Events   Events   `yaml:"events"`
+	Webhooks Webhooks `yaml:"webhooks"`
+	Stream   Stream   `yaml:"stream"`
+	Imports  Imports  `yaml:"imports"`
+	Products Products `yaml:"products"`
+	GraphQL  GraphQL  `yaml:"graphql"`
+}
+
+type Log struct {
+	Level  string `yaml:"level"  env:"LOG_LEVEL"  desc:"minimum log level: debug, info, warn or error"`
+	Format string `yaml:"format" env:"LOG_FORMAT" desc:"log output format: json or text"`
+}
+
+type Server struct {
+	Port              int           `yaml:"port"                env:"SERVER_PORT"                desc:"port the HTTP server listens on"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"        env:"SERVER_READ_TIMEOUT"        desc:"maximum duration for reading a whole request"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT" desc:"maximum duration for reading request headers"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"       env:"SERVER_WRITE_TIMEOUT"       desc:"maximum duration before timing out writes of a response"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"        env:"SERVER_IDLE_TIMEOUT"        desc:"maximum time to wait for the next request on a keep-alive connection"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"    env:"SERVER_MAX_HEADER_BYTES"    desc:"maximum size of request headers in bytes"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"    env:"SERVER_SHUTDOWN_TIMEOUT"    desc:"time allowed for in-flight requests to finish on shutdown"`
+}
+
+type GRPC struct {
+	Port int `yaml:"port" env:"GRPC_PORT" desc:"port the gRPC server listens on"`
+}
+
+type Database struct {
+	Host             string        `yaml:"host"              env:"DB_HOST"              desc:"database host"`
+	Port             int           `yaml:"port"              env:"DB_PORT"              desc:"database port"`
+	User             string        `yaml:"user"              env:"DB_USER"              desc:"database user"`
+	Password         string        `yaml:"password"          env:"DB_PASSWORD"          desc:"database password" secret:"true"`
+	Name             string        `yaml:"name"              env:"DB_NAME"              desc:"database name"`
+	SSLMode          string        `yaml:"sslmode"           env:"DB_SSLMODE"           desc:"postgres sslmode: disable, allow, prefer, require, verify-ca or verify-full"`
+	StatementTimeout time.Duration `yaml:"statement_timeout" env:"DB_STATEMENT_TIMEOUT" desc:"maximum duration of a single statement, 0 for no limit"`
+	MaxOpenConns     int           `yaml:"max_open_conns"    env:"DB_MAX_OPEN_CONNS"    desc:"maximum number of open connections, 0 for no limit"`
+	MaxIdleConns     int           `yaml:"max_idle_conns"    env:"DB_MAX_IDLE_CONNS"    desc:"maximum number of idle connections kept in the pool"`
+	ConnMaxLifetime  time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" desc:"maximum time a connection is reused, 0 for no limit"`
+	ConnMaxIdleTime  time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" desc:"maximum time a connection stays idle, 0 for no limit"`
+	ConnectAttempts  int           `yaml:"connect_attempts"  env:"DB_CONNECT_ATTEMPTS"  desc:"number of attempts to connect at startup"`
+	ConnectBackoff   time.Duration `yaml:"connect_backoff"   env:"DB_CONNECT_BACKOFF"   desc:"wait before the first connection retry, doubled after every failed attempt"`
+	SlowQuery        time.Duration `yaml:"slow_query"        env:"DB_SLOW_QUERY"        desc:"queries taking longer are logged as warnings, 0 to disable"`
+}
+
+type Auth struct {
+	AdminAPIKey string `yaml:"admin_api_key" env:"ADMIN_API_KEY" desc:"API key granting access to admin endpoints" secret:"true"`
+}
+
+type CORS struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins"   env:"CORS_ALLOWED_ORIGINS"   desc:"origins allowed to call the API, * for any or https://*.example.com for subdomains"`
+	AllowedMethods   []string      `yaml:"allowed_methods"   env:"CORS_ALLOWED_METHODS"   desc:"methods allowed in cross-origin requests"`
+	AllowedHeaders   []string      `yaml:"allowed_headers"   env:"CORS_ALLOWED_HEADERS"   desc:"request headers allowed in cross-origin requests"`
+	ExposedHeaders   []string      `yaml:"exposed_headers"   env:"CORS_EXPOSED_HEADERS"   desc:"response headers readable by cross-origin callers"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS" desc:"allow cross-origin requests with cookies or credentials"`
+	MaxAge           time.Duration `yaml:"max_age"           env:"CORS_MAX_AGE"           desc:"how long browsers may cache a preflight response"`
+}
+
+type Health struct {
+	CheckTimeout time.Duration `yaml:"check_timeout" env:"HEALTH_CHECK_TIMEOUT" desc:"time each health check is given before it is reported down"`
+}
+
+type Tracing struct {
+	Exporter     string  `yaml:"exporter"      env:"TRACING_EXPORTER"      desc:"trace exporter: none, stdout or otlp"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT" desc:"host:port of the OTLP/HTTP trace collector"`
+	OTLPInsecure bool    `yaml:"otlp_insecure" env:"TRACING_OTLP_INSECURE" desc:"send traces to the collector over plain HTTP"`
+	ServiceName  string  `yaml:"service_name"  env:"TRACING_SERVICE_NAME"  desc:"service name reported on every span"`
+	SampleRatio  float64 `yaml:"sample_ratio"  env:"TRACING_SAMPLE_RATIO"  desc:"fraction of new traces sampled, between 0 and 1"`
+}
+
+type LowStock struct {
+	Notifier   string `yaml:"notifier"    env:"LOW_STOCK_NOTIFIER"    desc:"low stock alert sink: log, webhook or file"`
+	WebhookURL string `yaml:"webhook_url" env:"LOW_STOCK_WEBHOOK_URL" desc:"URL low stock alerts are posted to by the webhook notifier"`
+	FilePath   string `yaml:"file_path"   env:"LOW_STOCK_FILE_PATH"   desc:"file low stock alerts are appended to by the file notifier"`
+	QueueSize  int    `yaml:"queue_size"  env:"LOW_STOCK_QUEUE_SIZE"  desc:"number of alerts buffered for background delivery"`
+}
+
+type Events struct {
+	Publisher     string        `yaml:"publisher"     env:"EVENTS_PUBLISHER"     desc:"domain event sink: log, file or http"`
+	URL           string        `yaml:"url"           env:"EVENTS_URL"           desc:"URL domain events are posted to by the http publisher"`
+	FilePath      string        `yaml:"file_path"     env:"EVENTS_FILE_PATH"     desc:"file domain events are appended to by the file publisher"`
+	PollInterval  time.Duration `yaml:"poll_interval"  env:"EVENTS_POLL_INTERVAL"  desc:"how often the outbox is checked for unpublished events"`
+	BatchSize     int           `yaml:"batch_size"     env:"EVENTS_BATCH_SIZE"     desc:"maximum number of events published per outbox check"`
+	RetryBackoff  time.Duration `yaml:"retry_backoff"  env:"EVENTS_RETRY_BACKOFF"  desc:"wait before the first retry of an event that failed to publish, doubled after every failure"`
+	MaxBackoff    time.Duration `yaml:"max_backoff"    env:"EVENTS_MAX_BACKOFF"    desc:"longest wait between publish retries"`
+	AlertAttempts int           `yaml:"alert_attempts" env:"EVENTS_ALERT_ATTEMPTS" desc:"failed publish attempts after which each further failure of an event is logged as an error"`
+}
+
+type Webhooks struct {
+	Timeout      time.Duration `yaml:"timeout"       env:"WEBHOOK_TIMEOUT"       desc:"time a webhook receiver is given to respond"`
+	MaxAttempts  int           `yaml:"max_attempts"  env:"WEBHOOK_MAX_ATTEMPTS"  desc:"delivery attempts before a webhook delivery is dead-lettered"`
+	RetryBackoff time.Duration `yaml:"retry_backoff" env:"WEBHOOK_RETRY_BACKOFF" desc:"wait before the first retry of a failed delivery, doubled after every failure"`
+	MaxBackoff   time.Duration `yaml:"max_backoff"   env:"WEBHOOK_MAX_BACKOFF"   desc:"longest wait between delivery retries"`
+	PollInterval time.Duration `yaml:"poll_interval" env:"WEBHOOK_POLL_INTERVAL" desc:"how often deliveries that are due are sent"`
+	BatchSize    int           `yaml:"batch_size"    env:"WEBHOOK_BATCH_SIZE"    desc:"maximum number of deliveries sent per check"`
+}
+
+type Stream struct {
+	BufferSize        int           `yaml:"buffer_size"        env:"STREAM_BUFFER_SIZE"        desc:"number of recent stock events kept for clients resuming the stock stream"`
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval" env:"STREAM_HEARTBEAT_INTERVAL" desc:"how often idle stock stream connections are sent a heartbeat"`
+}
+
+type Imports struct {
+	BatchSize int `yaml:"batch_size" env:"IMPORT_BATCH_SIZE" desc:"number of product import rows written per transaction"`
+	MaxBytes  int `yaml:"max_bytes"  env:"IMPORT_MAX_BYTES"  desc:"largest product import upload accepted, in bytes"`
+}
+
+type Products struct {
+	PurgeRetentionDays int `yaml:"purge_retention_days"  env:"PRODUCT_PURGE_RETENTION_DAYS"  desc:"days a product must stay deleted before it can be purged"`
+	BatchMaxOperations int `yaml:"batch_max_operations" env:"PRODUCT_BATCH_MAX_OPERATIONS" desc:"most operations accepted by one batch request"`
+}
+
+type GraphQL struct {
+	MaxDepth      int `yaml:"max_depth"      env:"GRAPHQL_MAX_DEPTH"      desc:"deepest field nesting accepted in a GraphQL query"`
+	MaxComplexity int `yaml:"max_complexity" env:"GRAPHQL_MAX_COMPLEXITY" desc:"highest estimated cost accepted for a GraphQL query, counting each field once per item of the lists it is in"`
+}
+
+// Default returns the configuration used when no other source sets a value.
+func Default() *Config {
+	return &Config{
+		TimeZone: "Africa/Nairobi",
+		Log: Log{
+			Level:  "info",
+			Format: "json",
+		},
+		Server: Server{
+			Port:              8080,
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		GRPC: GRPC{
+			Port: 9090,
+		},
+		Database: Database{
+			Port:            5432,
+			SSLMode:         "prefer",
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			ConnectAttempts: 5,
+			ConnectBackoff:  500 * time.Millisecond,
+			SlowQuery:       200 * time.Millisecond,
+		},
+		CORS: CORS{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "X-API-Key", "X-Request-ID", "traceparent", "tracestate"},
+			ExposedHeaders: []string{"Location", "X-Request-ID", "X-Trace-Id"},
+			MaxAge:         10 * time.Minute,
+		},
+		Health: Health{
+			CheckTimeout: 2 * time.Second,
+		},
+		Tracing: Tracing{
+			Exporter:     "none",
+			OTLPEndpoint: "localhost:4318",
+			ServiceName:  "simpler-test",
+			SampleRatio:  1,
+		},
+		LowStock: LowStock{
+			Notifier:  "log",
+			QueueSize: 100,
+		},
+		Events: Events{
+			Publisher:     "log",
+			PollInterval:  time.Second,
+			BatchSize:     100,
+			RetryBackoff:  time.Second,
+			MaxBackoff:    5 * time.Minute,
+			AlertAttempts: 10,
+		},
+		Webhooks: Webhooks{
+			Timeout:      10 * time.Second,
+			MaxAttempts:  8,
+			RetryBackoff: 30 * time.Second,
+			MaxBackoff:   time.Hour,
+			PollInterval: time.Second,
+			BatchSize:    50,
+		},
+		Stream: Stream{
+			BufferSize:        1000,
+			HeartbeatInterval: 15 * time.Second,
+		},
+		Imports: Imports{
+			BatchSize: 500,
+			MaxBytes:  64 << 20,
+		},
+		Products: Products{
+			PurgeRetentionDays: 30,
+			BatchMaxOperations: 100,
+		},
+		GraphQL: GraphQL{
+			MaxDepth:      8,
+			MaxComplexity: 5000,
+		},
+	}
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if _, err := time.LoadLocation(c.TimeZone); err != nil {
+		errs = append(errs, fmt.Errorf("APP_TIMEZONE %q is not a valid time zone", c.TimeZone))
+	}
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+	switch c.Log.Format {
+	case "json", "text":
+	default:
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be json or text, got %q", c.Log.Format))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("SERVER_PORT must be between 1 and 65535, got %d", c.Server.Port))
+	}
+	if c.GRPC.Port < 1 || c.GRPC.Port > 65535 {
+		errs = append(errs, fmt.Errorf("GRPC_PORT must be between 1 and 65535, got %d", c.GRPC.Port))
+	}
+	if c.GRPC.Port == c.Server.Port {
+		errs = append(errs, fmt.Errorf("GRPC_PORT must differ from SERVER_PORT, both are %d", c.GRPC.Port))
+	}
+	for key, timeout := range map[string]time.Duration{
+		"SERVER_READ_TIMEOUT":        c.Server.ReadTimeout,
+		"SERVER_READ_HEADER_TIMEOUT": c.Server.ReadHeaderTimeout,
+		"SERVER_WRITE_TIMEOUT":       c.Server.WriteTimeout,
+		"SERVER_IDLE_TIMEOUT":        c.Server.IdleTimeout,
+		"SERVER_SHUTDOWN_TIMEOUT":    c.Server.ShutdownTimeout,
+		"HEALTH_CHECK_TIMEOUT":       c.Health.CheckTimeout,
+		"EVENTS_RETRY_BACKOFF":       c.Events.RetryBackoff,
+		"WEBHOOK_TIMEOUT":            c.Webhooks.Timeout,
+		"WEBHOOK_RETRY_BACKOFF":      c.Webhooks.RetryBackoff,
+		"WEBHOOK_POLL_INTERVAL":      c.Webhooks.PollInterval,
+		"STREAM_HEARTBEAT_INTERVAL":  c.Stream.HeartbeatInterval,
+	} {
+		if timeout <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", key, timeout))
+		}
+	}
+	if c.Server.MaxHeaderBytes < 1 {
+		errs = append(errs, fmt.Errorf("SERVER_MAX_HEADER_BYTES must be positive, got %d", c.Server.MaxHeaderBytes))
+	}
+
+	if c.Database.Host == "" {
+		errs = append(errs, errors.New("DB_HOST is required"))
+	}
+	if c.Database.Port < 1 || c.Database.Port > 65535 {
+		errs = append(errs, fmt.Errorf("DB_PORT must be between 1 and 65535, got %d", c.Database.Port))
+	}
+	if c.Database.User == "" {
+		errs = append(errs, errors.New("DB_USER is required"))
+	}
+	if c.Database.Name == "" {
+		errs = append(errs, errors.New("DB_NAME is required"))
+	}
+	switch c.Database.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("DB_SSLMODE must be disable, allow, prefer, require, verify-ca or verify-full, got %q", c.Database.SSLMode))
+	}
+	for key, value := range map[string]int64{
+		"DB_STATEMENT_TIMEOUT":  int64(c.Database.StatementTimeout),
+		"DB_MAX_OPEN_CONNS":     int64(c.Database.MaxOpenConns),
+		"DB_MAX_IDLE_CONNS":     int64(c.Database.MaxIdleConns),
+		"DB_CONN_MAX_LIFETIME":  int64(c.Database.ConnMaxLifetime),
+		"DB_CONN_MAX_IDLE_TIME": int64(c.Database.ConnMaxIdleTime),
+		"DB_CONNECT_BACKOFF":    int64(c.Database.ConnectBackoff),
+		"DB_SLOW_QUERY":         int64(c.Database.SlowQuery),
+	} {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s cannot be negative", key))
+		}
+	}
+	if c.Database.ConnectAttempts < 1 {
+		errs = append(errs, fmt.Errorf("DB_CONNECT_ATTEMPTS must be at least 1, got %d", c.Database.ConnectAttempts))
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" && c.CORS.AllowCredentials {
+			errs = append(errs, errors.New("CORS_ALLOWED_ORIGINS cannot contain * when CORS_ALLOW_CREDENTIALS is enabled"))
+		} else if origin != "*" && !strings.Contains(origin, "://") {
+			errs = append(errs, fmt.Errorf("CORS_ALLOWED_ORIGINS entry %q must include a scheme, e.g. https://%s", origin, origin))
+		}
+	}
+	if c.CORS.MaxAge < 0 {
+		errs = append(errs, errors.New("CORS_MAX_AGE cannot be negative"))
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if c.Tracing.OTLPEndpoint == "" {
+			errs = append(errs, errors.New("TRACING_OTLP_ENDPOINT is required for the otlp exporter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("TRACING_EXPORTER must be none, stdout or otlp, got %q", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("TRACING_SAMPLE_RATIO must be between 0 and 1, got %g", c.Tracing.SampleRatio))
+	}
+
+	switch c.LowStock.Notifier {
+	case "log":
+	case "webhook":
+		if c.LowStock.WebhookURL == "" {
+			errs = append(errs, errors.New("LOW_STOCK_WEBHOOK_URL is required for the webhook notifier"))
+		}
+	case "file":
+		if c.LowStock.FilePath == "" {
+			errs = append(errs, errors.New("LOW_STOCK_FILE_PATH is required for the file notifier"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("LOW_STOCK_NOTIFIER must be log, webhook or file, got %q", c.LowStock.Notifier))
+	}
+
+	if c.LowStock.QueueSize < 1 {
+		errs = append(errs, fmt.Errorf("LOW_STOCK_QUEUE_SIZE must be positive, got %d", c.LowStock.QueueSize))
+	}
+
+	switch c.Events.Publisher {
+	case "log":
+	case "http":
+		if c.Events.URL == "" {
+			errs = append(errs, errors.New("EVENTS_URL is required for the http publisher"))
+		}
+	case "file":
+		if c.Events.FilePath == "" {
+			errs = append(errs, errors.New("EVENTS_FILE_PATH is required for the file publisher"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("EVENTS_PUBLISHER must be log, file or http, got %q", c.Events.Publisher))
+	}
+
+	if c.Events.PollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("EVENTS_POLL_INTERVAL must be positive, got %s", c.Events.PollInterval))
+	}
+	if c.Events.BatchSize < 1 {
+		errs = append(errs, fmt.Errorf("EVENTS_BATCH_SIZE must be positive, got %d", c.Events.BatchSize))
+	}
+	if c.Events.MaxBackoff < c.Events.RetryBackoff {
+		errs = append(errs, fmt.Errorf("EVENTS_MAX_BACKOFF cannot be shorter than EVENTS_RETRY_BACKOFF, got %s", c.Events.MaxBackoff))
+	}
+	if c.Events.AlertAttempts < 1 {
+		errs = append(errs, fmt.Errorf("EVENTS_ALERT_ATTEMPTS must be at least 1, got %d", c.Events.AlertAttempts))
+	}
+
+	if c.Webhooks.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be at least 1, got %d", c.Webhooks.MaxAttempts))
+	}
+	if c.Webhooks.MaxBackoff < c.Webhooks.RetryBackoff {
+		errs = append(errs, fmt.Errorf("WEBHOOK_MAX_BACKOFF cannot be shorter than WEBHOOK_RETRY_BACKOFF, got %s", c.Webhooks.MaxBackoff))
+	}
+	if c.Webhooks.BatchSize < 1 {
+		errs = append(errs, fmt.Errorf("WEBHOOK_BATCH_SIZE must be positive, got %d", c.Webhooks.BatchSize))
+	}
+
+	if c.Stream.BufferSize < 1 {
+		errs = append(errs, fmt.Errorf("STREAM_BUFFER_SIZE must be positive, got %d", c.Stream.BufferSize))
+	}
+
+	if c.Imports.BatchSize < 1 {
+		errs = append(errs, fmt.Errorf("IMPORT_BATCH_SIZE must be positive, got %d", c.Imports.BatchSize))
+	}
+	if c.Imports.MaxBytes < 1 {
+		errs = append(errs, fmt.Errorf("IMPORT_MAX_BYTES must be positive, got %d", c.Imports.MaxBytes))
+	}
+
+	if c.Products.PurgeRetentionDays < 0 {
+		errs = append(errs, fmt.Errorf("PRODUCT_PURGE_RETENTION_DAYS cannot be negative, got %d", c.Products.PurgeRetentionDays))
+	}
+	if c.Products.BatchMaxOperations < 1 {
+		errs = append(errs, fmt.Errorf("PRODUCT_BATCH_MAX_OPERATIONS must be positive, got %d", c.Products.BatchMaxOperations))
+	}
+
+	if c.GraphQL.MaxDepth < 1 {
+		errs = append(errs, fmt.Errorf("GRAPHQL_MAX_DEPTH must be positive, got %d", c.GraphQL.MaxDepth))
+	}
+	if c.GraphQL.MaxComplexity < 1 {
+		errs = append(errs, fmt.Errorf("GRAPHQL_MAX_COMPLEXITY must be positive, got %d", c.GraphQL.MaxComplexity))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Location returns the configured time zone. It assumes Validate has passed.
+func (c *Config) Location() *time.Location {
+	location, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
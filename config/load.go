@@ -0,0 +1,203 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "******"
+
+// ErrInvalidFlags wraps errors parsing the command line, including
+// flag.ErrHelp when help was asked for.
+var ErrInvalidFlags = errors.New("invalid command line")
+
+// Load builds the configuration from, in increasing order of precedence:
+// defaults, an optional configuration file, the environment and command line
+// flags. The configuration file is YAML when it ends in .yaml or .yml and a
+// dotenv file otherwise; it defaults to .env and may be missing unless chosen
+// explicitly with -config or CONFIG_FILE. Load returns the arguments left
+// after the flags.
+func Load(args []string) (*Config, []string, error) {
+	return LoadFlags(flag.NewFlagSet("config", flag.ContinueOnError), args)
+}
+
+// LoadFlags is Load with the configuration flags added to flags, so that
+// commands can take their own flags next to them.
+func LoadFlags(flags *flag.FlagSet, args []string) (*Config, []string, error) {
+	cfg := Default()
+
+	configFile := flags.String("config", "", "configuration file, YAML (.yaml, .yml) or dotenv (default .env)")
+	values := map[string]*string{}
+	walk(reflect.ValueOf(cfg).Elem(), func(field reflect.Value, tag reflect.StructTag) {
+		key := tag.Get("env")
+		values[key] = flags.String(flagName(key), "", tag.Get("desc"))
+	})
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidFlags, err)
+	}
+
+	path, required := *configFile, true
+	if path == "" {
+		path, required = os.Getenv("CONFIG_FILE"), true
+	}
+	if path == "" {
+		path, required = ".env", false
+	}
+	if err := loadFile(cfg, path, required); err != nil {
+		return nil, nil, err
+	}
+
+	var errs []error
+	walk(reflect.ValueOf(cfg).Elem(), func(field reflect.Value, tag reflect.StructTag) {
+		key := tag.Get("env")
+		if value, ok := os.LookupEnv(key); ok {
+			errs = append(errs, set(field, key, value))
+		}
+	})
+	flags.Visit(func(f *flag.Flag) {
+		for key, value := range values {
+			if flagName(key) == f.Name {
+				errs = append(errs, setKey(cfg, key, *value))
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+// String prints every setting as KEY=value with secrets redacted.
+func (c *Config) String() string {
+	var b strings.Builder
+	walk(reflect.ValueOf(c).Elem(), func(field reflect.Value, tag reflect.StructTag) {
+		value := format(field)
+		if tag.Get("secret") == "true" && value != "" {
+			value = redacted
+		}
+		fmt.Fprintf(&b, "%s=%s\n", tag.Get("env"), value)
+	})
+	return b.String()
+}
+
+func loadFile(cfg *Config, path string, required bool) error {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(contents, cfg); err != nil {
+			return fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+		return nil
+	default:
+		values, err := godotenv.UnmarshalBytes(contents)
+		if err != nil {
+			return fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+		var errs []error
+		for key, value := range values {
+			errs = append(errs, setKey(cfg, key, value))
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// setKey sets the field tagged with the environment variable key. Keys that
+// do not belong to the configuration are ignored.
+func setKey(cfg *Config, key, value string) error {
+	var err error
+	walk(reflect.ValueOf(cfg).Elem(), func(field reflect.Value, tag reflect.StructTag) {
+		if tag.Get("env") == key {
+			err = set(field, key, value)
+		}
+	})
+	return err
+}
+
+func set(field reflect.Value, key, value string) error {
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a valid duration", key, value)
+		}
+		field.SetInt(int64(duration))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a valid number", key, value)
+		}
+		field.SetInt(int64(number))
+	case field.Kind() == reflect.Float64:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a valid number", key, value)
+		}
+		field.SetFloat(number)
+	case field.Kind() == reflect.Bool:
+		boolean, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a valid boolean", key, value)
+		}
+		field.SetBool(boolean)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s: unsupported setting type %s", key, field.Type())
+	}
+	return nil
+}
+
+func format(field reflect.Value) string {
+	switch value := field.Interface().(type) {
+	case []string:
+		return strings.Join(value, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// walk calls fn for every field tagged with an environment variable, in
+// declaration order, descending into nested sections.
+func walk(v reflect.Value, fn func(field reflect.Value, tag reflect.StructTag)) {
+	for i := 0; i < v.NumField(); i++ {
+		field, structField := v.Field(i), v.Type().Field(i)
+		if structField.Tag.Get("env") != "" {
+			fn(field, structField.Tag)
+		} else if field.Kind() == reflect.Struct {
+			walk(field, fn)
+		}
+	}
+}
+
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AdminHandler struct {
+	DB *gorm.DB
+	// PurgeRetentionDays is the minimum number of days a product must have
+	// been soft-deleted before it can be purged.
+	PurgeRetentionDays int
+}
+
+func AdminRepository(db *gorm.DB, purgeRetentionDays int) *AdminHandler {
+	return &AdminHandler{
+		DB:                 db,
+		PurgeRetentionDays: purgeRetentionDays,
+	}
+}
+
+type PurgeData struct {
+	Purged int64     `json:"purged"`
+	Cutoff time.Time `json:"cutoff"`
+}
+
+// PurgeProducts godoc
+// @Summary Purge deleted products
+// @Description permanently delete products soft-deleted more than older_than_days ago. Products referenced by purchase orders are retained.
+// @Tags admin
+// @Param older_than_days query int false "Minimum days since deletion, no lower than the configured retention"
+// @Produce json
+// @Success 200 {object} PurgeData
+// @Failure 400 {object} Response
+// @Failure 401 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/admin/products/purge [delete]
+func (a *AdminHandler) PurgeProducts(ctx *gin.Context) {
+	olderThanDays, err := strconv.Atoi(ctx.DefaultQuery("older_than_days", strconv.Itoa(a.PurgeRetentionDays)))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": "incorrect older_than_days format"})
+		return
+	}
+	if olderThanDays < a.PurgeRetentionDays {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": fmt.Sprintf("older_than_days cannot be lower than the %d day retention period", a.PurgeRetentionDays)})
+		return
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -olderThanDays)
+
+	var purged int64
+	err = a.DB.WithContext(ctx.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		//find products deleted before the cutoff, locking them until they are removed
+		var products []models.Product
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Where("id NOT IN (?)", tx.Unscoped().Model(&models.PurchaseOrderLine{}).Select("product_id")).
+			Find(&products).Error
+		if err != nil || len(products) == 0 {
+			return err
+		}
+
+		//permanently remove them, recording each one
+		result := tx.Unscoped().Delete(&products)
+		if result.Error != nil {
+			return result.Error
+		}
+		for _, product := range products {
+			if err := audit.Record(tx, auditEntry(ctx.Request.Context(), audit.ActionPurge, audit.EntityProduct, product.ID, toProductData(product), nil)); err != nil {
+				return err
+			}
+		}
+		purged = result.RowsAffected
+		return nil
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": PurgeData{Purged: purged, Cutoff: cutoff}})
+}
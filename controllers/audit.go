@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/helpers"
+	"github.com/AllanM007/simpler-test/logging"
+	"github.com/AllanM007/simpler-test/middleware"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AuditHandler struct {
+	DB *gorm.DB
+}
+
+func AuditRepository(db *gorm.DB) *AuditHandler {
+	return &AuditHandler{
+		DB: db,
+	}
+}
+
+type AuditLogData struct {
+	Id         uint                          `json:"id"`
+	Actor      string                        `json:"actor"`
+	Action     string                        `json:"action"`
+	EntityType string                        `json:"entity_type"`
+	EntityId   uint                          `json:"entity_id"`
+	Changes    map[string]models.FieldChange `json:"changes"`
+	RequestId  string                        `json:"request_id"`
+	CreatedAt  time.Time                     `json:"created_at"`
+}
+
+type AuditPaginatedResponse struct {
+	Entries []AuditLogData `json:"entries"`
+	Meta    RequestMeta    `json:"meta"`
+}
+
+// GetAuditLogs godoc
+// @Summary Audit log
+// @Description get recorded changes, newest first, optionally filtered
+// @Tags admin
+// @Param entity_type query string false "Entity type, e.g. product"
+// @Param entity_id   query int    false "Entity id"
+// @Param action      query string false "Action, e.g. update"
+// @Param actor       query string false "Actor"
+// @Param request_id  query string false "Request id"
+// @Param from        query string false "Earliest change, RFC 3339"
+// @Param to          query string false "Latest change, RFC 3339"
+// @Param page        query string false "Number of page"          default(1)
+// @Param limit       query string false "Entries count in a page" default(10)
+// @Produce json
+// @Success 200 {object} AuditPaginatedResponse
+// @Failure 400 {object} Response
+// @Failure 401 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/audit [get]
+func (a *AuditHandler) GetAuditLogs(ctx *gin.Context) {
+	page, limit, err := helpers.GetPagingData(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+
+	query := a.DB.WithContext(ctx.Request.Context()).Model(&models.AuditLog{})
+	if value, ok := ctx.GetQuery("entity_id"); ok {
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": "incorrect entity_id format"})
+			return
+		}
+	}
+	for param, column := range map[string]string{
+		"entity_type": "entity_type",
+		"entity_id":   "entity_id",
+		"action":      "action",
+		"actor":       "actor",
+		"request_id":  "request_id",
+	} {
+		if value, ok := ctx.GetQuery(param); ok {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	for param, condition := range map[string]string{
+		"from": "created_at >= ?",
+		"to":   "created_at <= ?",
+	} {
+		value, ok := ctx.GetQuery(param)
+		if !ok {
+			continue
+		}
+		bound, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": "incorrect " + param + " format, expected RFC 3339"})
+			return
+		}
+		query = query.Where(condition, bound)
+	}
+
+	var count int64
+	if err := query.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var entries []models.AuditLog
+	result := query.Session(&gorm.Session{}).Limit(limit).Offset(helpers.GetOffset(page, limit)).Order("id DESC").Find(&entries)
+	if result.Error != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	response := AuditPaginatedResponse{
+		Entries: toAuditLogList(entries),
+		Meta: RequestMeta{
+			CurrentPage: page,
+			Limit:       limit,
+			Total:       count,
+		},
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": response})
+}
+
+// auditEntry describes a change made by the caller ctx belongs to.
+func auditEntry(ctx context.Context, action, entityType string, entityId uint, before, after interface{}) audit.Entry {
+	actor := audit.Actor(ctx)
+	if actor == "" {
+		actor = middleware.Anonymous
+	}
+	return audit.Entry{
+		Actor:      actor,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityId,
+		Before:     before,
+		After:      after,
+		RequestID:  logging.RequestID(ctx),
+	}
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/AllanM007/simpler-test/health"
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	Registry *health.Registry
+}
+
+func HealthRepository(registry *health.Registry) *HealthHandler {
+	return &HealthHandler{
+		Registry: registry,
+	}
+}
+
+// Liveness godoc
+// @Summary Liveness probe
+// @Description report whether the process is alive
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /healthz [get]
+func (h *HealthHandler) Liveness(ctx *gin.Context) {
+	writeReport(ctx, h.Registry.Liveness(ctx.Request.Context()))
+}
+
+// Readiness godoc
+// @Summary Readiness probe
+// @Description report whether the service can take traffic: the database is reachable, migrations are applied and the service is not shutting down
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (h *HealthHandler) Readiness(ctx *gin.Context) {
+	writeReport(ctx, h.Registry.Readiness(ctx.Request.Context()))
+}
+
+func writeReport(ctx *gin.Context, report health.Report) {
+	status := http.StatusOK
+	if !report.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.JSON(status, report)
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/AllanM007/simpler-test/helpers"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type InventoryHandler struct {
+	DB *gorm.DB
+}
+
+func InventoryRepository(db *gorm.DB) *InventoryHandler {
+	return &InventoryHandler{
+		DB: db,
+	}
+}
+
+type LowStockData struct {
+	Id              uint   `json:"id"`
+	Name            string `json:"name"`
+	Stock           int    `json:"stock"`
+	ReorderPoint    int    `json:"reorder_point"`
+	ReorderQuantity int    `json:"reorder_quantity"`
+}
+
+type LowStockPaginatedResponse struct {
+	Products []LowStockData `json:"products"`
+	Meta     RequestMeta    `json:"meta"`
+}
+
+// GetLowStock godoc
+// @Summary Low stock report
+// @Description get active products at or below their reorder point
+// @Tags inventory
+// @Param page       query string false "Number of page"           default(1)
+// @Param limit      query string false "Products count in a page" default(10)
+// @Accept  json
+// @Produce json
+// @Success 200 {object} LowStockPaginatedResponse
+// @Failure 400 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/inventory/low-stock [get]
+func (i *InventoryHandler) GetLowStock(ctx *gin.Context) {
+	page, limit, err := helpers.GetPagingData(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+
+	//active products with a reorder point set whose stock has fallen to it
+	lowStock := i.DB.WithContext(ctx.Request.Context()).Model(&models.Product{}).Where("active = ? AND reorder_point > 0 AND stock_level <= reorder_point", true)
+
+	var count int64
+	if err := lowStock.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var products []models.Product
+	result := lowStock.Session(&gorm.Session{}).Limit(limit).Offset(helpers.GetOffset(page, limit)).Order("stock_level ASC, id ASC").Find(&products)
+	if result.Error != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	response := LowStockPaginatedResponse{
+		Products: toLowStockList(products),
+		Meta: RequestMeta{
+			CurrentPage: page,
+			Limit:       limit,
+			Total:       count,
+		},
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": response})
+}
+
+type OutstandingData struct {
+	ProductId   uint   `json:"product_id"`
+	Name        string `json:"name"`
+	Outstanding int    `json:"outstanding"`
+}
+
+// GetOutstandingOrders godoc
+// @Summary Outstanding purchase order report
+// @Description get quantities ordered from suppliers but not yet received, per product
+// @Tags inventory
+// @Produce json
+// @Success 200 {array} OutstandingData
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/inventory/outstanding [get]
+func (i *InventoryHandler) GetOutstandingOrders(ctx *gin.Context) {
+	data := []OutstandingData{}
+
+	//sum unreceived quantities on approved purchase orders
+	result := i.DB.WithContext(ctx.Request.Context()).Model(&models.PurchaseOrderLine{}).
+		Select("purchase_order_lines.product_id, products.name, SUM(purchase_order_lines.quantity - purchase_order_lines.received_quantity) AS outstanding").
+		Joins("JOIN purchase_orders ON purchase_orders.id = purchase_order_lines.purchase_order_id AND purchase_orders.deleted_at IS NULL").
+		Joins("JOIN products ON products.id = purchase_order_lines.product_id").
+		Where("purchase_orders.status IN ?", []string{models.PurchaseOrderApproved, models.PurchaseOrderPartiallyReceived}).
+		Group("purchase_order_lines.product_id, products.name").
+		Having("SUM(purchase_order_lines.quantity - purchase_order_lines.received_quantity) > 0").
+		Order("purchase_order_lines.product_id ASC").
+		Scan(&data)
+	if result.Error != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": data})
+}
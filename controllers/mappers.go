@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"github.com/AllanM007/simpler-test/models"
+)
+
+// Mappers turn models into the response shapes returned by the API. Handlers
+// should always respond through these so every endpoint exposes the same
+// fields for the same resource.
+
+func toProductData(product models.Product) ProductData {
+	data := ProductData{
+		Id:              product.ID,
+		Name:            product.Name,
+		Description:     product.Description,
+		Price:           product.Price,
+		Stock:           product.StockLevel,
+		ReorderPoint:    product.ReorderPoint,
+		ReorderQuantity: product.ReorderQuantity,
+		Active:          product.Active,
+		CreatedAt:       product.CreatedAt,
+		UpdatedAt:       product.UpdatedAt,
+	}
+	if product.DeletedAt.Valid {
+		deletedAt := product.DeletedAt.Time
+		data.DeletedAt = &deletedAt
+	}
+	return data
+}
+
+func toProductList(products []models.Product) []ProductData {
+	data := make([]ProductData, 0, len(products))
+	for _, product := range products {
+		data = append(data, toProductData(product))
+	}
+	return data
+}
+
+func toLowStockList(products []models.Product) []LowStockData {
+	data := make([]LowStockData, 0, len(products))
+	for _, product := range products {
+		data = append(data, LowStockData{
+			Id:              product.ID,
+			Name:            product.Name,
+			Stock:           product.StockLevel,
+			ReorderPoint:    product.ReorderPoint,
+			ReorderQuantity: product.ReorderQuantity,
+		})
+	}
+	return data
+}
+
+func toSupplierData(supplier models.Supplier) SupplierData {
+	return SupplierData{
+		Id:        supplier.ID,
+		Name:      supplier.Name,
+		Email:     supplier.Email,
+		Phone:     supplier.Phone,
+		CreatedAt: supplier.CreatedAt,
+	}
+}
+
+func toSupplierList(suppliers []models.Supplier) []SupplierData {
+	data := make([]SupplierData, 0, len(suppliers))
+	for _, supplier := range suppliers {
+		data = append(data, toSupplierData(supplier))
+	}
+	return data
+}
+
+func toPurchaseOrderData(order models.PurchaseOrder) PurchaseOrderData {
+	lines := make([]PurchaseOrderLineData, 0, len(order.Lines))
+	for _, line := range order.Lines {
+		lines = append(lines, PurchaseOrderLineData{
+			Id:               line.ID,
+			ProductId:        line.ProductID,
+			Quantity:         line.Quantity,
+			ReceivedQuantity: line.ReceivedQuantity,
+			Outstanding:      line.Outstanding(),
+			UnitCost:         line.UnitCost,
+		})
+	}
+
+	return PurchaseOrderData{
+		Id:         order.ID,
+		SupplierId: order.SupplierID,
+		Status:     order.Status,
+		Lines:      lines,
+		ApprovedAt: order.ApprovedAt,
+		ReceivedAt: order.ReceivedAt,
+		CreatedAt:  order.CreatedAt,
+		UpdatedAt:  order.UpdatedAt,
+	}
+}
+
+func toAuditLogList(entries []models.AuditLog) []AuditLogData {
+	data := make([]AuditLogData, 0, len(entries))
+	for _, entry := range entries {
+		data = append(data, AuditLogData{
+			Id:         entry.ID,
+			Actor:      entry.Actor,
+			Action:     entry.Action,
+			EntityType: entry.EntityType,
+			EntityId:   entry.EntityID,
+			Changes:    entry.Changes,
+			RequestId:  entry.RequestID,
+			CreatedAt:  entry.CreatedAt,
+		})
+	}
+	return data
+}
+
+func toWebhookData(subscription models.WebhookSubscription) WebhookData {
+	return WebhookData{
+		Id:         subscription.ID,
+		URL:        subscription.URL,
+		EventTypes: subscription.EventTypes,
+		Active:     subscription.Active,
+		CreatedAt:  subscription.CreatedAt,
+		UpdatedAt:  subscription.UpdatedAt,
+	}
+}
+
+func toWebhookList(subscriptions []models.WebhookSubscription) []WebhookData {
+	data := make([]WebhookData, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		data = append(data, toWebhookData(subscription))
+	}
+	return data
+}
+
+func toWebhookDeliveryData(delivery models.WebhookDelivery) WebhookDeliveryData {
+	attempts := make([]WebhookAttemptData, 0, len(delivery.AttemptLog))
+	for _, attempt := range delivery.AttemptLog {
+		attempts = append(attempts, WebhookAttemptData{
+			StatusCode:  attempt.StatusCode,
+			Error:       attempt.Error,
+			DurationMs:  attempt.DurationMs,
+			AttemptedAt: attempt.CreatedAt,
+		})
+	}
+
+	data := WebhookDeliveryData{
+		Id:          delivery.ID,
+		WebhookId:   delivery.SubscriptionID,
+		EventId:     delivery.EventID,
+		EventType:   delivery.EventType,
+		Status:      delivery.Status,
+		Attempts:    delivery.Attempts,
+		LastError:   delivery.LastError,
+		DeliveredAt: delivery.DeliveredAt,
+		CreatedAt:   delivery.CreatedAt,
+		AttemptLog:  attempts,
+	}
+	//only pending deliveries have another attempt coming
+	if delivery.Status == models.WebhookDeliveryPending {
+		nextAttemptAt := delivery.NextAttemptAt
+		data.NextAttemptAt = &nextAttemptAt
+	}
+	return data
+}
+
+func toWebhookDeliveryList(deliveries []models.WebhookDelivery) []WebhookDeliveryData {
+	data := make([]WebhookDeliveryData, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		data = append(data, toWebhookDeliveryData(delivery))
+	}
+	return data
+}
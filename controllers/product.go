@@ -2,15 +2,22 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/events"
 	"github.com/AllanM007/simpler-test/helpers"
+	"github.com/AllanM007/simpler-test/middleware"
 	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/notifications"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Response struct {
@@ -28,19 +35,23 @@ type InternalErrorResponse struct {
 }
 
 type ProductCreateReq struct {
-	Name        string  `json:"name"         binding:"required"`
-	Description string  `json:"description"  binding:"required"`
-	Price       float64 `json:"price"        binding:"required,gt=0"`
-	StockLevel  int     `json:"stock"        binding:"required,gt=0"`
+	Name            string  `json:"name"              binding:"required"`
+	Description     string  `json:"description"       binding:"required"`
+	Price           float64 `json:"price"             binding:"required,gt=0"`
+	StockLevel      int     `json:"stock"             binding:"required,gt=0"`
+	ReorderPoint    int     `json:"reorder_point"     binding:"gte=0"`
+	ReorderQuantity int     `json:"reorder_quantity"  binding:"gte=0"`
 }
 
 type ProductHandler struct {
-	DB *gorm.DB
+	*ProductService
+	BatchMaxOperations int
 }
 
-func ProductsRepository(db *gorm.DB) *ProductHandler {
+func ProductsRepository(db *gorm.DB, notifier notifications.Notifier, cfg config.Products) *ProductHandler {
 	return &ProductHandler{
-		DB: db,
+		ProductService:     NewProductService(db, notifier),
+		BatchMaxOperations: cfg.BatchMaxOperations,
 	}
 }
 
@@ -51,9 +62,11 @@ func ProductsRepository(db *gorm.DB) *ProductHandler {
 // @Accept  json
 // @Produce json
 // @Param params body ProductCreateReq true "Request's body"
-// @Success 200 {object} Response
+// @Success 201 {object} ProductData
+// @Header  201 {string} Location "URL of the created product"
 // @Failure 400 {object} InvalidRequestResponse
 // @Failure 404 {object} Response
+// @Failure 409 {object} Response
 // @Failure 500 {object} InternalErrorResponse
 // @Router /api/v1/products [post]
 func (p ProductHandler) CreateProduct(ctx *gin.Context) {
@@ -67,36 +80,41 @@ func (p ProductHandler) CreateProduct(ctx *gin.Context) {
 		}
 	}
 
-	newProduct := models.Product{
-		Name:        product.Name,
-		Description: product.Description,
-		Price:       product.Price,
-		StockLevel:  product.StockLevel,
-	}
-
-	//insert new product item to database
-	result := p.DB.Create(&newProduct)
-	if result.Error != nil {
-		if strings.Contains(result.Error.Error(), "duplicate key value") {
+	//insert new product item to database together with its audit entry
+	newProduct, err := p.Create(ctx.Request.Context(), product)
+	if err != nil {
+		var invalid *ValidationError
+		if errors.As(err, &invalid) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "errors": invalid.Fields})
+			return
+		}
+		if errors.Is(err, ErrDuplicateProduct) {
 			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"status": "DUPLICATE_ENTITY", "error": "Duplicate conflict while creating product!"})
 			return
 		}
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 
 	}
 
-	ctx.JSON(http.StatusCreated, gin.H{"status": "OK", "message": "Product created successfully!"})
+	ctx.Header("Location", fmt.Sprintf("/api/v1/products/%d", newProduct.ID))
+
+	ctx.JSON(http.StatusCreated, gin.H{"status": "OK", "message": "Product created successfully!", "data": toProductData(newProduct)})
 
 }
 
 type ProductData struct {
-	Id          uint      `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price"`
-	Stock       int       `json:"stock"`
-	CreatedAt   time.Time `json:"created_at"`
+	Id              uint       `json:"id"`
+	Name            string     `json:"name"`
+	Description     string     `json:"description"`
+	Price           float64    `json:"price"`
+	Stock           int        `json:"stock"`
+	ReorderPoint    int        `json:"reorder_point"`
+	ReorderQuantity int        `json:"reorder_quantity"`
+	Active          bool       `json:"active"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
 }
 
 type RequestMeta struct {
@@ -112,52 +130,35 @@ type ProductsPaginatedResponse struct {
 
 // Get Products
 // @Summary Get products with paging
-// @Description get all products
+// @Description get all products. Inactive products are only listed for admins.
 // @Tags products
 // @Param page       query string false "Number of page"        default(1)
 // @Param limit      query string false "Books count in a page" default(10)
+// @Param include_deleted query bool false "Include soft-deleted products (admin only)" default(false)
 // @Accept  json
 // @Produce json
 // @Success 200 {object} ProductsPaginatedResponse
+// @Failure 400 {object} Response
+// @Failure 403 {object} Response
 // @Failure 404 {object} Response
 // @Failure 500 {object} InternalErrorResponse
 // @Router /api/v1/products [get]
 func (p ProductHandler) GetProducts(ctx *gin.Context) {
 	page, limit, err := helpers.GetPagingData(ctx)
 	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
 		return
 	}
 
-	//get products based on pagination parameters
-	var products []models.Product
-	result := p.DB.Limit(limit).Offset(helpers.GetOffset(page, limit)).Order("id DESC").Find(&products)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Products not found!!"})
-			return
-		}
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error})
+	filter, ok := listFilter(ctx)
+	if !ok {
 		return
 	}
 
-	var data []ProductData
-
-	for i := 0; i < len(products); i++ {
-		product := ProductData{
-			Id:          products[i].ID,
-			Name:        products[i].Name,
-			Description: products[i].Description,
-			Stock:       products[i].StockLevel,
-			CreatedAt:   products[i].CreatedAt,
-		}
-
-		data = append(data, product)
-	}
-
-	//get all products count
-	var count int64
-	tx := p.DB.Find(&products).Count(&count)
-	if tx.Error != nil {
+	//get products based on pagination parameters, with the count of all products
+	products, count, err := p.List(ctx.Request.Context(), filter, page, limit)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -168,13 +169,29 @@ func (p ProductHandler) GetProducts(ctx *gin.Context) {
 	}
 
 	response := ProductsPaginatedResponse{
-		Products: data,
+		Products: toProductList(products),
 		Meta:     meta,
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": response})
 }
 
+// listFilter selects the products the caller may list: inactive products only
+// for admins, and deleted ones too if an admin asked for include_deleted. It
+// aborts the request when the filters are invalid.
+func listFilter(ctx *gin.Context) (ProductFilter, bool) {
+	includeDeleted, err := strconv.ParseBool(ctx.DefaultQuery("include_deleted", "false"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": "incorrect include_deleted format"})
+		return ProductFilter{}, false
+	}
+	if includeDeleted && !middleware.IsAdmin(ctx) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "FORBIDDEN", "message": "Only admins can list deleted products"})
+		return ProductFilter{}, false
+	}
+	return ProductFilter{IncludeInactive: middleware.IsAdmin(ctx), IncludeDeleted: includeDeleted}, true
+}
+
 // GetProductById godoc
 // @Summary Get product
 // @Description get product by id
@@ -190,37 +207,28 @@ func (p ProductHandler) GetProductById(ctx *gin.Context) {
 	productId := ctx.Param("id")
 
 	//get product using id
-	var product models.Product
-	result := p.DB.Where("id = ?", productId).First(&product)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+	product, err := p.Get(ctx.Request.Context(), productId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Product not found!!"})
 			return
 		}
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error})
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var data []ProductData
-
-	productObject := ProductData{
-		Id:          product.ID,
-		Name:        product.Name,
-		Description: product.Description,
-		Stock:       product.StockLevel,
-		CreatedAt:   product.CreatedAt,
-	}
-
-	data = append(data, productObject)
-
-	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": data})
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": toProductData(product)})
 }
 
+// ProductUpdateReq changes the fields it sets and leaves the others unchanged.
+// Stock is not among them: it only changes through sales, receipts and stock
+// adjustments.
 type ProductUpdateReq struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	StockLevel  int     `json:"stockLevel"`
+	Name            *string  `json:"name"`
+	Description     *string  `json:"description"`
+	Price           *float64 `json:"price"             binding:"omitempty,gt=0"`
+	ReorderPoint    *int     `json:"reorder_point"     binding:"omitempty,gte=0"`
+	ReorderQuantity *int     `json:"reorder_quantity"  binding:"omitempty,gte=0"`
 }
 
 // UpdateProduct godoc
@@ -231,7 +239,7 @@ type ProductUpdateReq struct {
 // @Accept  json
 // @Produce json
 // @Param params body ProductUpdateReq true "Request's body"
-// @Success 200 {object} Response
+// @Success 200 {object} ProductData
 // @Failure 400 {object} InvalidRequestResponse
 // @Failure 404 {object} Response
 // @Failure 500 {object} InternalErrorResponse
@@ -249,34 +257,27 @@ func (p ProductHandler) UpdateProduct(ctx *gin.Context) {
 		}
 	}
 
-	//get product by id
-	var product models.Product
-	result := p.DB.Where("id = ?", productId).First(&product)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+	product, err := p.Update(ctx.Request.Context(), productId, updateProductReq)
+	if err != nil {
+		var invalid *ValidationError
+		if errors.As(err, &invalid) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "errors": invalid.Fields})
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Product not found!!"})
 			return
 		}
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
-		return
-	}
-
-	product.Name = updateProductReq.Name
-	product.Description = updateProductReq.Description
-
-	//update existing products
-	updateResult := p.DB.Save(&product)
-	if updateResult.Error != nil {
-		if strings.Contains(updateResult.Error.Error(), "duplicate key value") {
+		if errors.Is(err, ErrDuplicateProduct) {
 			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"status": "DUPLICATE_ENTITY", "error": "Duplicate conflict while updating product!"})
 			return
 		}
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "message": "Product updated successfully!"})
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "message": "Product updated successfully!", "data": toProductData(product)})
 }
 
 type ProductSale struct {
@@ -293,6 +294,7 @@ type ProductSale struct {
 // @Param params body ProductSale true "Request's body"
 // @Success 200 {object} Response
 // @Failure 400 {object} InvalidRequestResponse
+// @Failure 403 {object} Response "FORBIDDEN when stock is too low, PRODUCT_INACTIVE when the product is inactive"
 // @Failure 404 {object} Response
 // @Failure 500 {object} InternalErrorResponse
 // @Router /api/v1/products/{id}/sale [put]
@@ -307,29 +309,23 @@ func (p *ProductHandler) ProductSale(ctx *gin.Context) {
 		}
 	}
 
-	var product models.Product
-	result := p.DB.Where("id = ?", productSaleReq.Id).First(&product)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Product not found!!"})
-			return
-		}
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	var invalid *ValidationError
+	_, err := p.Sell(ctx.Request.Context(), strconv.Itoa(productSaleReq.Id), productSaleReq.Count)
+	switch {
+	case errors.As(err, &invalid):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "errors": invalid.Fields})
 		return
-	}
-
-	//check if product stock is less than sale quantity
-	if productSaleReq.Count > product.StockLevel {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Product not found!!"})
+		return
+	case errors.Is(err, ErrProductInactive):
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "PRODUCT_INACTIVE", "message": "Product is inactive and cannot be sold"})
+		return
+	case errors.Is(err, ErrInsufficientStock):
 		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "FORBIDDEN", "message": "Stock level lower than purchase quantity"})
 		return
-	}
-
-	// dedcut sale quantity from product stock
-	product.StockLevel = product.StockLevel - productSaleReq.Count
-
-	updateResult := p.DB.Save(&product)
-	if updateResult.Error != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	case err != nil:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -352,19 +348,143 @@ func (p *ProductHandler) DeleteProduct(ctx *gin.Context) {
 	productId := ctx.Param("id")
 
 	//delete product with specified id
-	var product models.Product
-	result := p.DB.Where("id = ?", productId).Delete(&product)
-	if result.Error != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
-		return
-	} else if result.RowsAffected == 0 {
-		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Product not found!!"})
+	err := p.Delete(ctx.Request.Context(), productId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Product not found!!"})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "message": "Product deleted successfully!"})
 }
 
+// RestoreProduct godoc
+// @Summary Restore product
+// @Description restore a soft-deleted product by id
+// @Tags products
+// @Param id path int true "Product Id"
+// @Produce json
+// @Success 200 {object} Response
+// @Failure 401 {object} Response
+// @Failure 404 {object} Response
+// @Failure 409 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/products/{id}/restore [post]
+func (p *ProductHandler) RestoreProduct(ctx *gin.Context) {
+	productId := ctx.Param("id")
+
+	err := p.DB.WithContext(ctx.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := lockProduct(tx.Unscoped().Where("deleted_at IS NOT NULL"), productId, &product); err != nil {
+			return err
+		}
+		before := toProductData(product)
+
+		//clear deleted_at on the soft-deleted product
+		if err := tx.Unscoped().Model(&product).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		product.DeletedAt = gorm.DeletedAt{}
+		if err := audit.Record(tx, auditEntry(ctx.Request.Context(), audit.ActionRestore, audit.EntityProduct, product.ID, before, toProductData(product))); err != nil {
+			return err
+		}
+		return events.Enqueue(tx, events.ProductUpdated, product.ID, events.NewProduct(product))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Deleted product not found!!"})
+			return
+		}
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"status": "DUPLICATE_ENTITY", "error": "An active product with the same name already exists!"})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "message": "Product restored successfully!"})
+}
+
+// ActivateProduct godoc
+// @Summary Activate product
+// @Description make a product visible and sellable
+// @Tags products
+// @Param id path int true "Product Id"
+// @Produce json
+// @Success 200 {object} Response
+// @Failure 401 {object} Response
+// @Failure 404 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/products/{id}/activate [put]
+func (p *ProductHandler) ActivateProduct(ctx *gin.Context) {
+	p.setProductActive(ctx, true)
+}
+
+// DeactivateProduct godoc
+// @Summary Deactivate product
+// @Description hide a product from non-admin listings and stop it from being sold
+// @Tags products
+// @Param id path int true "Product Id"
+// @Produce json
+// @Success 200 {object} Response
+// @Failure 401 {object} Response
+// @Failure 404 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/products/{id}/deactivate [put]
+func (p *ProductHandler) DeactivateProduct(ctx *gin.Context) {
+	p.setProductActive(ctx, false)
+}
+
+func (p *ProductHandler) setProductActive(ctx *gin.Context, active bool) {
+	productId := ctx.Param("id")
+
+	action := audit.ActionDeactivate
+	if active {
+		action = audit.ActionActivate
+	}
+
+	err := p.DB.WithContext(ctx.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := lockProduct(tx, productId, &product); err != nil {
+			return err
+		}
+		before := toProductData(product)
+
+		if err := tx.Model(&product).Update("active", active).Error; err != nil {
+			return err
+		}
+		product.Active = active
+		if err := audit.Record(tx, auditEntry(ctx.Request.Context(), action, audit.EntityProduct, product.ID, before, toProductData(product))); err != nil {
+			return err
+		}
+		return events.Enqueue(tx, events.ProductUpdated, product.ID, events.NewProduct(product))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Product not found!!"})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := "Product deactivated successfully!"
+	if active {
+		message = "Product activated successfully!"
+	}
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "message": message})
+}
+
+// lockProduct loads the product, locking its row for the rest of the
+// transaction.
+func lockProduct(tx *gorm.DB, productId string, product *models.Product) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", productId).First(product).Error
+}
+
 func formatValidationError(errs validator.ValidationErrors) map[string]string {
 	errorMessages := make(map[string]string)
 	for _, err := range errs {
@@ -0,0 +1,327 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/events"
+	"github.com/AllanM007/simpler-test/metrics"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// Batch operations.
+const (
+	BatchCreate      = "create"
+	BatchUpdate      = "update"
+	BatchDelete      = "delete"
+	BatchAdjustStock = "adjust_stock"
+)
+
+// Batch outcomes reported in the response status.
+const (
+	BatchOK         = "OK"
+	BatchPartial    = "PARTIAL"
+	BatchRolledBack = "ROLLED_BACK"
+)
+
+var errBatchFailed = errors.New("batch operation failed")
+
+type ProductBatchOperation struct {
+	Op string `json:"op" binding:"required,oneof=create update delete adjust_stock"`
+	// Id is the product updated, deleted or adjusted.
+	Id uint `json:"id"`
+	// Product is the body of a create or update, as sent to those endpoints.
+	Product json.RawMessage `json:"product" swaggertype:"object"`
+	// Delta is added to the stock of an adjust_stock.
+	Delta int `json:"delta"`
+}
+
+type ProductBatchReq struct {
+	// Atomic applies every operation or none of them.
+	Atomic     bool                    `json:"atomic"`
+	Operations []ProductBatchOperation `json:"operations" binding:"required,min=1,dive"`
+}
+
+type ProductBatchResult struct {
+	Index int    `json:"index"`
+	Op    string `json:"op"`
+	// Status is the HTTP status the operation would have had on its own.
+	Status int `json:"status"`
+	// Body is the response the operation would have had on its own.
+	Body gin.H `json:"body" swaggertype:"object"`
+}
+
+type ProductBatchData struct {
+	Atomic  bool                 `json:"atomic"`
+	Results []ProductBatchResult `json:"results"`
+}
+
+type ProductBatchResponse struct {
+	Status string           `json:"status"`
+	Data   ProductBatchData `json:"data"`
+}
+
+// stockAdjustment is a committed adjustment to check for low stock.
+type stockAdjustment struct {
+	product       models.Product
+	previousStock int
+}
+
+// BatchProducts godoc
+// @Summary Apply a batch of product operations
+// @Description create, update, delete and adjust the stock of products in one request, in order. Atomic batches run in one transaction and stop at the first failure, rolling back the operations before it. Other batches apply each operation on its own, so some may fail while the rest succeed. Every operation reports the status and body it would have had as its own request; operations of a rolled back batch report 424.
+// @Tags products
+// @Accept  json
+// @Produce json
+// @Param params body ProductBatchReq true "Request's body"
+// @Success 200 {object} ProductBatchResponse "status is OK, PARTIAL when some operations failed, or ROLLED_BACK"
+// @Failure 400 {object} InvalidRequestResponse
+// @Failure 401 {object} Response
+// @Failure 403 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/products/batch [post]
+func (p *ProductHandler) BatchProducts(ctx *gin.Context) {
+	var batchReq ProductBatchReq
+	if err := ctx.ShouldBindJSON(&batchReq); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "errors": formatValidationError(validationErrors)})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+	if len(batchReq.Operations) > p.BatchMaxOperations {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": fmt.Sprintf("A batch can hold at most %d operations", p.BatchMaxOperations)})
+		return
+	}
+
+	var results []ProductBatchResult
+	var adjustments []stockAdjustment
+	if batchReq.Atomic {
+		var err error
+		results, adjustments, err = p.runAtomicBatch(ctx, batchReq.Operations)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		results, adjustments = p.runBatch(ctx, batchReq.Operations)
+	}
+
+	status := BatchOK
+	for _, result := range results {
+		if result.Status >= http.StatusBadRequest {
+			status = BatchPartial
+		}
+		if result.Op == BatchCreate && result.Status == http.StatusCreated {
+			metrics.ProductsCreated.Inc()
+		}
+	}
+	if batchReq.Atomic && status == BatchPartial {
+		status = BatchRolledBack
+	}
+	for _, adjustment := range adjustments {
+		p.notifyLowStock(ctx.Request.Context(), adjustment.product, adjustment.previousStock)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": status, "data": ProductBatchData{Atomic: batchReq.Atomic, Results: results}})
+}
+
+// runAtomicBatch applies operations in one transaction, stopping at the first
+// failure. When one fails, the operations before it report they were rolled
+// back and the ones after it that they were never attempted.
+func (p *ProductHandler) runAtomicBatch(ctx *gin.Context, operations []ProductBatchOperation) ([]ProductBatchResult, []stockAdjustment, error) {
+	results := make([]ProductBatchResult, len(operations))
+	var adjustments []stockAdjustment
+	failed := -1
+	err := p.DB.WithContext(ctx.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		for i, operation := range operations {
+			var adjustment *stockAdjustment
+			results[i], adjustment = runBatchOperation(ctx, tx, i, operation)
+			if results[i].Status >= http.StatusBadRequest {
+				failed = i
+				return errBatchFailed
+			}
+			if adjustment != nil {
+				adjustments = append(adjustments, *adjustment)
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		return nil, nil, err
+	}
+	if failed < 0 {
+		return results, adjustments, nil
+	}
+
+	for i, operation := range operations {
+		switch {
+		case i < failed:
+			results[i] = ProductBatchResult{Index: i, Op: operation.Op, Status: http.StatusFailedDependency, Body: gin.H{"status": "ROLLED_BACK", "message": fmt.Sprintf("Rolled back because operation %d failed", failed)}}
+		case i > failed:
+			results[i] = ProductBatchResult{Index: i, Op: operation.Op, Status: http.StatusFailedDependency, Body: gin.H{"status": "NOT_ATTEMPTED", "message": fmt.Sprintf("Not attempted because operation %d failed", failed)}}
+		}
+	}
+	return results, nil, nil
+}
+
+// runBatch applies each operation in its own transaction, so a failed
+// operation leaves the others applied.
+func (p *ProductHandler) runBatch(ctx *gin.Context, operations []ProductBatchOperation) ([]ProductBatchResult, []stockAdjustment) {
+	results := make([]ProductBatchResult, len(operations))
+	var adjustments []stockAdjustment
+	for i, operation := range operations {
+		var adjustment *stockAdjustment
+		err := p.DB.WithContext(ctx.Request.Context()).Transaction(func(tx *gorm.DB) error {
+			results[i], adjustment = runBatchOperation(ctx, tx, i, operation)
+			if results[i].Status >= http.StatusBadRequest {
+				return errBatchFailed
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errBatchFailed) {
+			results[i] = ProductBatchResult{Index: i, Op: operation.Op, Status: http.StatusInternalServerError, Body: gin.H{"error": err.Error()}}
+			continue
+		}
+		if adjustment != nil && err == nil {
+			adjustments = append(adjustments, *adjustment)
+		}
+	}
+	return results, adjustments
+}
+
+// runBatchOperation applies one operation using tx and returns its result, and
+// the stock adjustment it made if any. A failed operation may have written to
+// tx, which must then be rolled back.
+func runBatchOperation(ctx *gin.Context, tx *gorm.DB, index int, operation ProductBatchOperation) (ProductBatchResult, *stockAdjustment) {
+	result := ProductBatchResult{Index: index, Op: operation.Op}
+	if operation.Op != BatchCreate && operation.Id == 0 {
+		result.Status, result.Body = http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "errors": map[string]string{"Id": "Id is required"}}
+		return result, nil
+	}
+	productId := strconv.FormatUint(uint64(operation.Id), 10)
+
+	switch operation.Op {
+	case BatchCreate:
+		var req ProductCreateReq
+		if status, body := decodeBatchProduct(operation.Product, &req); body != nil {
+			result.Status, result.Body = status, body
+			return result, nil
+		}
+		product, err := createProduct(ctx.Request.Context(), tx, req)
+		if err != nil {
+			result.Status, result.Body = batchErrorResponse(err, "Duplicate conflict while creating product!")
+			return result, nil
+		}
+		result.Status, result.Body = http.StatusCreated, gin.H{"status": "OK", "message": "Product created successfully!", "data": toProductData(product)}
+
+	case BatchUpdate:
+		var req ProductUpdateReq
+		if status, body := decodeBatchProduct(operation.Product, &req); body != nil {
+			result.Status, result.Body = status, body
+			return result, nil
+		}
+		product, err := updateProduct(ctx.Request.Context(), tx, productId, req)
+		if err != nil {
+			result.Status, result.Body = batchErrorResponse(err, "Duplicate conflict while updating product!")
+			return result, nil
+		}
+		result.Status, result.Body = http.StatusOK, gin.H{"status": "OK", "message": "Product updated successfully!", "data": toProductData(product)}
+
+	case BatchDelete:
+		if err := deleteProduct(ctx.Request.Context(), tx, productId); err != nil {
+			result.Status, result.Body = batchErrorResponse(err, "")
+			return result, nil
+		}
+		result.Status, result.Body = http.StatusOK, gin.H{"status": "OK", "message": "Product deleted successfully!"}
+
+	case BatchAdjustStock:
+		if operation.Delta == 0 {
+			result.Status, result.Body = http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "errors": map[string]string{"Delta": "Delta is required"}}
+			return result, nil
+		}
+		product, previousStock, err := adjustStock(ctx.Request.Context(), tx, productId, operation.Delta)
+		if err != nil {
+			result.Status, result.Body = batchErrorResponse(err, "")
+			return result, nil
+		}
+		result.Status, result.Body = http.StatusOK, gin.H{"status": "OK", "message": "Product stock adjusted successfully!", "data": toProductData(product)}
+		return result, &stockAdjustment{product: product, previousStock: previousStock}
+	}
+	return result, nil
+}
+
+// decodeBatchProduct decodes and validates the product of a create or update.
+// It returns the failed operation's status and body when the product is not
+// valid, and a nil body otherwise.
+func decodeBatchProduct(data json.RawMessage, req interface{}) (int, gin.H) {
+	if len(data) == 0 {
+		return http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": "product is required"}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()}
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			return http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "errors": formatValidationError(validationErrors)}
+		}
+		return http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()}
+	}
+	return 0, nil
+}
+
+// batchErrorResponse maps the error of a failed operation to the status and
+// body its own endpoint would respond with.
+func batchErrorResponse(err error, duplicateMessage string) (int, gin.H) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Product not found!!"}
+	case errors.Is(err, ErrStockBelowZero):
+		return http.StatusForbidden, gin.H{"status": "FORBIDDEN", "message": "Stock level cannot go below zero"}
+	case duplicateMessage != "" && errors.Is(err, ErrDuplicateProduct):
+		return http.StatusConflict, gin.H{"status": "DUPLICATE_ENTITY", "error": duplicateMessage}
+	default:
+		return http.StatusInternalServerError, gin.H{"error": err.Error()}
+	}
+}
+
+// adjustStock adds delta to the stock of a product with its audit entry and
+// event using tx. It returns the adjusted product and its stock before.
+func adjustStock(ctx context.Context, tx *gorm.DB, productId string, delta int) (models.Product, int, error) {
+	var product models.Product
+	if err := lockProduct(tx, productId, &product); err != nil {
+		return product, 0, err
+	}
+	previousStock := product.StockLevel
+	if previousStock+delta < 0 {
+		return product, previousStock, ErrStockBelowZero
+	}
+
+	before := toProductData(product)
+	product.StockLevel = previousStock + delta
+	if err := tx.Save(&product).Error; err != nil {
+		return product, previousStock, err
+	}
+	if err := audit.Record(tx, auditEntry(ctx, audit.ActionAdjust, audit.EntityProduct, product.ID, before, toProductData(product))); err != nil {
+		return product, previousStock, err
+	}
+	return product, previousStock, events.Enqueue(tx, events.StockChanged, product.ID, events.StockChange{
+		ProductID:     product.ID,
+		PreviousStock: previousStock,
+		Stock:         product.StockLevel,
+		Reason:        events.ReasonAdjustment,
+	})
+}
@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AllanM007/simpler-test/imports"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/gin-gonic/gin"
+)
+
+// exportFlushRows is how many rows are written between flushes, so clients
+// receive the export as it is read.
+const exportFlushRows = 100
+
+// productExporter writes products in one export format.
+type productExporter interface {
+	begin() error
+	write(product ProductData) error
+	flush() error
+	end() error
+}
+
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+	new         func(w io.Writer) productExporter
+}{
+	"csv":    {"text/csv; charset=utf-8", "csv", newCSVExporter},
+	"ndjson": {"application/x-ndjson", "ndjson", newNDJSONExporter},
+	"json":   {"application/json; charset=utf-8", "json", newJSONExporter},
+}
+
+// ExportProducts godoc
+// @Summary Export products
+// @Description stream every product as a CSV, NDJSON or JSON array download, oldest first. It applies the same visibility and include_deleted filter as listing products, without paging.
+// @Tags products
+// @Param format          query string false "Export format" Enums(csv, ndjson, json) default(csv)
+// @Param include_deleted query bool   false "Include soft-deleted products (admin only)" default(false)
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce json
+// @Success 200 {array} ProductData
+// @Header  200 {string} Content-Disposition "attachment with a file name carrying the export time"
+// @Failure 400 {object} Response
+// @Failure 403 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/products/export [get]
+func (p ProductHandler) ExportProducts(ctx *gin.Context) {
+	formatName := ctx.DefaultQuery("format", "csv")
+	format, ok := exportFormats[formatName]
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": "format must be csv, ndjson or json"})
+		return
+	}
+
+	filter, ok := listFilter(ctx)
+	if !ok {
+		return
+	}
+
+	rows, err := p.exportRows(ctx.Request.Context(), filter)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	//large catalogues take longer than the server write timeout
+	http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{})
+
+	fileName := fmt.Sprintf("products-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format.extension)
+	ctx.Header("Content-Type", format.contentType)
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	ctx.Status(http.StatusOK)
+
+	err = p.writeExport(format.new(ctx.Writer), rows, ctx.Writer.Flush)
+
+	//the status is already sent, so a failed export can only be cut short
+	switch {
+	case err == nil:
+	case errors.Is(ctx.Request.Context().Err(), context.Canceled):
+		slog.InfoContext(ctx.Request.Context(), "product export cancelled by the client")
+	default:
+		slog.ErrorContext(ctx.Request.Context(), "product export failed", "error", err)
+		ctx.Error(err)
+	}
+}
+
+// Export writes the products matching filter to w in format, one of csv,
+// ndjson or json, oldest first.
+func (s *ProductService) Export(ctx context.Context, w io.Writer, format string, filter ProductFilter) error {
+	exportFormat, ok := exportFormats[format]
+	if !ok {
+		return fmt.Errorf("unsupported export format %q, expected csv, ndjson or json", format)
+	}
+
+	rows, err := s.exportRows(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return s.writeExport(exportFormat.new(w), rows, func() {})
+}
+
+// exportRows reads the products matching filter through a cursor, so the
+// catalogue is never held in memory.
+func (s *ProductService) exportRows(ctx context.Context, filter ProductFilter) (*sql.Rows, error) {
+	return s.Query(ctx, filter).Model(&models.Product{}).Order("id ASC").Rows()
+}
+
+// writeExport writes rows with exporter, calling flush every exportFlushRows
+// rows once the exporter has flushed them.
+func (s *ProductService) writeExport(exporter productExporter, rows *sql.Rows, flush func()) error {
+	err := exporter.begin()
+	for count := 1; err == nil && rows.Next(); count++ {
+		var product models.Product
+		if err = s.DB.ScanRows(rows, &product); err != nil {
+			break
+		}
+		if err = exporter.write(toProductData(product)); err != nil {
+			break
+		}
+		if count%exportFlushRows == 0 {
+			if err = exporter.flush(); err == nil {
+				flush()
+			}
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err == nil {
+		err = exporter.end()
+	}
+	return err
+}
+
+type csvExporter struct {
+	writer *csv.Writer
+}
+
+func newCSVExporter(w io.Writer) productExporter {
+	return &csvExporter{writer: csv.NewWriter(w)}
+}
+
+func (e *csvExporter) begin() error {
+	return e.writer.Write([]string{"id", "name", "description", "price", "stock", "reorder_point", "reorder_quantity", "active", "created_at", "updated_at", "deleted_at"})
+}
+
+func (e *csvExporter) write(product ProductData) error {
+	deletedAt := ""
+	if product.DeletedAt != nil {
+		deletedAt = product.DeletedAt.Format(time.RFC3339)
+	}
+	return e.writer.Write([]string{
+		strconv.FormatUint(uint64(product.Id), 10),
+		imports.EscapeCSVText(product.Name),
+		imports.EscapeCSVText(product.Description),
+		strconv.FormatFloat(product.Price, 'f', -1, 64),
+		strconv.Itoa(product.Stock),
+		strconv.Itoa(product.ReorderPoint),
+		strconv.Itoa(product.ReorderQuantity),
+		strconv.FormatBool(product.Active),
+		product.CreatedAt.Format(time.RFC3339),
+		product.UpdatedAt.Format(time.RFC3339),
+		deletedAt,
+	})
+}
+
+func (e *csvExporter) flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvExporter) end() error {
+	return e.flush()
+}
+
+type ndjsonExporter struct {
+	encoder *json.Encoder
+}
+
+func newNDJSONExporter(w io.Writer) productExporter {
+	return &ndjsonExporter{encoder: json.NewEncoder(w)}
+}
+
+func (e *ndjsonExporter) begin() error {
+	return nil
+}
+
+func (e *ndjsonExporter) write(product ProductData) error {
+	return e.encoder.Encode(product)
+}
+
+func (e *ndjsonExporter) flush() error {
+	return nil
+}
+
+func (e *ndjsonExporter) end() error {
+	return nil
+}
+
+// jsonExporter writes a single JSON array. An export cut short leaves the
+// array unterminated, so clients cannot mistake it for a complete one.
+type jsonExporter struct {
+	w     io.Writer
+	first bool
+}
+
+func newJSONExporter(w io.Writer) productExporter {
+	return &jsonExporter{w: w, first: true}
+}
+
+func (e *jsonExporter) begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonExporter) write(product ProductData) error {
+	data, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+	if !e.first {
+		if _, err := io.WriteString(e.w, ",\n"); err != nil {
+			return err
+		}
+	}
+	e.first = false
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonExporter) flush() error {
+	return nil
+}
+
+func (e *jsonExporter) end() error {
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
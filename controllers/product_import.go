@@ -0,0 +1,464 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/events"
+	"github.com/AllanM007/simpler-test/imports"
+	"github.com/AllanM007/simpler-test/metrics"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/notifications"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Import modes.
+const (
+	ImportInsert = "insert"
+	ImportUpsert = "upsert"
+)
+
+// Import row statuses.
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportUnchanged = "unchanged"
+	ImportFailed    = "failed"
+)
+
+type ImportHandler struct {
+	*ProductService
+	BatchSize int
+	MaxBytes  int64
+}
+
+func ImportsRepository(db *gorm.DB, notifier notifications.Notifier, cfg config.Imports) *ImportHandler {
+	return &ImportHandler{
+		ProductService: NewProductService(db, notifier),
+		BatchSize:      cfg.BatchSize,
+		MaxBytes:       int64(cfg.MaxBytes),
+	}
+}
+
+type ImportRowResult struct {
+	Line   int               `json:"line"`
+	Name   string            `json:"name,omitempty"`
+	Status string            `json:"status"`
+	Id     uint              `json:"id,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+type ImportSummary struct {
+	Total     int `json:"total"`
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Failed    int `json:"failed"`
+}
+
+type ImportReport struct {
+	Mode    string            `json:"mode"`
+	DryRun  bool              `json:"dry_run"`
+	Summary ImportSummary     `json:"summary"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+func (r *ImportReport) add(results ...ImportRowResult) {
+	for _, result := range results {
+		r.Summary.Total++
+		switch result.Status {
+		case ImportCreated:
+			r.Summary.Created++
+		case ImportUpdated:
+			r.Summary.Updated++
+		case ImportUnchanged:
+			r.Summary.Unchanged++
+		case ImportFailed:
+			r.Summary.Failed++
+		}
+		r.Rows = append(r.Rows, result)
+	}
+}
+
+// sort orders the rows by line, as rows that fail validation are reported
+// before the batch holding the rows around them is written.
+func (r *ImportReport) sort() {
+	sort.SliceStable(r.Rows, func(a, b int) bool {
+		return r.Rows[a].Line < r.Rows[b].Line
+	})
+}
+
+var errUnsupportedImportFormat = errors.New("upload must be text/csv or application/x-ndjson, or name its format with the format parameter")
+
+// ProductImportRecord is a record of a product import. It accepts the
+// read-only fields of a product export and ignores them, so an export can be
+// imported again.
+type ProductImportRecord struct {
+	ProductCreateReq
+	Id        imports.Ignored `json:"id"`
+	Active    imports.Ignored `json:"active"`
+	CreatedAt imports.Ignored `json:"created_at"`
+	UpdatedAt imports.Ignored `json:"updated_at"`
+	DeletedAt imports.Ignored `json:"deleted_at"`
+}
+
+// importRow is a valid row waiting to be written.
+type importRow struct {
+	line    int
+	product ProductCreateReq
+}
+
+// ImportProducts godoc
+// @Summary Import products
+// @Description create or update products from a CSV or NDJSON upload, sent as the request body or as the file field of a multipart form. CSV uploads start with a header row naming the columns: name, description, price, stock, reorder_point and reorder_quantity. The id, active, created_at, updated_at and deleted_at columns of an export are ignored and names and descriptions escaped by a CSV export are unescaped, so an export can be imported again. Every row is validated like a created product and the report lists the outcome of each row. Rows are written in batches, so a failed row never stops the others.
+// @Tags admin
+// @Accept  text/csv
+// @Accept  application/x-ndjson
+// @Accept  multipart/form-data
+// @Produce json
+// @Param mode    query string false "insert fails rows naming an existing product, upsert updates it" Enums(insert, upsert) default(insert)
+// @Param dry_run query bool   false "Validate and report without writing anything" default(false)
+// @Param format  query string false "Upload format, detected from the content type or file name when omitted" Enums(csv, ndjson)
+// @Success 200 {object} ImportReport
+// @Failure 400 {object} Response
+// @Failure 401 {object} Response
+// @Failure 413 {object} Response
+// @Failure 415 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/products/import [post]
+func (i *ImportHandler) ImportProducts(ctx *gin.Context) {
+	mode := ctx.DefaultQuery("mode", ImportInsert)
+	if mode != ImportInsert && mode != ImportUpsert {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": "mode must be insert or upsert"})
+		return
+	}
+	dryRun, err := strconv.ParseBool(ctx.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": "incorrect dry_run format"})
+		return
+	}
+
+	body, format, err := i.upload(ctx)
+	if errors.Is(err, errUnsupportedImportFormat) {
+		ctx.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"status": "UNSUPPORTED_MEDIA_TYPE", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		abortImport(ctx, err, nil)
+		return
+	}
+	decoder, err := imports.NewDecoder(format, body, &ProductImportRecord{})
+	if err != nil {
+		abortImport(ctx, err, nil)
+		return
+	}
+
+	report, err := i.Import(ctx.Request.Context(), decoder, mode, dryRun)
+	var writeErr *importWriteError
+	if errors.As(err, &writeErr) {
+		abortImportBatch(ctx, writeErr.err, report)
+		return
+	}
+	if err != nil {
+		abortImport(ctx, err, report)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": report})
+}
+
+// importWriteError is a batch of an import that could not be written.
+type importWriteError struct {
+	err error
+}
+
+func (e *importWriteError) Error() string {
+	return e.err.Error()
+}
+
+func (e *importWriteError) Unwrap() error {
+	return e.err
+}
+
+// Import creates or updates products from the records of decoder and reports
+// the outcome of every record. Valid records are written in batches, so a
+// failed record never stops the others. When the upload cannot be read or a
+// batch cannot be written, Import stops and returns the report of the batches
+// written so far with the error. ctx names the caller, see audit.WithActor.
+func (i *ImportHandler) Import(ctx context.Context, decoder imports.Decoder, mode string, dryRun bool) (*ImportReport, error) {
+	report := &ImportReport{Mode: mode, DryRun: dryRun, Rows: []ImportRowResult{}}
+	defer report.sort()
+
+	//names already in the upload, so a product is never imported twice
+	seen := map[string]int{}
+	var batch []importRow
+	for {
+		var record ProductImportRecord
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var rowErr *imports.RowError
+		if errors.As(err, &rowErr) {
+			report.add(ImportRowResult{Line: rowErr.Line, Status: ImportFailed, Errors: map[string]string{"row": rowErr.Err.Error()}})
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		line := decoder.Line()
+		product := record.ProductCreateReq
+		if err := binding.Validator.ValidateStruct(&product); err != nil {
+			result := ImportRowResult{Line: line, Name: product.Name, Status: ImportFailed, Errors: map[string]string{"row": err.Error()}}
+			if validationErrors, ok := err.(validator.ValidationErrors); ok {
+				result.Errors = formatValidationError(validationErrors)
+			}
+			report.add(result)
+			continue
+		}
+		if first, ok := seen[product.Name]; ok {
+			report.add(ImportRowResult{Line: line, Name: product.Name, Status: ImportFailed, Errors: map[string]string{"Name": fmt.Sprintf("Name repeats line %d", first)}})
+			continue
+		}
+		seen[product.Name] = line
+
+		batch = append(batch, importRow{line: line, product: product})
+		if len(batch) == i.BatchSize {
+			if err := i.importBatch(ctx, report, batch, mode, dryRun); err != nil {
+				return report, &importWriteError{err: err}
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := i.importBatch(ctx, report, batch, mode, dryRun); err != nil {
+		return report, &importWriteError{err: err}
+	}
+
+	if !dryRun {
+		metrics.ProductsCreated.Add(float64(report.Summary.Created))
+	}
+	return report, nil
+}
+
+// upload returns the uploaded file and its format. Multipart forms are read
+// part by part, so the file is never buffered.
+func (i *ImportHandler) upload(ctx *gin.Context) (io.Reader, string, error) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, i.MaxBytes)
+	format := ctx.Query("format")
+
+	contentType, _, _ := mime.ParseMediaType(ctx.GetHeader("Content-Type"))
+	if contentType != "multipart/form-data" {
+		if format == "" {
+			format = importFormat(contentType, "")
+		}
+		return ctx.Request.Body, format, checkImportFormat(format)
+	}
+
+	reader, err := ctx.Request.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, "", errors.New("multipart form has no file field")
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		if format == "" {
+			partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			format = importFormat(partType, part.FileName())
+		}
+		return part, format, checkImportFormat(format)
+	}
+}
+
+// importFormat detects the format of an upload from its content type, or the
+// extension of its file name.
+func importFormat(contentType, fileName string) string {
+	switch contentType {
+	case "text/csv", "application/csv":
+		return imports.FormatCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return imports.FormatNDJSON
+	}
+	return imports.FormatOf(fileName)
+}
+
+func checkImportFormat(format string) error {
+	if format != imports.FormatCSV && format != imports.FormatNDJSON {
+		return errUnsupportedImportFormat
+	}
+	return nil
+}
+
+// importBatch writes a batch of valid rows in one transaction and adds their
+// outcome to the report. Dry runs only look up existing products. Low stock
+// alerts for upserted rows are sent once the batch is committed.
+func (i *ImportHandler) importBatch(ctx context.Context, report *ImportReport, batch []importRow, mode string, dryRun bool) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	var results []ImportRowResult
+	var adjustments []stockAdjustment
+	err := i.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		results = make([]ImportRowResult, 0, len(batch))
+		adjustments = nil
+
+		names := make([]string, len(batch))
+		for n, row := range batch {
+			names[n] = row.product.Name
+		}
+		query := tx.Where("name IN ?", names)
+		if !dryRun {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		var existing []models.Product
+		if err := query.Find(&existing).Error; err != nil {
+			return err
+		}
+		byName := make(map[string]models.Product, len(existing))
+		for _, product := range existing {
+			byName[product.Name] = product
+		}
+
+		var created []models.Product
+		var createdLines []int
+		for _, row := range batch {
+			product, found := byName[row.product.Name]
+			if !found {
+				created = append(created, models.Product{
+					Name:            row.product.Name,
+					Description:     row.product.Description,
+					Price:           row.product.Price,
+					StockLevel:      row.product.StockLevel,
+					ReorderPoint:    row.product.ReorderPoint,
+					ReorderQuantity: row.product.ReorderQuantity,
+				})
+				createdLines = append(createdLines, row.line)
+				continue
+			}
+
+			result := ImportRowResult{Line: row.line, Name: product.Name, Id: product.ID}
+			switch {
+			case mode == ImportInsert:
+				result.Status = ImportFailed
+				result.Errors = map[string]string{"Name": "Product already exists"}
+			case product.Description == row.product.Description && product.Price == row.product.Price &&
+				product.StockLevel == row.product.StockLevel && product.ReorderPoint == row.product.ReorderPoint &&
+				product.ReorderQuantity == row.product.ReorderQuantity:
+				result.Status = ImportUnchanged
+			default:
+				result.Status = ImportUpdated
+				if !dryRun {
+					updated, previousStock, err := importUpdate(ctx, tx, product, row.product)
+					if err != nil {
+						return err
+					}
+					adjustments = append(adjustments, stockAdjustment{product: updated, previousStock: previousStock})
+				}
+			}
+			results = append(results, result)
+		}
+
+		if len(created) > 0 && !dryRun {
+			//insert the new products of the batch together
+			if err := tx.Create(&created).Error; err != nil {
+				return err
+			}
+			for _, product := range created {
+				if err := audit.Record(tx, auditEntry(ctx, audit.ActionCreate, audit.EntityProduct, product.ID, nil, toProductData(product))); err != nil {
+					return err
+				}
+				if err := events.Enqueue(tx, events.ProductCreated, product.ID, events.NewProduct(product)); err != nil {
+					return err
+				}
+			}
+		}
+		for n, product := range created {
+			results = append(results, ImportRowResult{Line: createdLines[n], Name: product.Name, Status: ImportCreated, Id: product.ID})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	report.add(results...)
+	for _, adjustment := range adjustments {
+		i.notifyLowStock(ctx, adjustment.product, adjustment.previousStock)
+	}
+	return nil
+}
+
+// importUpdate overwrites an existing product with an upserted row and
+// returns the product with its stock before the update.
+func importUpdate(ctx context.Context, tx *gorm.DB, product models.Product, row ProductCreateReq) (models.Product, int, error) {
+	before := toProductData(product)
+	previousStock := product.StockLevel
+
+	product.Description = row.Description
+	product.Price = row.Price
+	product.StockLevel = row.StockLevel
+	product.ReorderPoint = row.ReorderPoint
+	product.ReorderQuantity = row.ReorderQuantity
+	if err := tx.Save(&product).Error; err != nil {
+		return product, previousStock, err
+	}
+
+	if err := audit.Record(tx, auditEntry(ctx, audit.ActionUpdate, audit.EntityProduct, product.ID, before, toProductData(product))); err != nil {
+		return product, previousStock, err
+	}
+	if err := events.Enqueue(tx, events.ProductUpdated, product.ID, events.NewProduct(product)); err != nil {
+		return product, previousStock, err
+	}
+	if product.StockLevel == previousStock {
+		return product, previousStock, nil
+	}
+	return product, previousStock, events.Enqueue(tx, events.StockChanged, product.ID, events.StockChange{
+		ProductID:     product.ID,
+		PreviousStock: previousStock,
+		Stock:         product.StockLevel,
+		Reason:        events.ReasonImport,
+	})
+}
+
+// abortImport ends an import whose upload cannot be read any further. Batches
+// written before the failure stay written and are listed in the report.
+func abortImport(ctx *gin.Context, err error, report *ImportReport) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"status": "PAYLOAD_TOO_LARGE", "message": fmt.Sprintf("Upload is larger than %d bytes", maxBytesErr.Limit), "data": report})
+		return
+	}
+	ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error(), "data": report})
+}
+
+// abortImportBatch ends an import whose batch could not be written. Earlier
+// batches stay written and are listed in the report.
+func abortImportBatch(ctx *gin.Context, err error, report *ImportReport) {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"status": "DUPLICATE_ENTITY", "error": "Duplicate conflict while importing products!", "data": report})
+		return
+	}
+	ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "data": report})
+}
@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/events"
+	"github.com/AllanM007/simpler-test/helpers"
+	"github.com/AllanM007/simpler-test/metrics"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/notifications"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrProductInactive   = errors.New("product is inactive")
+	ErrInsufficientStock = errors.New("stock level lower than sale quantity")
+	ErrDuplicateProduct  = errors.New("a product with the same name already exists")
+	ErrStockBelowZero    = errors.New("stock adjustment takes stock below zero")
+)
+
+// ValidationError lists the invalid fields of a request and why they are
+// invalid.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, message := range e.Fields {
+		messages = append(messages, message)
+	}
+	sort.Strings(messages)
+	return "invalid request: " + strings.Join(messages, "; ")
+}
+
+// ProductService holds the product logic shared by the REST handlers, the
+// gRPC API and the admin commands. The contexts it is called with name the
+// caller for audit entries, see audit.WithActor. Products that are not found
+// return gorm.ErrRecordNotFound.
+type ProductService struct {
+	DB       *gorm.DB
+	Notifier notifications.Notifier
+}
+
+func NewProductService(db *gorm.DB, notifier notifications.Notifier) *ProductService {
+	return &ProductService{
+		DB:       db,
+		Notifier: notifier,
+	}
+}
+
+// ProductFilter selects the products a caller may list. The zero value lists
+// every active product.
+type ProductFilter struct {
+	// IncludeInactive lists inactive products, which only admins may see.
+	IncludeInactive bool
+	// IncludeDeleted lists soft-deleted products too.
+	IncludeDeleted bool
+	// Search keeps products whose name contains it, ignoring case.
+	Search string
+	// LowStock keeps products at or below their reorder point.
+	LowStock bool
+	// MinPrice and MaxPrice bound the price of listed products when set.
+	MinPrice *float64
+	MaxPrice *float64
+}
+
+// Query returns the products matching filter.
+func (s *ProductService) Query(ctx context.Context, filter ProductFilter) *gorm.DB {
+	query := s.DB.WithContext(ctx)
+	if filter.IncludeDeleted {
+		query = query.Unscoped()
+	}
+	if !filter.IncludeInactive {
+		query = query.Where("active = ?", true)
+	}
+	if filter.Search != "" {
+		query = query.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(filter.Search)+"%")
+	}
+	if filter.LowStock {
+		query = query.Where("reorder_point > 0 AND stock_level <= reorder_point")
+	}
+	if filter.MinPrice != nil {
+		query = query.Where("price >= ?", *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		query = query.Where("price <= ?", *filter.MaxPrice)
+	}
+	return query
+}
+
+// List returns a page of the products matching filter, newest first, and how
+// many match in all.
+func (s *ProductService) List(ctx context.Context, filter ProductFilter, page, limit int) ([]models.Product, int64, error) {
+	//share the filters between the page and count queries
+	query := s.Query(ctx, filter).Session(&gorm.Session{})
+
+	var products []models.Product
+	if err := query.Limit(limit).Offset(helpers.GetOffset(page, limit)).Order("id DESC").Find(&products).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var count int64
+	if err := query.Model(&models.Product{}).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	return products, count, nil
+}
+
+func (s *ProductService) Get(ctx context.Context, productId string) (models.Product, error) {
+	var product models.Product
+	err := s.DB.WithContext(ctx).Where("id = ?", productId).First(&product).Error
+	return product, err
+}
+
+func (s *ProductService) Create(ctx context.Context, req ProductCreateReq) (models.Product, error) {
+	var product models.Product
+	if err := validateRequest(&req); err != nil {
+		return product, err
+	}
+
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		product, err = createProduct(ctx, tx, req)
+		return err
+	})
+	if err != nil {
+		return product, err
+	}
+
+	metrics.ProductsCreated.Inc()
+	return product, nil
+}
+
+func (s *ProductService) Update(ctx context.Context, productId string, req ProductUpdateReq) (models.Product, error) {
+	var product models.Product
+	if err := validateRequest(&req); err != nil {
+		return product, err
+	}
+
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		product, err = updateProduct(ctx, tx, productId, req)
+		return err
+	})
+	return product, err
+}
+
+func (s *ProductService) Delete(ctx context.Context, productId string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return deleteProduct(ctx, tx, productId)
+	})
+}
+
+// Sell deducts count from the stock of an active product and returns the
+// product after the sale.
+func (s *ProductService) Sell(ctx context.Context, productId string, count int) (models.Product, error) {
+	var product models.Product
+	if count < 1 {
+		return product, &ValidationError{Fields: map[string]string{"Count": "Count value is too low"}}
+	}
+
+	var previousStock int
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockProduct(tx, productId, &product); err != nil {
+			return err
+		}
+
+		//inactive products cannot be sold
+		if !product.Active {
+			return ErrProductInactive
+		}
+
+		//check if product stock is less than sale quantity
+		if count > product.StockLevel {
+			return ErrInsufficientStock
+		}
+
+		// dedcut sale quantity from product stock
+		before := toProductData(product)
+		previousStock = product.StockLevel
+		product.StockLevel = product.StockLevel - count
+
+		if err := tx.Save(&product).Error; err != nil {
+			return err
+		}
+		if err := audit.Record(tx, auditEntry(ctx, audit.ActionSale, audit.EntityProduct, product.ID, before, toProductData(product))); err != nil {
+			return err
+		}
+		if err := events.Enqueue(tx, events.StockChanged, product.ID, events.StockChange{
+			ProductID:     product.ID,
+			PreviousStock: previousStock,
+			Stock:         product.StockLevel,
+			Reason:        events.ReasonSale,
+		}); err != nil {
+			return err
+		}
+		return events.Enqueue(tx, events.SaleCompleted, product.ID, events.Sale{
+			ProductID: product.ID,
+			Quantity:  count,
+			UnitPrice: product.Price,
+			Stock:     product.StockLevel,
+		})
+	})
+	switch {
+	case errors.Is(err, ErrProductInactive):
+		metrics.SaleRejections.WithLabelValues(metrics.RejectedInactive).Inc()
+	case errors.Is(err, ErrInsufficientStock):
+		metrics.SaleRejections.WithLabelValues(metrics.RejectedInsufficientStock).Inc()
+	}
+	if err != nil {
+		return product, err
+	}
+
+	metrics.UnitsSold.Add(float64(count))
+	s.notifyLowStock(ctx, product, previousStock)
+	return product, nil
+}
+
+// AdjustStock adds delta, which may be negative, to the stock of a product and
+// returns the product after the adjustment. Stock never goes below zero.
+func (s *ProductService) AdjustStock(ctx context.Context, productId string, delta int) (models.Product, error) {
+	var product models.Product
+	var previousStock int
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		product, previousStock, err = adjustStock(ctx, tx, productId, delta)
+		return err
+	})
+	if err != nil {
+		return product, err
+	}
+
+	s.notifyLowStock(ctx, product, previousStock)
+	return product, nil
+}
+
+// createProduct inserts a product with its audit entry and event using tx.
+func createProduct(ctx context.Context, tx *gorm.DB, req ProductCreateReq) (models.Product, error) {
+	product := models.Product{
+		Name:            req.Name,
+		Description:     req.Description,
+		Price:           req.Price,
+		StockLevel:      req.StockLevel,
+		ReorderPoint:    req.ReorderPoint,
+		ReorderQuantity: req.ReorderQuantity,
+	}
+	if err := tx.Create(&product).Error; err != nil {
+		return product, duplicateProductError(err)
+	}
+	if err := audit.Record(tx, auditEntry(ctx, audit.ActionCreate, audit.EntityProduct, product.ID, nil, toProductData(product))); err != nil {
+		return product, err
+	}
+	return product, events.Enqueue(tx, events.ProductCreated, product.ID, events.NewProduct(product))
+}
+
+// updateProduct applies an update to a product with its audit entry and event
+// using tx.
+func updateProduct(ctx context.Context, tx *gorm.DB, productId string, req ProductUpdateReq) (models.Product, error) {
+	//get product by id
+	var product models.Product
+	if err := lockProduct(tx, productId, &product); err != nil {
+		return product, err
+	}
+	before := toProductData(product)
+
+	if req.Name != nil {
+		product.Name = *req.Name
+	}
+	if req.Description != nil {
+		product.Description = *req.Description
+	}
+	if req.Price != nil {
+		product.Price = *req.Price
+	}
+	if req.ReorderPoint != nil {
+		product.ReorderPoint = *req.ReorderPoint
+	}
+	if req.ReorderQuantity != nil {
+		product.ReorderQuantity = *req.ReorderQuantity
+	}
+
+	//update existing products
+	if err := tx.Save(&product).Error; err != nil {
+		return product, duplicateProductError(err)
+	}
+	if err := audit.Record(tx, auditEntry(ctx, audit.ActionUpdate, audit.EntityProduct, product.ID, before, toProductData(product))); err != nil {
+		return product, err
+	}
+	return product, events.Enqueue(tx, events.ProductUpdated, product.ID, events.NewProduct(product))
+}
+
+// deleteProduct soft-deletes a product with its audit entry and event using
+// tx.
+func deleteProduct(ctx context.Context, tx *gorm.DB, productId string) error {
+	var product models.Product
+	if err := lockProduct(tx, productId, &product); err != nil {
+		return err
+	}
+	if err := tx.Delete(&product).Error; err != nil {
+		return err
+	}
+	if err := audit.Record(tx, auditEntry(ctx, audit.ActionDelete, audit.EntityProduct, product.ID, toProductData(product), nil)); err != nil {
+		return err
+	}
+	return events.Enqueue(tx, events.ProductDeleted, product.ID, events.NewProduct(product))
+}
+
+// validateRequest checks req against its binding rules.
+func validateRequest(req interface{}) error {
+	err := binding.Validator.ValidateStruct(req)
+	if validationErrors, ok := err.(validator.ValidationErrors); ok {
+		return &ValidationError{Fields: formatValidationError(validationErrors)}
+	}
+	return err
+}
+
+// duplicateProductError marks a write that broke the unique product name with
+// ErrDuplicateProduct.
+func duplicateProductError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return fmt.Errorf("%w: %v", ErrDuplicateProduct, err)
+	}
+	return err
+}
+
+// notifyLowStock emits a low stock alert when a stock change takes the product
+// across its reorder point. Notifier failures are logged and never fail the
+// request that changed the stock.
+func (s *ProductService) notifyLowStock(ctx context.Context, product models.Product, previousStock int) {
+	if s.Notifier == nil || !notifications.CrossedReorderPoint(previousStock, product.StockLevel, product.ReorderPoint) {
+		return
+	}
+
+	alert := notifications.LowStockAlert{
+		Event:           notifications.LowStockEvent,
+		ProductID:       product.ID,
+		Name:            product.Name,
+		PreviousStock:   previousStock,
+		Stock:           product.StockLevel,
+		ReorderPoint:    product.ReorderPoint,
+		ReorderQuantity: product.ReorderQuantity,
+		Timestamp:       time.Now(),
+	}
+	if err := s.Notifier.Notify(ctx, alert); err != nil {
+		slog.WarnContext(ctx, "failed to send low stock alert", "product_id", product.ID, "error", err)
+	}
+}
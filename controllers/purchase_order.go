@@ -0,0 +1,361 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/events"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PurchaseOrderHandler struct {
+	DB *gorm.DB
+}
+
+func PurchaseOrdersRepository(db *gorm.DB) *PurchaseOrderHandler {
+	return &PurchaseOrderHandler{
+		DB: db,
+	}
+}
+
+type PurchaseOrderLineReq struct {
+	ProductId uint    `json:"product_id"  binding:"required"`
+	Quantity  int     `json:"quantity"    binding:"required,gt=0"`
+	UnitCost  float64 `json:"unit_cost"   binding:"gte=0"`
+}
+
+type PurchaseOrderCreateReq struct {
+	SupplierId uint                   `json:"supplier_id"  binding:"required"`
+	Lines      []PurchaseOrderLineReq `json:"lines"        binding:"required,min=1,dive"`
+}
+
+type PurchaseOrderReceiptLineReq struct {
+	LineId   uint `json:"line_id"   binding:"required"`
+	Quantity int  `json:"quantity"  binding:"required,gt=0"`
+}
+
+type PurchaseOrderReceiptReq struct {
+	Lines []PurchaseOrderReceiptLineReq `json:"lines"  binding:"required,min=1,dive"`
+}
+
+type PurchaseOrderLineData struct {
+	Id               uint    `json:"id"`
+	ProductId        uint    `json:"product_id"`
+	Quantity         int     `json:"quantity"`
+	ReceivedQuantity int     `json:"received_quantity"`
+	Outstanding      int     `json:"outstanding"`
+	UnitCost         float64 `json:"unit_cost"`
+}
+
+type PurchaseOrderData struct {
+	Id         uint                    `json:"id"`
+	SupplierId uint                    `json:"supplier_id"`
+	Status     string                  `json:"status"`
+	Lines      []PurchaseOrderLineData `json:"lines"`
+	ApprovedAt *time.Time              `json:"approved_at"`
+	ReceivedAt *time.Time              `json:"received_at"`
+	CreatedAt  time.Time               `json:"created_at"`
+	UpdatedAt  time.Time               `json:"updated_at"`
+}
+
+var (
+	errPurchaseOrderNotFound = errors.New("purchase order not found")
+	errInvalidOrderState     = errors.New("purchase order is not in a valid state for this action")
+)
+
+// CreatePurchaseOrder godoc
+// @Summary Create a purchase order
+// @Tags purchase-orders
+// @Description create a draft purchase order for a supplier
+// @Accept  json
+// @Produce json
+// @Param params body PurchaseOrderCreateReq true "Request's body"
+// @Success 201 {object} PurchaseOrderData
+// @Failure 400 {object} InvalidRequestResponse
+// @Failure 404 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/purchase-orders [post]
+func (po *PurchaseOrderHandler) CreatePurchaseOrder(ctx *gin.Context) {
+
+	var orderReq PurchaseOrderCreateReq
+	if err := ctx.ShouldBindJSON(&orderReq); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := formatValidationError(validationErrors)
+			ctx.JSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "errors": errors})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+
+	var supplier models.Supplier
+	if err := po.DB.WithContext(ctx.Request.Context()).Where("id = ?", orderReq.SupplierId).First(&supplier).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Supplier not found!!"})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	order := models.PurchaseOrder{
+		SupplierID: supplier.ID,
+		Status:     models.PurchaseOrderDraft,
+	}
+	for _, line := range orderReq.Lines {
+		var count int64
+		if err := po.DB.WithContext(ctx.Request.Context()).Model(&models.Product{}).Where("id = ?", line.ProductId).Count(&count).Error; err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if count == 0 {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": fmt.Sprintf("Product %d not found!!", line.ProductId)})
+			return
+		}
+
+		order.Lines = append(order.Lines, models.PurchaseOrderLine{
+			ProductID: line.ProductId,
+			Quantity:  line.Quantity,
+			UnitCost:  line.UnitCost,
+		})
+	}
+
+	//insert purchase order together with its lines
+	err := po.DB.WithContext(ctx.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Lines.Product").Create(&order).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditEntry(ctx.Request.Context(), audit.ActionCreate, audit.EntityPurchaseOrder, order.ID, nil, toPurchaseOrderData(order)))
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Header("Location", fmt.Sprintf("/api/v1/purchase-orders/%d", order.ID))
+	ctx.JSON(http.StatusCreated, gin.H{"status": "OK", "data": toPurchaseOrderData(order)})
+}
+
+// GetPurchaseOrderById godoc
+// @Summary Get purchase order
+// @Description get purchase order by id
+// @Tags purchase-orders
+// @Param id path int true "Purchase Order Id"
+// @Accept  json
+// @Produce json
+// @Success 200 {object} PurchaseOrderData
+// @Failure 404 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/purchase-orders/{id} [get]
+func (po *PurchaseOrderHandler) GetPurchaseOrderById(ctx *gin.Context) {
+	orderId := ctx.Param("id")
+
+	var order models.PurchaseOrder
+	result := po.DB.WithContext(ctx.Request.Context()).Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Where("id = ?", orderId).First(&order)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Purchase order not found!!"})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": toPurchaseOrderData(order)})
+}
+
+// ApprovePurchaseOrder godoc
+// @Summary Approve purchase order
+// @Description approve a draft purchase order so it can be received
+// @Tags purchase-orders
+// @Param id path int true "Purchase Order Id"
+// @Produce json
+// @Success 200 {object} PurchaseOrderData
+// @Failure 404 {object} Response
+// @Failure 409 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/purchase-orders/{id}/approve [put]
+func (po *PurchaseOrderHandler) ApprovePurchaseOrder(ctx *gin.Context) {
+	orderId := ctx.Param("id")
+
+	var order models.PurchaseOrder
+	err := po.DB.WithContext(ctx.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := lockPurchaseOrder(tx, orderId, &order); err != nil {
+			return err
+		}
+		if order.Status != models.PurchaseOrderDraft {
+			return errInvalidOrderState
+		}
+		before := toPurchaseOrderData(order)
+
+		now := time.Now()
+		order.Status = models.PurchaseOrderApproved
+		order.ApprovedAt = &now
+		if err := tx.Omit(clause.Associations).Save(&order).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditEntry(ctx.Request.Context(), audit.ActionApprove, audit.EntityPurchaseOrder, order.ID, before, toPurchaseOrderData(order)))
+	})
+	if err != nil {
+		abortPurchaseOrderError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": toPurchaseOrderData(order)})
+}
+
+// ReceivePurchaseOrder godoc
+// @Summary Receive purchase order lines
+// @Description record a full or partial receipt of purchase order lines and increase product stock
+// @Tags purchase-orders
+// @Param id path int true "Purchase Order Id"
+// @Accept  json
+// @Produce json
+// @Param params body PurchaseOrderReceiptReq true "Request's body"
+// @Success 200 {object} PurchaseOrderData
+// @Failure 400 {object} InvalidRequestResponse
+// @Failure 404 {object} Response
+// @Failure 409 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/purchase-orders/{id}/receive [put]
+func (po *PurchaseOrderHandler) ReceivePurchaseOrder(ctx *gin.Context) {
+	orderId := ctx.Param("id")
+
+	var receiptReq PurchaseOrderReceiptReq
+	if err := ctx.ShouldBindJSON(&receiptReq); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := formatValidationError(validationErrors)
+			ctx.JSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "errors": errors})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+
+	var order models.PurchaseOrder
+	err := po.DB.WithContext(ctx.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := lockPurchaseOrder(tx, orderId, &order); err != nil {
+			return err
+		}
+		if order.Status != models.PurchaseOrderApproved && order.Status != models.PurchaseOrderPartiallyReceived {
+			return errInvalidOrderState
+		}
+		before := toPurchaseOrderData(order)
+
+		lines := make(map[uint]*models.PurchaseOrderLine, len(order.Lines))
+		for i := range order.Lines {
+			lines[order.Lines[i].ID] = &order.Lines[i]
+		}
+
+		for _, receipt := range receiptReq.Lines {
+			line, ok := lines[receipt.LineId]
+			if !ok {
+				return receiptError{message: fmt.Sprintf("Line %d does not belong to this purchase order", receipt.LineId)}
+			}
+			if receipt.Quantity > line.Outstanding() {
+				return receiptError{message: fmt.Sprintf("Line %d only has %d units outstanding", line.ID, line.Outstanding())}
+			}
+
+			//a deleted product cannot take the units, restore it before receiving the line
+			var product models.Product
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", line.ProductID).Limit(1).Find(&product).Error; err != nil {
+				return err
+			}
+			if product.ID == 0 {
+				return receiptError{message: fmt.Sprintf("Line %d is for product %d which has been deleted", line.ID, line.ProductID), conflict: true}
+			}
+
+			line.ReceivedQuantity += receipt.Quantity
+			if err := tx.Model(line).Update("received_quantity", line.ReceivedQuantity).Error; err != nil {
+				return err
+			}
+
+			//increase product stock by the received quantity
+			previousStock := product.StockLevel
+			product.StockLevel += receipt.Quantity
+			if err := tx.Model(&product).Update("stock_level", product.StockLevel).Error; err != nil {
+				return err
+			}
+			if err := events.Enqueue(tx, events.StockChanged, product.ID, events.StockChange{
+				ProductID:     product.ID,
+				PreviousStock: previousStock,
+				Stock:         product.StockLevel,
+				Reason:        events.ReasonPurchaseOrderReceipt,
+			}); err != nil {
+				return err
+			}
+		}
+
+		order.Status = models.PurchaseOrderReceived
+		for _, line := range order.Lines {
+			if line.Outstanding() > 0 {
+				order.Status = models.PurchaseOrderPartiallyReceived
+				break
+			}
+		}
+		if order.Status == models.PurchaseOrderReceived {
+			now := time.Now()
+			order.ReceivedAt = &now
+		}
+
+		if err := tx.Omit(clause.Associations).Save(&order).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditEntry(ctx.Request.Context(), audit.ActionReceive, audit.EntityPurchaseOrder, order.ID, before, toPurchaseOrderData(order)))
+	})
+	if err != nil {
+		abortPurchaseOrderError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": toPurchaseOrderData(order)})
+}
+
+// receiptError describes a receipt line that cannot be applied to the order.
+// conflict marks a line that is valid but clashes with the product's state.
+type receiptError struct {
+	message  string
+	conflict bool
+}
+
+func (e receiptError) Error() string {
+	return e.message
+}
+
+// lockPurchaseOrder loads the purchase order and its lines, locking the order
+// row for the rest of the transaction.
+func lockPurchaseOrder(tx *gorm.DB, orderId string, order *models.PurchaseOrder) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", orderId).First(order).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errPurchaseOrderNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return tx.Where("purchase_order_id = ?", order.ID).Order("id ASC").Find(&order.Lines).Error
+}
+
+func abortPurchaseOrderError(ctx *gin.Context, err error) {
+	var lineErr receiptError
+	switch {
+	case errors.Is(err, errPurchaseOrderNotFound):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Purchase order not found!!"})
+	case errors.Is(err, errInvalidOrderState):
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"status": "INVALID_STATE", "message": err.Error()})
+	case errors.As(err, &lineErr) && lineErr.conflict:
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"status": "INVALID_STATE", "message": lineErr.Error()})
+	case errors.As(err, &lineErr):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": lineErr.Error()})
+	default:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AllanM007/simpler-test/stream"
+	"github.com/gin-gonic/gin"
+)
+
+// streamRetry is the reconnection delay suggested to stream clients.
+const streamRetry = 3 * time.Second
+
+type StreamHandler struct {
+	Broker    *stream.Broker
+	Heartbeat time.Duration
+}
+
+func StreamRepository(broker *stream.Broker, heartbeat time.Duration) *StreamHandler {
+	return &StreamHandler{
+		Broker:    broker,
+		Heartbeat: heartbeat,
+	}
+}
+
+// GetStockStream godoc
+// @Summary Stock level stream
+// @Description stream stock changes as server-sent events named stock, for all products or the selected ones. Reconnecting clients send Last-Event-ID to receive the changes they missed; a reset event tells them those changes are no longer available and current stock should be reloaded. Idle connections get a heartbeat comment.
+// @Tags products
+// @Param product_ids   query  string false "Comma separated product ids, all products when empty"
+// @Param Last-Event-ID header string false "Id of the last event received"
+// @Param last_event_id query  string false "Id of the last event received, for clients that cannot set headers"
+// @Produce text/event-stream
+// @Success 200 {object} stream.StockUpdate
+// @Failure 400 {object} Response
+// @Failure 503 {object} Response
+// @Router /api/v1/stream/stock [get]
+func (s *StreamHandler) GetStockStream(ctx *gin.Context) {
+	productIds, err := parseProductIds(ctx.Query("product_ids"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+
+	lastEventId := ctx.GetHeader("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = ctx.Query("last_event_id")
+	}
+
+	subscriber, missed, complete := s.Broker.Subscribe(productIds, lastEventId)
+	if subscriber == nil {
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"status": "SERVICE_UNAVAILABLE", "message": "Service is shutting down"})
+		return
+	}
+	defer s.Broker.Unsubscribe(subscriber)
+
+	//streams stay open far longer than the server write timeout
+	http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{})
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	fmt.Fprintf(ctx.Writer, "retry: %d\n\n", streamRetry.Milliseconds())
+	if !complete {
+		fmt.Fprint(ctx.Writer, "event: reset\ndata: {}\n\n")
+	}
+	for _, message := range missed {
+		writeStockMessage(ctx.Writer, message)
+	}
+	ctx.Writer.Flush()
+
+	heartbeat := time.NewTicker(s.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case message, ok := <-subscriber.Messages:
+			//the broker dropped a lagging client or is shutting down
+			if !ok {
+				return
+			}
+			if err := writeStockMessage(ctx.Writer, message); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(ctx.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		ctx.Writer.Flush()
+	}
+}
+
+func writeStockMessage(w io.Writer, message stream.Message) error {
+	_, err := fmt.Fprintf(w, "id: %s\nevent: stock\ndata: %s\n\n", message.ID, message.Data)
+	return err
+}
+
+func parseProductIds(value string) ([]uint, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var ids []uint
+	for _, field := range strings.Split(value, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(field), 10, 64)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("product_ids must be comma separated product ids, got %q", field)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/helpers"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+type SupplierHandler struct {
+	DB *gorm.DB
+}
+
+func SuppliersRepository(db *gorm.DB) *SupplierHandler {
+	return &SupplierHandler{
+		DB: db,
+	}
+}
+
+type SupplierCreateReq struct {
+	Name  string `json:"name"   binding:"required"`
+	Email string `json:"email"  binding:"omitempty,email"`
+	Phone string `json:"phone"`
+}
+
+type SupplierData struct {
+	Id        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SuppliersPaginatedResponse struct {
+	Suppliers []SupplierData `json:"suppliers"`
+	Meta      RequestMeta    `json:"meta"`
+}
+
+// CreateSupplier godoc
+// @Summary Create a new supplier
+// @Tags suppliers
+// @Description create supplier
+// @Accept  json
+// @Produce json
+// @Param params body SupplierCreateReq true "Request's body"
+// @Success 201 {object} SupplierData
+// @Failure 400 {object} InvalidRequestResponse
+// @Failure 409 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/suppliers [post]
+func (s *SupplierHandler) CreateSupplier(ctx *gin.Context) {
+
+	var supplierReq SupplierCreateReq
+	if err := ctx.ShouldBindJSON(&supplierReq); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := formatValidationError(validationErrors)
+			ctx.JSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "errors": errors})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+
+	supplier := models.Supplier{
+		Name:  supplierReq.Name,
+		Email: supplierReq.Email,
+		Phone: supplierReq.Phone,
+	}
+
+	err := s.DB.WithContext(ctx.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&supplier).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditEntry(ctx.Request.Context(), audit.ActionCreate, audit.EntitySupplier, supplier.ID, nil, toSupplierData(supplier)))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"status": "DUPLICATE_ENTITY", "error": "Duplicate conflict while creating supplier!"})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"status": "OK", "data": toSupplierData(supplier)})
+}
+
+// GetSuppliers godoc
+// @Summary Get suppliers with paging
+// @Description get all suppliers
+// @Tags suppliers
+// @Param page       query string false "Number of page"            default(1)
+// @Param limit      query string false "Suppliers count in a page" default(10)
+// @Accept  json
+// @Produce json
+// @Success 200 {object} SuppliersPaginatedResponse
+// @Failure 400 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/suppliers [get]
+func (s *SupplierHandler) GetSuppliers(ctx *gin.Context) {
+	page, limit, err := helpers.GetPagingData(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+
+	var count int64
+	if err := s.DB.WithContext(ctx.Request.Context()).Model(&models.Supplier{}).Count(&count).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var suppliers []models.Supplier
+	result := s.DB.WithContext(ctx.Request.Context()).Limit(limit).Offset(helpers.GetOffset(page, limit)).Order("id DESC").Find(&suppliers)
+	if result.Error != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	response := SuppliersPaginatedResponse{
+		Suppliers: toSupplierList(suppliers),
+		Meta: RequestMeta{
+			CurrentPage: page,
+			Limit:       limit,
+			Total:       count,
+		},
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": response})
+}
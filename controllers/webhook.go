@@ -0,0 +1,466 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/events"
+	"github.com/AllanM007/simpler-test/helpers"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/webhooks"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookHandler struct {
+	DB *gorm.DB
+}
+
+func WebhooksRepository(db *gorm.DB) *WebhookHandler {
+	return &WebhookHandler{
+		DB: db,
+	}
+}
+
+type WebhookCreateReq struct {
+	URL        string   `json:"url"          binding:"required"`
+	EventTypes []string `json:"event_types"  binding:"required,min=1"`
+	Secret     string   `json:"secret"`
+}
+
+type WebhookUpdateReq struct {
+	URL        string   `json:"url"          binding:"required"`
+	EventTypes []string `json:"event_types"  binding:"required,min=1"`
+	Active     *bool    `json:"active"`
+}
+
+type WebhookData struct {
+	Id         uint      `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WebhookCreatedData is only returned on creation, the one time the signing
+// secret is shown.
+type WebhookCreatedData struct {
+	WebhookData
+	Secret string `json:"secret"`
+}
+
+type WebhooksPaginatedResponse struct {
+	Webhooks []WebhookData `json:"webhooks"`
+	Meta     RequestMeta   `json:"meta"`
+}
+
+type WebhookAttemptData struct {
+	StatusCode  int       `json:"status_code"`
+	Error       string    `json:"error"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+type WebhookDeliveryData struct {
+	Id            uint                 `json:"id"`
+	WebhookId     uint                 `json:"webhook_id"`
+	EventId       uint                 `json:"event_id"`
+	EventType     string               `json:"event_type"`
+	Status        string               `json:"status"`
+	Attempts      int                  `json:"attempts"`
+	NextAttemptAt *time.Time           `json:"next_attempt_at"`
+	LastError     string               `json:"last_error"`
+	DeliveredAt   *time.Time           `json:"delivered_at"`
+	CreatedAt     time.Time            `json:"created_at"`
+	AttemptLog    []WebhookAttemptData `json:"attempt_log"`
+}
+
+type WebhookDeliveriesPaginatedResponse struct {
+	Deliveries []WebhookDeliveryData `json:"deliveries"`
+	Meta       RequestMeta           `json:"meta"`
+}
+
+var errWebhookNotFound = errors.New("webhook not found")
+
+// CreateWebhook godoc
+// @Summary Create a webhook subscription
+// @Tags webhooks
+// @Description subscribe a URL to domain events. Deliveries are signed with the returned secret, which is generated when not given and never shown again.
+// @Accept  json
+// @Produce json
+// @Param params body WebhookCreateReq true "Request's body"
+// @Success 201 {object} WebhookCreatedData
+// @Failure 400 {object} InvalidRequestResponse
+// @Failure 401 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/webhooks [post]
+func (w *WebhookHandler) CreateWebhook(ctx *gin.Context) {
+
+	var webhookReq WebhookCreateReq
+	if err := ctx.ShouldBindJSON(&webhookReq); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := formatValidationError(validationErrors)
+			ctx.JSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "errors": errors})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+	if err := validateWebhook(webhookReq.URL, webhookReq.EventTypes); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+
+	secret := webhookReq.Secret
+	if secret == "" {
+		generated, err := webhooks.NewSecret()
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		secret = generated
+	}
+
+	subscription := models.WebhookSubscription{
+		URL:        webhookReq.URL,
+		EventTypes: webhookReq.EventTypes,
+		Secret:     secret,
+		Active:     true,
+	}
+
+	err := w.DB.WithContext(ctx.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&subscription).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditEntry(ctx.Request.Context(), audit.ActionCreate, audit.EntityWebhook, subscription.ID, nil, toWebhookData(subscription)))
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Header("Location", fmt.Sprintf("/api/v1/webhooks/%d", subscription.ID))
+	ctx.JSON(http.StatusCreated, gin.H{"status": "OK", "data": WebhookCreatedData{WebhookData: toWebhookData(subscription), Secret: subscription.Secret}})
+}
+
+// GetWebhooks godoc
+// @Summary Get webhook subscriptions with paging
+// @Description get all webhook subscriptions
+// @Tags webhooks
+// @Param page       query string false "Number of page"           default(1)
+// @Param limit      query string false "Webhooks count in a page" default(10)
+// @Produce json
+// @Success 200 {object} WebhooksPaginatedResponse
+// @Failure 400 {object} Response
+// @Failure 401 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/webhooks [get]
+func (w *WebhookHandler) GetWebhooks(ctx *gin.Context) {
+	page, limit, err := helpers.GetPagingData(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+
+	var count int64
+	if err := w.DB.WithContext(ctx.Request.Context()).Model(&models.WebhookSubscription{}).Count(&count).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var subscriptions []models.WebhookSubscription
+	result := w.DB.WithContext(ctx.Request.Context()).Limit(limit).Offset(helpers.GetOffset(page, limit)).Order("id DESC").Find(&subscriptions)
+	if result.Error != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	response := WebhooksPaginatedResponse{
+		Webhooks: toWebhookList(subscriptions),
+		Meta: RequestMeta{
+			CurrentPage: page,
+			Limit:       limit,
+			Total:       count,
+		},
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": response})
+}
+
+// GetWebhookById godoc
+// @Summary Get webhook subscription
+// @Description get webhook subscription by id
+// @Tags webhooks
+// @Param id path int true "Webhook Id"
+// @Produce json
+// @Success 200 {object} WebhookData
+// @Failure 401 {object} Response
+// @Failure 404 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/webhooks/{id} [get]
+func (w *WebhookHandler) GetWebhookById(ctx *gin.Context) {
+	var subscription models.WebhookSubscription
+	result := w.DB.WithContext(ctx.Request.Context()).Where("id = ?", ctx.Param("id")).First(&subscription)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Webhook not found!!"})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": toWebhookData(subscription)})
+}
+
+// UpdateWebhook godoc
+// @Summary Update webhook subscription
+// @Description replace the URL and event types of a webhook subscription, optionally pausing or resuming it. Deliveries of paused subscriptions wait until they are resumed.
+// @Tags webhooks
+// @Param id path int true "Webhook Id"
+// @Accept  json
+// @Produce json
+// @Param params body WebhookUpdateReq true "Request's body"
+// @Success 200 {object} WebhookData
+// @Failure 400 {object} InvalidRequestResponse
+// @Failure 401 {object} Response
+// @Failure 404 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/webhooks/{id} [put]
+func (w *WebhookHandler) UpdateWebhook(ctx *gin.Context) {
+
+	var webhookReq WebhookUpdateReq
+	if err := ctx.ShouldBindJSON(&webhookReq); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := formatValidationError(validationErrors)
+			ctx.JSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "errors": errors})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+	if err := validateWebhook(webhookReq.URL, webhookReq.EventTypes); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+
+	var subscription models.WebhookSubscription
+	err := w.DB.WithContext(ctx.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := lockWebhook(tx, ctx.Param("id"), &subscription); err != nil {
+			return err
+		}
+		before := toWebhookData(subscription)
+
+		subscription.URL = webhookReq.URL
+		subscription.EventTypes = webhookReq.EventTypes
+		if webhookReq.Active != nil {
+			subscription.Active = *webhookReq.Active
+		}
+		if err := tx.Save(&subscription).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditEntry(ctx.Request.Context(), audit.ActionUpdate, audit.EntityWebhook, subscription.ID, before, toWebhookData(subscription)))
+	})
+	if err != nil {
+		abortWebhookError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": toWebhookData(subscription)})
+}
+
+// DeleteWebhook godoc
+// @Summary Delete webhook subscription
+// @Description delete a webhook subscription together with its deliveries
+// @Tags webhooks
+// @Param id path int true "Webhook Id"
+// @Produce json
+// @Success 200 {object} Response
+// @Failure 401 {object} Response
+// @Failure 404 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/webhooks/{id} [delete]
+func (w *WebhookHandler) DeleteWebhook(ctx *gin.Context) {
+	err := w.DB.WithContext(ctx.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var subscription models.WebhookSubscription
+		if err := lockWebhook(tx, ctx.Param("id"), &subscription); err != nil {
+			return err
+		}
+
+		//remove the delivery log explicitly, the schema cascades but not every database enforces it
+		deliveries := tx.Model(&models.WebhookDelivery{}).Select("id").Where("subscription_id = ?", subscription.ID)
+		if err := tx.Where("delivery_id IN (?)", deliveries).Delete(&models.WebhookAttempt{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("subscription_id = ?", subscription.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&subscription).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditEntry(ctx.Request.Context(), audit.ActionDelete, audit.EntityWebhook, subscription.ID, toWebhookData(subscription), nil))
+	})
+	if err != nil {
+		abortWebhookError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "message": "Webhook deleted successfully!"})
+}
+
+// GetWebhookDeliveries godoc
+// @Summary Webhook delivery log
+// @Description get the deliveries of a webhook subscription, newest first, with every attempt made to send them
+// @Tags webhooks
+// @Param id     path  int    true  "Webhook Id"
+// @Param status query string false "Delivery status" Enums(PENDING, SUCCEEDED, DEAD)
+// @Param page   query string false "Number of page"             default(1)
+// @Param limit  query string false "Deliveries count in a page" default(10)
+// @Produce json
+// @Success 200 {object} WebhookDeliveriesPaginatedResponse
+// @Failure 400 {object} Response
+// @Failure 401 {object} Response
+// @Failure 404 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/webhooks/{id}/deliveries [get]
+func (w *WebhookHandler) GetWebhookDeliveries(ctx *gin.Context) {
+	page, limit, err := helpers.GetPagingData(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+
+	var subscription models.WebhookSubscription
+	if err := w.DB.WithContext(ctx.Request.Context()).Where("id = ?", ctx.Param("id")).First(&subscription).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = errWebhookNotFound
+		}
+		abortWebhookError(ctx, err)
+		return
+	}
+
+	query := w.DB.WithContext(ctx.Request.Context()).Model(&models.WebhookDelivery{}).Where("subscription_id = ?", subscription.ID)
+	if status, ok := ctx.GetQuery("status"); ok {
+		query = query.Where("status = ?", status)
+	}
+
+	var count int64
+	if err := query.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var deliveries []models.WebhookDelivery
+	result := query.Session(&gorm.Session{}).Preload("AttemptLog", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Limit(limit).Offset(helpers.GetOffset(page, limit)).Order("id DESC").Find(&deliveries)
+	if result.Error != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	response := WebhookDeliveriesPaginatedResponse{
+		Deliveries: toWebhookDeliveryList(deliveries),
+		Meta: RequestMeta{
+			CurrentPage: page,
+			Limit:       limit,
+			Total:       count,
+		},
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "data": response})
+}
+
+// RedeliverWebhook godoc
+// @Summary Redeliver webhook delivery
+// @Description send a delivery again, typically a dead-lettered one. It is queued with a fresh set of attempts and its delivery time and last error cleared; earlier attempts stay in the log.
+// @Tags webhooks
+// @Param id          path int true "Webhook Id"
+// @Param delivery_id path int true "Delivery Id"
+// @Produce json
+// @Success 200 {object} WebhookDeliveryData
+// @Failure 401 {object} Response
+// @Failure 404 {object} Response
+// @Failure 500 {object} InternalErrorResponse
+// @Router /api/v1/webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+func (w *WebhookHandler) RedeliverWebhook(ctx *gin.Context) {
+	var delivery models.WebhookDelivery
+	err := w.DB.WithContext(ctx.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND subscription_id = ?", ctx.Param("delivery_id"), ctx.Param("id")).
+			First(&delivery).Error
+		if err != nil {
+			return err
+		}
+		before := toWebhookDeliveryData(delivery)
+
+		//start over as a new delivery, keeping only the attempt log
+		delivery.Status = models.WebhookDeliveryPending
+		delivery.Attempts = 0
+		delivery.NextAttemptAt = time.Now()
+		delivery.LastError = ""
+		delivery.DeliveredAt = nil
+		if err := tx.Omit(clause.Associations).Save(&delivery).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditEntry(ctx.Request.Context(), audit.ActionRedeliver, audit.EntityWebhookDelivery, delivery.ID, before, toWebhookDeliveryData(delivery)))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Webhook delivery not found!!"})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "OK", "message": "Webhook delivery queued for redelivery!", "data": toWebhookDeliveryData(delivery)})
+}
+
+// validateWebhook checks that a subscription targets an absolute http(s) URL
+// and only known event types.
+func validateWebhook(rawURL string, eventTypes []string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL, got %q", rawURL)
+	}
+
+	for _, eventType := range eventTypes {
+		known := false
+		for _, t := range events.Types {
+			if t == eventType {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown event type %q, expected one of %v", eventType, events.Types)
+		}
+	}
+	return nil
+}
+
+// lockWebhook loads the subscription, locking its row for the rest of the
+// transaction.
+func lockWebhook(tx *gorm.DB, webhookId string, subscription *models.WebhookSubscription) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", webhookId).First(subscription).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errWebhookNotFound
+	}
+	return err
+}
+
+func abortWebhookError(ctx *gin.Context, err error) {
+	if errors.Is(err, errWebhookNotFound) {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND", "message": "Webhook not found!!"})
+		return
+	}
+	ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,114 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/AllanM007/simpler-test/models"
+	"gorm.io/gorm"
+)
+
+// Domain event types.
+const (
+	ProductCreated = "product.created"
+	ProductUpdated = "product.updated"
+	ProductDeleted = "product.deleted"
+	StockChanged   = "product.stock_changed"
+	SaleCompleted  = "product.sale_completed"
+)
+
+// Types lists every domain event type.
+var Types = []string{ProductCreated, ProductUpdated, ProductDeleted, StockChanged, SaleCompleted}
+
+// AggregateProduct is the aggregate type of every product event. Events are
+// published in order per aggregate.
+const AggregateProduct = "product"
+
+// Reasons carried by StockChanged events.
+const (
+	ReasonSale                 = "sale"
+	ReasonPurchaseOrderReceipt = "purchase_order_receipt"
+	ReasonImport               = "import"
+	ReasonAdjustment           = "adjustment"
+)
+
+// Event is a domain event as handed to publishers. ID increases with every
+// event and is stable across redeliveries, so consumers can use it to drop
+// duplicates.
+type Event struct {
+	ID            uint            `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   uint            `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+}
+
+// Product is the payload of ProductCreated, ProductUpdated and ProductDeleted
+// events, describing the product after the change.
+type Product struct {
+	ID              uint    `json:"id"`
+	Name            string  `json:"name"`
+	Description     string  `json:"description"`
+	Price           float64 `json:"price"`
+	Stock           int     `json:"stock"`
+	ReorderPoint    int     `json:"reorder_point"`
+	ReorderQuantity int     `json:"reorder_quantity"`
+	Active          bool    `json:"active"`
+}
+
+// StockChange is the payload of StockChanged events.
+type StockChange struct {
+	ProductID     uint   `json:"product_id"`
+	PreviousStock int    `json:"previous_stock"`
+	Stock         int    `json:"stock"`
+	Reason        string `json:"reason"`
+}
+
+// Sale is the payload of SaleCompleted events.
+type Sale struct {
+	ProductID uint    `json:"product_id"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	Stock     int     `json:"stock"`
+}
+
+func NewProduct(product models.Product) Product {
+	return Product{
+		ID:              product.ID,
+		Name:            product.Name,
+		Description:     product.Description,
+		Price:           product.Price,
+		Stock:           product.StockLevel,
+		ReorderPoint:    product.ReorderPoint,
+		ReorderQuantity: product.ReorderQuantity,
+		Active:          product.Active,
+	}
+}
+
+// Enqueue adds an event about a product to the outbox using tx, so that it is
+// only published if the change it describes is committed.
+func Enqueue(tx *gorm.DB, eventType string, productID uint, payload interface{}) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&models.OutboxEvent{
+		EventType:     eventType,
+		AggregateType: AggregateProduct,
+		AggregateID:   productID,
+		Payload:       string(encoded),
+	}).Error
+}
+
+func fromOutbox(row models.OutboxEvent) Event {
+	return Event{
+		ID:            row.ID,
+		Type:          row.EventType,
+		AggregateType: row.AggregateType,
+		AggregateID:   row.AggregateID,
+		Payload:       json.RawMessage(row.Payload),
+		OccurredAt:    row.CreatedAt,
+	}
+}
@@ -0,0 +1,160 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/models"
+	"gorm.io/gorm"
+)
+
+// gapTimeout is how long the follower waits for an event whose id was skipped
+// over, in case the transaction writing it has not committed yet. Ids left by
+// rolled back transactions are given up on after it.
+const gapTimeout = time.Minute
+
+// Listener is told about each event committed to the outbox, such as to push
+// it to connected clients. It must not block.
+type Listener interface {
+	Published(event Event)
+}
+
+// Follower tells its listeners about every event committed to the outbox,
+// whether or not the relay has published it, so they keep up with changes
+// while the publisher is failing. Every instance follows the whole outbox.
+// Events are passed on in the order they are found: an event whose
+// transaction commits after events with higher ids is passed on when it shows
+// up, as long as that is within gapTimeout.
+type Follower struct {
+	DB           *gorm.DB
+	Listeners    []Listener
+	BatchSize    int
+	PollInterval time.Duration
+
+	positioned bool
+	last       uint
+	gaps       map[uint]time.Time
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewFollower(db *gorm.DB, cfg config.Events, listeners ...Listener) *Follower {
+	return &Follower{
+		DB:           db,
+		Listeners:    listeners,
+		BatchSize:    cfg.BatchSize,
+		PollInterval: cfg.PollInterval,
+		gaps:         map[uint]time.Time{},
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// Start follows the outbox in the background every PollInterval until Close
+// is called.
+func (f *Follower) Start() {
+	go f.run()
+}
+
+// Close stops the follower and waits for the events being passed on to
+// listeners or for ctx to end, whichever comes first.
+func (f *Follower) Close(ctx context.Context) error {
+	f.once.Do(func() {
+		close(f.stop)
+	})
+
+	select {
+	case <-f.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *Follower) run() {
+	defer close(f.done)
+
+	ticker := time.NewTicker(f.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		//keep going while full batches are found, then wait for new events
+		for {
+			found, err := f.Follow(context.Background())
+			if err != nil {
+				slog.Error("failed to follow outbox events", "error", err)
+			}
+			if err != nil || found < f.BatchSize {
+				break
+			}
+			select {
+			case <-f.stop:
+				return
+			default:
+			}
+		}
+
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Follow passes up to BatchSize events committed since the last call on to
+// the listeners and returns how many it found. The first call only finds where
+// the outbox ends, so events committed before it are never passed on. Follow
+// must not be called concurrently.
+func (f *Follower) Follow(ctx context.Context) (int, error) {
+	db := f.DB.WithContext(ctx)
+	if !f.positioned {
+		if err := db.Model(&models.OutboxEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&f.last).Error; err != nil {
+			return 0, err
+		}
+		f.positioned = true
+		return 0, nil
+	}
+
+	//events after the last one found, and the skipped ids that may still turn up
+	query := db.Where("id > ?", f.last)
+	if len(f.gaps) > 0 {
+		skipped := make([]uint, 0, len(f.gaps))
+		for id := range f.gaps {
+			skipped = append(skipped, id)
+		}
+		query = query.Or("id IN ?", skipped)
+	}
+	var rows []models.OutboxEvent
+	if err := query.Order("id ASC").Limit(f.BatchSize).Find(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	for _, row := range rows {
+		if row.ID > f.last {
+			for id := f.last + 1; id < row.ID; id++ {
+				f.gaps[id] = now
+			}
+			f.last = row.ID
+		} else {
+			delete(f.gaps, row.ID)
+		}
+
+		event := fromOutbox(row)
+		for _, listener := range f.Listeners {
+			listener.Published(event)
+		}
+	}
+	for id, skipped := range f.gaps {
+		if now.Sub(skipped) > gapTimeout {
+			delete(f.gaps, id)
+		}
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,29 @@
+package events
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AllanM007/simpler-test/config"
+)
+
+// Publisher delivers events to downstream consumers. An event is only marked
+// published once Publish returns nil; on error it is offered again later, so
+// consumers may see the same event more than once.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// New builds the publisher selected in the configuration, defaulting to log.
+func New(cfg config.Events) (Publisher, error) {
+	switch cfg.Publisher {
+	case "", "log":
+		return NewLogPublisher(), nil
+	case "http":
+		return NewHTTPPublisher(cfg.URL), nil
+	case "file":
+		return NewFilePublisher(cfg.FilePath), nil
+	default:
+		return nil, fmt.Errorf("unknown event publisher %q", cfg.Publisher)
+	}
+}
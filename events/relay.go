@@ -0,0 +1,258 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/metrics"
+	"github.com/AllanM007/simpler-test/models"
+	"gorm.io/gorm"
+)
+
+// publishTimeout bounds the delivery of a single event.
+const publishTimeout = 10 * time.Second
+
+// claimLockKey identifies the postgres advisory lock held while a relay claims
+// events.
+const claimLockKey = 72_461_906
+
+// Queue records published events in the database for further processing,
+// such as webhook deliveries. Queues are given the transaction marking the
+// event published, so an event is queued exactly when it is marked published.
+type Queue interface {
+	Queue(tx *gorm.DB, event Event) error
+}
+
+// Relay publishes the events waiting in the outbox, oldest first, and hands
+// each published event to its queues. Delivery is at least once: an event is
+// marked published only after the publisher has accepted it. When an event
+// fails it is retried after RetryBackoff, doubled after every failure up to
+// MaxBackoff, and later events of the same aggregate wait for it, so each
+// product's events are delivered in order. Events are never given up on; once
+// an event has failed AlertAttempts times every further failure is logged as
+// an error.
+type Relay struct {
+	DB            *gorm.DB
+	Publisher     Publisher
+	Queues        []Queue
+	BatchSize     int
+	PollInterval  time.Duration
+	RetryBackoff  time.Duration
+	MaxBackoff    time.Duration
+	AlertAttempts int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func NewRelay(db *gorm.DB, publisher Publisher, cfg config.Events, queues ...Queue) *Relay {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Relay{
+		DB:            db,
+		Publisher:     publisher,
+		Queues:        queues,
+		BatchSize:     cfg.BatchSize,
+		PollInterval:  cfg.PollInterval,
+		RetryBackoff:  cfg.RetryBackoff,
+		MaxBackoff:    cfg.MaxBackoff,
+		AlertAttempts: cfg.AlertAttempts,
+		ctx:           ctx,
+		cancel:        cancel,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Start publishes pending events in the background every PollInterval until
+// Close is called.
+func (r *Relay) Start() {
+	go r.run()
+}
+
+// Close stops the relay and waits for the batch being published to finish or
+// for ctx to end, whichever comes first. When ctx ends first the batch is
+// abandoned, and its unpublished events stay in the outbox for the next run.
+func (r *Relay) Close(ctx context.Context) error {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	defer r.cancel()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Relay) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		//keep going while full batches are published, then wait for new events
+		for {
+			published, err := r.PublishPending(r.ctx)
+			if err != nil {
+				slog.Error("failed to relay outbox events", "error", err)
+			}
+			if err != nil || published < r.BatchSize {
+				break
+			}
+			select {
+			case <-r.stop:
+				return
+			default:
+			}
+		}
+
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublishPending publishes up to BatchSize due events and returns how many
+// were published. The events are claimed first, so no other relay takes them
+// or later events of their aggregates while they are being published, and the
+// outcome of each event is then recorded on its own. No transaction is held
+// open while the publisher is called.
+func (r *Relay) PublishPending(ctx context.Context) (int, error) {
+	claimed, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	//record outcomes even when ctx ends, the publisher has already been called
+	db := r.DB.WithContext(context.WithoutCancel(ctx))
+	published := 0
+	blocked := map[string]bool{}
+	var released []uint
+	for _, row := range claimed {
+		aggregate := fmt.Sprintf("%s:%d", row.AggregateType, row.AggregateID)
+		if blocked[aggregate] || ctx.Err() != nil {
+			released = append(released, row.ID)
+			continue
+		}
+
+		event := fromOutbox(row)
+		if err := r.publish(ctx, event); err != nil {
+			if ctx.Err() != nil {
+				released = append(released, row.ID)
+				continue
+			}
+			//hold back the rest of this aggregate's events until this one succeeds
+			blocked[aggregate] = true
+			if err := r.fail(ctx, db, row, err); err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, queue := range r.Queues {
+				if err := queue.Queue(tx, event); err != nil {
+					return err
+				}
+			}
+			return tx.Model(&row).Update("published_at", time.Now()).Error
+		})
+		if err != nil {
+			return published, err
+		}
+		published++
+	}
+
+	//events skipped behind a failure or by shutdown are taken again by the next check
+	if len(released) > 0 {
+		if err := db.Model(&models.OutboxEvent{}).Where("id IN ?", released).Update("next_attempt_at", nil).Error; err != nil {
+			return published, err
+		}
+	}
+	return published, nil
+}
+
+// claim takes up to BatchSize due events, oldest first, leaving out events
+// whose aggregate has an earlier event that is claimed by another relay or
+// waiting for its retry. The claimed events are leased to this relay for as
+// long as publishing all of them may take.
+func (r *Relay) claim(ctx context.Context) ([]models.OutboxEvent, error) {
+	var claimed []models.OutboxEvent
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		//claims are taken one relay at a time, so each sees the leases of the others
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", claimLockKey).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		waiting := tx.Table("outbox_events AS earlier").Select("1").
+			Where("earlier.aggregate_type = outbox_events.aggregate_type AND earlier.aggregate_id = outbox_events.aggregate_id").
+			Where("earlier.id < outbox_events.id AND earlier.published_at IS NULL AND earlier.next_attempt_at > ?", now)
+		err := tx.Where("published_at IS NULL AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", now).
+			Where("NOT EXISTS (?)", waiting).
+			Order("id ASC").
+			Limit(r.BatchSize).
+			Find(&claimed).Error
+		if err != nil || len(claimed) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(claimed))
+		for i, row := range claimed {
+			ids[i] = row.ID
+		}
+		lease := now.Add(time.Duration(len(claimed)+1) * publishTimeout)
+		return tx.Model(&models.OutboxEvent{}).Where("id IN ?", ids).Update("next_attempt_at", lease).Error
+	})
+	return claimed, err
+}
+
+// fail records a failed attempt to publish the event and schedules its retry.
+func (r *Relay) fail(ctx context.Context, db *gorm.DB, row models.OutboxEvent, cause error) error {
+	attempts := row.Attempts + 1
+	metrics.EventPublishFailures.WithLabelValues(row.EventType).Inc()
+	if attempts >= r.AlertAttempts {
+		slog.ErrorContext(ctx, "event keeps failing to publish, its product's later events are held back", "event_id", row.ID, "type", row.EventType, "attempts", attempts, "error", cause)
+	} else {
+		slog.WarnContext(ctx, "failed to publish event", "event_id", row.ID, "type", row.EventType, "attempts", attempts, "error", cause)
+	}
+
+	return db.Model(&row).Updates(map[string]interface{}{
+		"attempts":        attempts,
+		"last_error":      cause.Error(),
+		"next_attempt_at": time.Now().Add(r.backoff(attempts)),
+	}).Error
+}
+
+// backoff is the wait after the given number of failed attempts: RetryBackoff
+// doubled after every failure, capped at MaxBackoff.
+func (r *Relay) backoff(attempts int) time.Duration {
+	wait := r.RetryBackoff
+	for i := 1; i < attempts && wait < r.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > r.MaxBackoff {
+		wait = r.MaxBackoff
+	}
+	return wait
+}
+
+func (r *Relay) publish(ctx context.Context, event Event) error {
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	return r.Publisher.Publish(ctx, event)
+}
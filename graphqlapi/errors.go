@@ -0,0 +1,92 @@
+package graphqlapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"gorm.io/gorm"
+)
+
+// Codes set in the extensions of errors, so that clients need not match on
+// messages.
+const (
+	CodeBadUserInput       = "BAD_USER_INPUT"
+	CodeNotFound           = "NOT_FOUND"
+	CodeConflict           = "CONFLICT"
+	CodeFailedPrecondition = "FAILED_PRECONDITION"
+	CodeForbidden          = "FORBIDDEN"
+	CodeQueryTooDeep       = "QUERY_TOO_DEEP"
+	CodeQueryTooComplex    = "QUERY_TOO_COMPLEX"
+	CodeInternal           = "INTERNAL"
+)
+
+var errAdminRequired = &queryError{code: CodeForbidden, message: "admin API key required"}
+
+// queryError is an error reported to clients with a code, and for invalid
+// input the invalid fields, in its extensions.
+type queryError struct {
+	code    string
+	message string
+	fields  map[string]string
+}
+
+func (e *queryError) Error() string {
+	return e.message
+}
+
+func (e *queryError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.code}
+	if len(e.fields) > 0 {
+		extensions["fields"] = e.fields
+	}
+	return extensions
+}
+
+// resolveError maps the errors of the product service to the errors reported
+// to clients, like the REST API maps them to HTTP statuses. Unexpected errors
+// are logged and reported without their details.
+func resolveError(ctx context.Context, err error) error {
+	var invalid *controllers.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		return &queryError{code: CodeBadUserInput, message: invalid.Error(), fields: invalid.Fields}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return &queryError{code: CodeNotFound, message: "product not found"}
+	case errors.Is(err, controllers.ErrDuplicateProduct):
+		return &queryError{code: CodeConflict, message: controllers.ErrDuplicateProduct.Error()}
+	case errors.Is(err, controllers.ErrProductInactive), errors.Is(err, controllers.ErrInsufficientStock):
+		return &queryError{code: CodeFailedPrecondition, message: err.Error()}
+	default:
+		slog.ErrorContext(ctx, "graphql resolver failed", "error", err)
+		return &queryError{code: CodeInternal, message: "internal error"}
+	}
+}
+
+// withExtensions sets the extensions of errors raised by thunks, which the
+// executor drops on the way to the response.
+func withExtensions(formatted gqlerrors.FormattedError) gqlerrors.FormattedError {
+	var err error = formatted
+	for err != nil && formatted.Extensions == nil {
+		switch e := err.(type) {
+		case *queryError:
+			formatted.Extensions = e.Extensions()
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		default:
+			err = nil
+		}
+	}
+	return formatted
+}
+
+func limitError(code, message string) gqlerrors.FormattedError {
+	return gqlerrors.FormatError(&gqlerrors.Error{
+		Message:       message,
+		OriginalError: &queryError{code: code, message: message},
+	})
+}
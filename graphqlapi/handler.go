@@ -0,0 +1,94 @@
+package graphqlapi
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"gorm.io/gorm"
+)
+
+// Handler serves GraphQL queries over HTTP, next to the REST API.
+type Handler struct {
+	schema graphql.Schema
+	db     *gorm.DB
+	limits config.GraphQL
+}
+
+// NewHandler returns a handler for the product catalogue schema. It panics if
+// the schema is invalid.
+func NewHandler(db *gorm.DB, products *controllers.ProductService, cfg config.GraphQL) *Handler {
+	schema, err := NewSchema(products)
+	if err != nil {
+		panic(err)
+	}
+	return &Handler{
+		schema: schema,
+		db:     db,
+		limits: cfg,
+	}
+}
+
+type Request struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Serve godoc
+// @Summary GraphQL endpoint
+// @Description run a GraphQL query or mutation on the product catalogue. Errors are reported in the errors of the result, with a code in their extensions.
+// @Tags graphql
+// @Accept  json
+// @Produce json
+// @Param params body Request true "GraphQL request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} controllers.Response
+// @Router /graphql [post]
+func (h *Handler) Serve(ctx *gin.Context) {
+	var req Request
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "BAD_REQUEST", "message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, h.Execute(ctx.Request.Context(), req))
+}
+
+// Execute runs req, once it is known to be valid and within the depth and
+// complexity limits. ctx names the caller, see audit.WithActor.
+func (h *Handler) Execute(ctx context.Context, req Request) *graphql.Result {
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	validation := graphql.ValidateDocument(&h.schema, document, nil)
+	if !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}
+	}
+	if errs := checkLimits(&h.schema, document, req.OperationName, req.Variables, h.limits); len(errs) > 0 {
+		return &graphql.Result{Errors: errs}
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           document,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       withLoaders(ctx, h.db),
+	})
+	for i, err := range result.Errors {
+		result.Errors[i] = withExtensions(err)
+	}
+	return result
+}
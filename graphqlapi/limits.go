@@ -0,0 +1,174 @@
+package graphqlapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// cost measures a query before it runs. Its depth is how deeply its fields
+// nest. Its complexity counts every field once per item it can be resolved
+// for: the selections under a field taking a limit are counted limit times.
+// Introspection fields are not counted.
+type cost struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// maxCost is the most a query's complexity is counted as. Counting saturates
+// there instead of overflowing, so huge limits cannot wrap a query's
+// complexity around to a small number.
+const maxCost = math.MaxInt32
+
+// checkLimits rejects the operation of document when it is deeper or more
+// complex than cfg allows. It returns no errors when the operation cannot be
+// found, leaving execution to report it.
+func checkLimits(schema *graphql.Schema, document *ast.Document, operationName string, variables map[string]interface{}, cfg config.GraphQL) []gqlerrors.FormattedError {
+	c := cost{schema: schema, fragments: map[string]*ast.FragmentDefinition{}, variables: variables}
+
+	var operations []*ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.OperationDefinition:
+			if operationName == "" || (definition.Name != nil && definition.Name.Value == operationName) {
+				operations = append(operations, definition)
+			}
+		case *ast.FragmentDefinition:
+			c.fragments[definition.Name.Value] = definition
+		}
+	}
+	if len(operations) != 1 {
+		return nil
+	}
+
+	root := schema.QueryType()
+	if operations[0].Operation == ast.OperationTypeMutation {
+		root = schema.MutationType()
+	}
+	depth, complexity := c.measure(root, operations[0].SelectionSet, 1)
+
+	var errs []gqlerrors.FormattedError
+	if depth > cfg.MaxDepth {
+		errs = append(errs, limitError(CodeQueryTooDeep, fmt.Sprintf("query depth %d exceeds the limit of %d", depth, cfg.MaxDepth)))
+	}
+	if complexity > cfg.MaxComplexity {
+		errs = append(errs, limitError(CodeQueryTooComplex, fmt.Sprintf("query complexity %d exceeds the limit of %d", complexity, cfg.MaxComplexity)))
+	}
+	return errs
+}
+
+// measure returns the depth and complexity of the selections made on parent,
+// whose fields are at the given depth.
+func (c cost) measure(parent graphql.Type, selections *ast.SelectionSet, depth int) (int, int) {
+	if selections == nil {
+		return depth - 1, 0
+	}
+
+	maxDepth, complexity := depth, 0
+	for _, selection := range selections.Selections {
+		var selectionDepth, selectionComplexity int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name.Value, "__") {
+				continue
+			}
+			object, ok := parent.(*graphql.Object)
+			if !ok {
+				continue
+			}
+			field, ok := object.Fields()[selection.Name.Value]
+			if !ok {
+				continue
+			}
+			fieldType, _ := graphql.GetNamed(field.Type).(graphql.Type)
+			selectionDepth, selectionComplexity = c.measure(fieldType, selection.SelectionSet, depth+1)
+			selectionComplexity = addCost(1, mulCost(selectionComplexity, c.limit(field, selection)))
+		case *ast.InlineFragment:
+			selectionDepth, selectionComplexity = c.measure(c.fragmentType(parent, selection.TypeCondition), selection.SelectionSet, depth)
+		case *ast.FragmentSpread:
+			fragment, ok := c.fragments[selection.Name.Value]
+			if !ok {
+				continue
+			}
+			selectionDepth, selectionComplexity = c.measure(c.fragmentType(parent, fragment.TypeCondition), fragment.SelectionSet, depth)
+		}
+		maxDepth = max(maxDepth, selectionDepth)
+		complexity = addCost(complexity, selectionComplexity)
+	}
+	return maxDepth, complexity
+}
+
+// addCost and mulCost add and multiply complexities, both at least 0, up to
+// maxCost.
+func addCost(a, b int) int {
+	if a > maxCost-b {
+		return maxCost
+	}
+	return a + b
+}
+
+func mulCost(a, b int) int {
+	if a != 0 && b > maxCost/a {
+		return maxCost
+	}
+	return a * b
+}
+
+func (c cost) fragmentType(parent graphql.Type, condition *ast.Named) graphql.Type {
+	if condition == nil {
+		return parent
+	}
+	return c.schema.Type(condition.Name.Value)
+}
+
+// limit returns how many items a field resolves to: the limit it is given,
+// or its default limit, and one for fields without a limit argument. Limits
+// are counted as at most maxCost.
+func (c cost) limit(field *graphql.FieldDefinition, selection *ast.Field) int {
+	for _, argument := range selection.Arguments {
+		if argument.Name.Value != "limit" {
+			continue
+		}
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			//out of range values come back clamped to the largest or smallest int
+			if limit, err := strconv.Atoi(value.Value); err == nil || errors.Is(err, strconv.ErrRange) {
+				return min(max(limit, 1), maxCost)
+			}
+		case *ast.Variable:
+			if limit, ok := intValue(c.variables[value.Name.Value]); ok {
+				return min(max(limit, 1), maxCost)
+			}
+		}
+	}
+	for _, argument := range field.Args {
+		if argument.Name() == "limit" {
+			if limit, ok := intValue(argument.DefaultValue); ok {
+				return min(max(limit, 1), maxCost)
+			}
+		}
+	}
+	return 1
+}
+
+func intValue(value interface{}) (int, bool) {
+	switch value := value.(type) {
+	case int:
+		return value, true
+	case float64:
+		return int(max(min(value, maxCost), -maxCost)), true
+	case json.Number:
+		limit, err := value.Float64()
+		return int(max(min(limit, maxCost), -maxCost)), err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,200 @@
+package graphqlapi
+
+import (
+	"context"
+	"sync"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/models"
+	"gorm.io/gorm"
+)
+
+// loader batches the lookups of one relation. Resolvers queue the keys they
+// need and return a thunk; the first thunk called fetches every queued key in
+// one query. Queries are resolved a level at a time, so a page of products
+// loads a relation for all of them at once instead of once per product.
+type loader[K comparable, V any] struct {
+	fetch func(keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	queued  map[K]bool
+	values  map[K]V
+	errs    map[K]error
+}
+
+func newLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{
+		fetch:  fetch,
+		queued: map[K]bool{},
+		values: map[K]V{},
+		errs:   map[K]error{},
+	}
+}
+
+// load queues key and returns a thunk resolving to its value, or to nil when
+// the key was not found.
+func (l *loader[K, V]) load(key K) func() (interface{}, error) {
+	l.mu.Lock()
+	if !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		value, found, err := l.get(key)
+		if err != nil || !found {
+			return nil, err
+		}
+		return value, nil
+	}
+}
+
+func (l *loader[K, V]) get(key K) (V, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.pending) > 0 {
+		keys := l.pending
+		l.pending = nil
+		values, err := l.fetch(keys)
+		for _, k := range keys {
+			if err != nil {
+				l.errs[k] = err
+			} else if value, ok := values[k]; ok {
+				l.values[k] = value
+			}
+		}
+	}
+
+	value, found := l.values[key]
+	return value, found, l.errs[key]
+}
+
+// loaders hold the loaders of one request, so that nothing is cached across
+// requests.
+type loaders struct {
+	incomingStock *loader[uint, int]
+	history       *loader[historyKey, []models.AuditLog]
+	orderLines    *loader[uint, []models.PurchaseOrderLine]
+	orders        *loader[uint, models.PurchaseOrder]
+	products      *loader[uint, models.Product]
+	suppliers     *loader[uint, models.Supplier]
+}
+
+// historyKey selects the limit newest audit entries of a product.
+type historyKey struct {
+	productId uint
+	limit     int
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, db *gorm.DB) context.Context {
+	db = db.WithContext(ctx)
+	return context.WithValue(ctx, loadersKey{}, &loaders{
+		incomingStock: newLoader(func(productIds []uint) (map[uint]int, error) {
+			//unreceived quantities on approved purchase orders, as in the
+			//outstanding orders report
+			var rows []struct {
+				ProductID   uint
+				Outstanding int
+			}
+			err := db.Model(&models.PurchaseOrderLine{}).
+				Select("purchase_order_lines.product_id, SUM(purchase_order_lines.quantity - purchase_order_lines.received_quantity) AS outstanding").
+				Joins("JOIN purchase_orders ON purchase_orders.id = purchase_order_lines.purchase_order_id AND purchase_orders.deleted_at IS NULL").
+				Where("purchase_orders.status IN ?", []string{models.PurchaseOrderApproved, models.PurchaseOrderPartiallyReceived}).
+				Where("purchase_order_lines.product_id IN ?", productIds).
+				Group("purchase_order_lines.product_id").
+				Scan(&rows).Error
+			if err != nil {
+				return nil, err
+			}
+
+			incoming := make(map[uint]int, len(productIds))
+			for _, productId := range productIds {
+				incoming[productId] = 0
+			}
+			for _, row := range rows {
+				incoming[row.ProductID] = row.Outstanding
+			}
+			return incoming, nil
+		}),
+		history: newLoader(func(keys []historyKey) (map[historyKey][]models.AuditLog, error) {
+			//one query per limit, numbering the entries of each product to
+			//keep its newest ones
+			byLimit := map[int][]uint{}
+			for _, key := range keys {
+				byLimit[key.limit] = append(byLimit[key.limit], key.productId)
+			}
+			history := make(map[historyKey][]models.AuditLog, len(keys))
+			for limit, productIds := range byLimit {
+				ranked := db.Model(&models.AuditLog{}).
+					Select("*, ROW_NUMBER() OVER (PARTITION BY entity_id ORDER BY id DESC) AS position").
+					Where("entity_type = ? AND entity_id IN ?", audit.EntityProduct, productIds)
+				var entries []models.AuditLog
+				err := db.Table("(?) AS ranked", ranked).Where("position <= ?", limit).Order("id DESC").Find(&entries).Error
+				if err != nil {
+					return nil, err
+				}
+				for _, productId := range productIds {
+					history[historyKey{productId: productId, limit: limit}] = []models.AuditLog{}
+				}
+				for _, entry := range entries {
+					key := historyKey{productId: entry.EntityID, limit: limit}
+					history[key] = append(history[key], entry)
+				}
+			}
+			return history, nil
+		}),
+		orderLines: newLoader(func(productIds []uint) (map[uint][]models.PurchaseOrderLine, error) {
+			var lines []models.PurchaseOrderLine
+			if err := db.Where("product_id IN ?", productIds).Order("id ASC").Find(&lines).Error; err != nil {
+				return nil, err
+			}
+			byProduct := make(map[uint][]models.PurchaseOrderLine, len(productIds))
+			for _, productId := range productIds {
+				byProduct[productId] = []models.PurchaseOrderLine{}
+			}
+			for _, line := range lines {
+				byProduct[line.ProductID] = append(byProduct[line.ProductID], line)
+			}
+			return byProduct, nil
+		}),
+		orders: newLoader(func(ids []uint) (map[uint]models.PurchaseOrder, error) {
+			var orders []models.PurchaseOrder
+			if err := db.Where("id IN ?", ids).Find(&orders).Error; err != nil {
+				return nil, err
+			}
+			return byID(orders, func(order models.PurchaseOrder) uint { return order.ID }), nil
+		}),
+		products: newLoader(func(ids []uint) (map[uint]models.Product, error) {
+			//purchase order lines keep pointing at deleted products
+			var products []models.Product
+			if err := db.Unscoped().Where("id IN ?", ids).Find(&products).Error; err != nil {
+				return nil, err
+			}
+			return byID(products, func(product models.Product) uint { return product.ID }), nil
+		}),
+		suppliers: newLoader(func(ids []uint) (map[uint]models.Supplier, error) {
+			var suppliers []models.Supplier
+			if err := db.Unscoped().Where("id IN ?", ids).Find(&suppliers).Error; err != nil {
+				return nil, err
+			}
+			return byID(suppliers, func(supplier models.Supplier) uint { return supplier.ID }), nil
+		}),
+	})
+}
+
+func loadersFor(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+func byID[V any](values []V, id func(V) uint) map[uint]V {
+	byId := make(map[uint]V, len(values))
+	for _, value := range values {
+		byId[id(value)] = value
+	}
+	return byId
+}
@@ -0,0 +1,427 @@
+package graphqlapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/helpers"
+	"github.com/AllanM007/simpler-test/middleware"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/graphql-go/graphql"
+	"gorm.io/gorm"
+)
+
+// defaultLimit is the page size of listings that do not set one, as in the
+// REST API.
+const defaultLimit = 10
+
+// A product's history lists its defaultHistoryLimit newest audit entries
+// unless the query asks for more, up to maxHistoryLimit.
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// NewSchema returns the schema of the product catalogue, resolved through
+// products.
+func NewSchema(products *controllers.ProductService) (graphql.Schema, error) {
+	supplierType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Supplier",
+		Fields: graphql.Fields{
+			"id":    field(graphql.NewNonNull(graphql.ID), func(s models.Supplier) interface{} { return s.ID }),
+			"name":  field(graphql.NewNonNull(graphql.String), func(s models.Supplier) interface{} { return s.Name }),
+			"email": field(graphql.NewNonNull(graphql.String), func(s models.Supplier) interface{} { return s.Email }),
+			"phone": field(graphql.NewNonNull(graphql.String), func(s models.Supplier) interface{} { return s.Phone }),
+		},
+	})
+
+	purchaseOrderType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PurchaseOrder",
+		Fields: graphql.Fields{
+			"id":         field(graphql.NewNonNull(graphql.ID), func(o models.PurchaseOrder) interface{} { return o.ID }),
+			"status":     field(graphql.NewNonNull(graphql.String), func(o models.PurchaseOrder) interface{} { return o.Status }),
+			"approvedAt": field(graphql.DateTime, func(o models.PurchaseOrder) interface{} { return o.ApprovedAt }),
+			"receivedAt": field(graphql.DateTime, func(o models.PurchaseOrder) interface{} { return o.ReceivedAt }),
+			"createdAt":  field(graphql.NewNonNull(graphql.DateTime), func(o models.PurchaseOrder) interface{} { return o.CreatedAt }),
+			"supplier": &graphql.Field{
+				Type: supplierType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadersFor(p.Context).suppliers.load(p.Source.(models.PurchaseOrder).SupplierID), nil
+				},
+			},
+		},
+	})
+
+	auditEntryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AuditEntry",
+		Fields: graphql.Fields{
+			"id":        field(graphql.NewNonNull(graphql.ID), func(e models.AuditLog) interface{} { return e.ID }),
+			"actor":     field(graphql.NewNonNull(graphql.String), func(e models.AuditLog) interface{} { return e.Actor }),
+			"action":    field(graphql.NewNonNull(graphql.String), func(e models.AuditLog) interface{} { return e.Action }),
+			"requestId": field(graphql.NewNonNull(graphql.String), func(e models.AuditLog) interface{} { return e.RequestID }),
+			"createdAt": field(graphql.NewNonNull(graphql.DateTime), func(e models.AuditLog) interface{} { return e.CreatedAt }),
+			"changedFields": field(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))), func(e models.AuditLog) interface{} {
+				fields := make([]string, 0, len(e.Changes))
+				for name := range e.Changes {
+					fields = append(fields, name)
+				}
+				sort.Strings(fields)
+				return fields
+			}),
+		},
+	})
+
+	//products and purchase order lines refer to each other, so their fields
+	//are only built once both types exist
+	var productType, purchaseOrderLineType *graphql.Object
+	purchaseOrderLineType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "PurchaseOrderLine",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":               field(graphql.NewNonNull(graphql.ID), func(l models.PurchaseOrderLine) interface{} { return l.ID }),
+				"quantity":         field(graphql.NewNonNull(graphql.Int), func(l models.PurchaseOrderLine) interface{} { return l.Quantity }),
+				"receivedQuantity": field(graphql.NewNonNull(graphql.Int), func(l models.PurchaseOrderLine) interface{} { return l.ReceivedQuantity }),
+				"outstanding":      field(graphql.NewNonNull(graphql.Int), func(l models.PurchaseOrderLine) interface{} { return l.Outstanding() }),
+				"unitCost":         field(graphql.NewNonNull(graphql.Float), func(l models.PurchaseOrderLine) interface{} { return l.UnitCost }),
+				"purchaseOrder": &graphql.Field{
+					Type: purchaseOrderType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFor(p.Context).orders.load(p.Source.(models.PurchaseOrderLine).PurchaseOrderID), nil
+					},
+				},
+				"product": &graphql.Field{
+					Type: productType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFor(p.Context).products.load(p.Source.(models.PurchaseOrderLine).ProductID), nil
+					},
+				},
+			}
+		}),
+	})
+	productType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Product",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":              field(graphql.NewNonNull(graphql.ID), func(p models.Product) interface{} { return p.ID }),
+				"name":            field(graphql.NewNonNull(graphql.String), func(p models.Product) interface{} { return p.Name }),
+				"description":     field(graphql.NewNonNull(graphql.String), func(p models.Product) interface{} { return p.Description }),
+				"price":           field(graphql.NewNonNull(graphql.Float), func(p models.Product) interface{} { return p.Price }),
+				"stock":           field(graphql.NewNonNull(graphql.Int), func(p models.Product) interface{} { return p.StockLevel }),
+				"reorderPoint":    field(graphql.NewNonNull(graphql.Int), func(p models.Product) interface{} { return p.ReorderPoint }),
+				"reorderQuantity": field(graphql.NewNonNull(graphql.Int), func(p models.Product) interface{} { return p.ReorderQuantity }),
+				"active":          field(graphql.NewNonNull(graphql.Boolean), func(p models.Product) interface{} { return p.Active }),
+				"lowStock": field(graphql.NewNonNull(graphql.Boolean), func(p models.Product) interface{} {
+					return p.ReorderPoint > 0 && p.StockLevel <= p.ReorderPoint
+				}),
+				"createdAt": field(graphql.NewNonNull(graphql.DateTime), func(p models.Product) interface{} { return p.CreatedAt }),
+				"updatedAt": field(graphql.NewNonNull(graphql.DateTime), func(p models.Product) interface{} { return p.UpdatedAt }),
+				"deletedAt": field(graphql.DateTime, func(p models.Product) interface{} {
+					if !p.DeletedAt.Valid {
+						return nil
+					}
+					return p.DeletedAt.Time
+				}),
+				"incomingStock": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.Int),
+					Description: "Quantity ordered from suppliers on approved purchase orders and not received yet.",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFor(p.Context).incomingStock.load(p.Source.(models.Product).ID), nil
+					},
+				},
+				"purchaseOrderLines": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(purchaseOrderLineType))),
+					Description: "Lines ordering the product on any purchase order.",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFor(p.Context).orderLines.load(p.Source.(models.Product).ID), nil
+					},
+				},
+				"history": adminOnly(&graphql.Field{
+					Type:        graphql.NewList(graphql.NewNonNull(auditEntryType)),
+					Description: "The latest audited changes to the product, newest first. Admin only.",
+					Args: graphql.FieldConfigArgument{
+						"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultHistoryLimit, Description: fmt.Sprintf("At most %d.", maxHistoryLimit)},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						limit, _ := p.Args["limit"].(int)
+						if limit < 1 || limit > maxHistoryLimit {
+							return nil, &queryError{code: CodeBadUserInput, message: fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit)}
+						}
+						return loadersFor(p.Context).history.load(historyKey{productId: p.Source.(models.Product).ID, limit: limit}), nil
+					},
+				}),
+			}
+		}),
+	})
+
+	productPageType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ProductPage",
+		Fields: graphql.Fields{
+			"items": field(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(productType))), func(p productPage) interface{} { return p.items }),
+			"page":  field(graphql.NewNonNull(graphql.Int), func(p productPage) interface{} { return p.page }),
+			"limit": field(graphql.NewNonNull(graphql.Int), func(p productPage) interface{} { return p.limit }),
+			"total": field(graphql.NewNonNull(graphql.Int), func(p productPage) interface{} { return p.total }),
+		},
+	})
+
+	productFilterType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "ProductFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"search":         &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "Keep products whose name contains it, ignoring case."},
+			"lowStock":       &graphql.InputObjectFieldConfig{Type: graphql.Boolean, Description: "Keep products at or below their reorder point."},
+			"minPrice":       &graphql.InputObjectFieldConfig{Type: graphql.Float},
+			"maxPrice":       &graphql.InputObjectFieldConfig{Type: graphql.Float},
+			"includeDeleted": &graphql.InputObjectFieldConfig{Type: graphql.Boolean, Description: "List deleted products too. Admin only."},
+		},
+	})
+
+	createProductInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CreateProductInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":            &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"description":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"price":           &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+			"stock":           &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"reorderPoint":    &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"reorderQuantity": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		},
+	})
+
+	updateProductInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "UpdateProductInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":            &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "Left unchanged when not set."},
+			"description":     &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "Left unchanged when not set."},
+			"price":           &graphql.InputObjectFieldConfig{Type: graphql.Float, Description: "Left unchanged when not set."},
+			"reorderPoint":    &graphql.InputObjectFieldConfig{Type: graphql.Int, Description: "Left unchanged when not set."},
+			"reorderQuantity": &graphql.InputObjectFieldConfig{Type: graphql.Int, Description: "Left unchanged when not set."},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"products": &graphql.Field{
+				Type:        graphql.NewNonNull(productPageType),
+				Description: "A page of products, newest first. Inactive products are only listed for admins.",
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: productFilterType},
+					"page":   &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1},
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultLimit, Description: fmt.Sprintf("At most %d.", helpers.MaxLimit)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					page, _ := p.Args["page"].(int)
+					limit, _ := p.Args["limit"].(int)
+					if page < 1 || limit < 1 {
+						return nil, &queryError{code: CodeBadUserInput, message: "page and limit must be positive"}
+					}
+					if limit > helpers.MaxLimit {
+						return nil, &queryError{code: CodeBadUserInput, message: fmt.Sprintf("limit must be at most %d", helpers.MaxLimit)}
+					}
+
+					filter, err := productFilter(p.Context, p.Args["filter"])
+					if err != nil {
+						return nil, err
+					}
+					items, total, err := products.List(p.Context, filter, page, limit)
+					if err != nil {
+						return nil, resolveError(p.Context, err)
+					}
+					return productPage{items: items, page: page, limit: limit, total: total}, nil
+				},
+			},
+			"product": &graphql.Field{
+				Type:        productType,
+				Description: "The product with the given id, or null when there is none.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := idArg(p)
+					if err != nil {
+						return nil, err
+					}
+					product, err := products.Get(p.Context, id)
+					if errors.Is(err, gorm.ErrRecordNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, resolveError(p.Context, err)
+					}
+					return product, nil
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createProduct": &graphql.Field{
+				Type: graphql.NewNonNull(productType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createProductInput)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					input := p.Args["input"].(map[string]interface{})
+					product, err := products.Create(p.Context, controllers.ProductCreateReq{
+						Name:            optionalString(input["name"]),
+						Description:     optionalString(input["description"]),
+						Price:           optionalFloat(input["price"]),
+						StockLevel:      optionalInt(input["stock"]),
+						ReorderPoint:    optionalInt(input["reorderPoint"]),
+						ReorderQuantity: optionalInt(input["reorderQuantity"]),
+					})
+					if err != nil {
+						return nil, resolveError(p.Context, err)
+					}
+					return product, nil
+				},
+			},
+			"updateProduct": &graphql.Field{
+				Type: graphql.NewNonNull(productType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateProductInput)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := idArg(p)
+					if err != nil {
+						return nil, err
+					}
+					input := p.Args["input"].(map[string]interface{})
+					var update controllers.ProductUpdateReq
+					if name, ok := input["name"].(string); ok {
+						update.Name = &name
+					}
+					if description, ok := input["description"].(string); ok {
+						update.Description = &description
+					}
+					if price, ok := input["price"].(float64); ok {
+						update.Price = &price
+					}
+					if reorderPoint, ok := input["reorderPoint"].(int); ok {
+						update.ReorderPoint = &reorderPoint
+					}
+					if reorderQuantity, ok := input["reorderQuantity"].(int); ok {
+						update.ReorderQuantity = &reorderQuantity
+					}
+
+					product, err := products.Update(p.Context, id, update)
+					if err != nil {
+						return nil, resolveError(p.Context, err)
+					}
+					return product, nil
+				},
+			},
+			"sellProduct": &graphql.Field{
+				Type: graphql.NewNonNull(productType),
+				Args: graphql.FieldConfigArgument{
+					"id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"quantity": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := idArg(p)
+					if err != nil {
+						return nil, err
+					}
+					product, err := products.Sell(p.Context, id, optionalInt(p.Args["quantity"]))
+					if err != nil {
+						return nil, resolveError(p.Context, err)
+					}
+					return product, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+type productPage struct {
+	items []models.Product
+	page  int
+	limit int
+	total int64
+}
+
+// field returns a field resolving to value of its source.
+func field[T any](fieldType graphql.Output, value func(T) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: fieldType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return value(p.Source.(T)), nil
+		},
+	}
+}
+
+// adminOnly guards a field so that only admins can read it. Other callers get
+// null and a FORBIDDEN error for it, and the rest of their query resolves.
+func adminOnly(guarded *graphql.Field) *graphql.Field {
+	resolve := guarded.Resolve
+	guarded.Resolve = func(p graphql.ResolveParams) (interface{}, error) {
+		if !isAdmin(p.Context) {
+			return nil, errAdminRequired
+		}
+		return resolve(p)
+	}
+	return guarded
+}
+
+func isAdmin(ctx context.Context) bool {
+	return middleware.AdminActor(audit.Actor(ctx))
+}
+
+// productFilter selects the products the caller asked for and may list:
+// inactive products only for admins, and deleted ones only if an admin asked
+// for them.
+func productFilter(ctx context.Context, arg interface{}) (controllers.ProductFilter, error) {
+	filter := controllers.ProductFilter{IncludeInactive: isAdmin(ctx)}
+	input, _ := arg.(map[string]interface{})
+
+	if includeDeleted, _ := input["includeDeleted"].(bool); includeDeleted {
+		if !isAdmin(ctx) {
+			return filter, &queryError{code: CodeForbidden, message: "only admins can list deleted products"}
+		}
+		filter.IncludeDeleted = true
+	}
+	filter.Search, _ = input["search"].(string)
+	filter.LowStock, _ = input["lowStock"].(bool)
+	if minPrice, ok := input["minPrice"].(float64); ok {
+		filter.MinPrice = &minPrice
+	}
+	if maxPrice, ok := input["maxPrice"].(float64); ok {
+		filter.MaxPrice = &maxPrice
+	}
+	return filter, nil
+}
+
+// idArg returns the id argument of a field, which must be a positive integer.
+func idArg(p graphql.ResolveParams) (string, error) {
+	id, _ := p.Args["id"].(string)
+	if value, err := strconv.ParseUint(id, 10, 64); err != nil || value == 0 {
+		return "", &queryError{code: CodeBadUserInput, message: "invalid request: id must be a positive integer", fields: map[string]string{"id": "id must be a positive integer"}}
+	}
+	return id, nil
+}
+
+//inputs hold the zero value of optional fields that were not set
+
+func optionalString(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+func optionalInt(value interface{}) int {
+	i, _ := value.(int)
+	return i
+}
+
+func optionalFloat(value interface{}) float64 {
+	f, _ := value.(float64)
+	return f
+}
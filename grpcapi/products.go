@@ -0,0 +1,240 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/controllers"
+	productv1 "github.com/AllanM007/simpler-test/gen/product/v1"
+	"github.com/AllanM007/simpler-test/helpers"
+	"github.com/AllanM007/simpler-test/middleware"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/stream"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// defaultLimit is the page size of listings that do not set one, as in the
+// REST API.
+const defaultLimit = 10
+
+type productServer struct {
+	productv1.UnimplementedProductServiceServer
+	products *controllers.ProductService
+	broker   *stream.Broker
+}
+
+func (s *productServer) CreateProduct(ctx context.Context, req *productv1.CreateProductRequest) (*productv1.CreateProductResponse, error) {
+	product, err := s.products.Create(ctx, controllers.ProductCreateReq{
+		Name:            req.GetName(),
+		Description:     req.GetDescription(),
+		Price:           req.GetPrice(),
+		StockLevel:      int(req.GetStock()),
+		ReorderPoint:    int(req.GetReorderPoint()),
+		ReorderQuantity: int(req.GetReorderQuantity()),
+	})
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return &productv1.CreateProductResponse{Product: toProduct(product)}, nil
+}
+
+func (s *productServer) GetProduct(ctx context.Context, req *productv1.GetProductRequest) (*productv1.GetProductResponse, error) {
+	product, err := s.products.Get(ctx, productId(req.GetId()))
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return &productv1.GetProductResponse{Product: toProduct(product)}, nil
+}
+
+func (s *productServer) ListProducts(ctx context.Context, req *productv1.ListProductsRequest) (*productv1.ListProductsResponse, error) {
+	page, limit := int(req.GetPage()), int(req.GetLimit())
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultLimit
+	}
+	if limit > helpers.MaxLimit {
+		return nil, invalidArgument(&controllers.ValidationError{Fields: map[string]string{"limit": fmt.Sprintf("limit must be at most %d", helpers.MaxLimit)}})
+	}
+
+	filter := controllers.ProductFilter{IncludeInactive: middleware.AdminActor(audit.Actor(ctx))}
+	products, count, err := s.products.List(ctx, filter, page, limit)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	response := &productv1.ListProductsResponse{Page: int32(page), Limit: int32(limit), Total: count}
+	for _, product := range products {
+		response.Products = append(response.Products, toProduct(product))
+	}
+	return response, nil
+}
+
+func (s *productServer) UpdateProduct(ctx context.Context, req *productv1.UpdateProductRequest) (*productv1.UpdateProductResponse, error) {
+	update := controllers.ProductUpdateReq{
+		Name:        req.Name,
+		Description: req.Description,
+		Price:       req.Price,
+	}
+	if req.ReorderPoint != nil {
+		reorderPoint := int(req.GetReorderPoint())
+		update.ReorderPoint = &reorderPoint
+	}
+	if req.ReorderQuantity != nil {
+		reorderQuantity := int(req.GetReorderQuantity())
+		update.ReorderQuantity = &reorderQuantity
+	}
+
+	product, err := s.products.Update(ctx, productId(req.GetId()), update)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return &productv1.UpdateProductResponse{Product: toProduct(product)}, nil
+}
+
+func (s *productServer) DeleteProduct(ctx context.Context, req *productv1.DeleteProductRequest) (*productv1.DeleteProductResponse, error) {
+	if err := s.products.Delete(ctx, productId(req.GetId())); err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return &productv1.DeleteProductResponse{}, nil
+}
+
+func (s *productServer) SellProduct(ctx context.Context, req *productv1.SellProductRequest) (*productv1.SellProductResponse, error) {
+	product, err := s.products.Sell(ctx, productId(req.GetId()), int(req.GetQuantity()))
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return &productv1.SellProductResponse{Product: toProduct(product)}, nil
+}
+
+func (s *productServer) WatchStock(req *productv1.WatchStockRequest, watch productv1.ProductService_WatchStockServer) error {
+	productIds := make([]uint, 0, len(req.GetProductIds()))
+	for _, id := range req.GetProductIds() {
+		if id == 0 {
+			return status.Error(codes.InvalidArgument, "product_ids cannot hold 0")
+		}
+		productIds = append(productIds, uint(id))
+	}
+
+	subscriber, missed, complete := s.broker.Subscribe(productIds, req.GetLastEventId())
+	if subscriber == nil {
+		return status.Error(codes.Unavailable, "service is shutting down")
+	}
+	defer s.broker.Unsubscribe(subscriber)
+
+	if !complete {
+		if err := watch.Send(&productv1.WatchStockResponse{Reset_: true}); err != nil {
+			return err
+		}
+	}
+	for _, message := range missed {
+		if err := sendStockUpdate(watch, message); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-watch.Context().Done():
+			return status.FromContextError(watch.Context().Err()).Err()
+		case message, ok := <-subscriber.Messages:
+			//the broker dropped a lagging client or is shutting down
+			if !ok {
+				return status.Error(codes.Unavailable, "stream closed, resume with last_event_id")
+			}
+			if err := sendStockUpdate(watch, message); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func sendStockUpdate(watch productv1.ProductService_WatchStockServer, message stream.Message) error {
+	var update stream.StockUpdate
+	if err := json.Unmarshal(message.Data, &update); err != nil {
+		return status.Errorf(codes.Internal, "decoding stock update: %v", err)
+	}
+	return watch.Send(&productv1.WatchStockResponse{Update: &productv1.StockUpdate{
+		Id:            message.ID,
+		ProductId:     uint64(update.ProductID),
+		PreviousStock: int64(update.PreviousStock),
+		Stock:         int64(update.Stock),
+		Reason:        update.Reason,
+		OccurTime:     timestamppb.New(update.OccurredAt),
+	}})
+}
+
+func productId(id uint64) string {
+	return strconv.FormatUint(id, 10)
+}
+
+func toProduct(product models.Product) *productv1.Product {
+	return &productv1.Product{
+		Id:              uint64(product.ID),
+		Name:            product.Name,
+		Description:     product.Description,
+		Price:           product.Price,
+		Stock:           int64(product.StockLevel),
+		ReorderPoint:    int64(product.ReorderPoint),
+		ReorderQuantity: int64(product.ReorderQuantity),
+		Active:          product.Active,
+		CreateTime:      timestamppb.New(product.CreatedAt),
+		UpdateTime:      timestamppb.New(product.UpdatedAt),
+	}
+}
+
+// statusError maps the errors of the product service to gRPC status codes,
+// like the REST API maps them to HTTP statuses.
+func statusError(ctx context.Context, err error) error {
+	var invalid *controllers.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		return invalidArgument(invalid)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.NotFound, "product not found")
+	case errors.Is(err, controllers.ErrDuplicateProduct):
+		return status.Error(codes.AlreadyExists, controllers.ErrDuplicateProduct.Error())
+	case errors.Is(err, controllers.ErrProductInactive), errors.Is(err, controllers.ErrInsufficientStock):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		slog.ErrorContext(ctx, "grpc call failed", "error", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+// invalidArgument describes every invalid field of a request in the details
+// of its status.
+func invalidArgument(invalid *controllers.ValidationError) error {
+	fields := make([]string, 0, len(invalid.Fields))
+	for field := range invalid.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	badRequest := &errdetails.BadRequest{}
+	for _, field := range fields {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: invalid.Fields[field],
+		})
+	}
+
+	st := status.New(codes.InvalidArgument, invalid.Error())
+	if detailed, err := st.WithDetails(badRequest); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
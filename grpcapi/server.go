@@ -0,0 +1,185 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AllanM007/simpler-test/apikeys"
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/controllers"
+	productv1 "github.com/AllanM007/simpler-test/gen/product/v1"
+	"github.com/AllanM007/simpler-test/logging"
+	"github.com/AllanM007/simpler-test/middleware"
+	"github.com/AllanM007/simpler-test/stream"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDMetadata is the metadata key carrying request ids, like the
+// X-Request-ID header of the REST API.
+const requestIDMetadata = "x-request-id"
+
+// Server serves the gRPC API on its own port, next to the REST API.
+type Server struct {
+	server    *grpc.Server
+	addr      string
+	closeOnce sync.Once
+}
+
+// NewServer returns a server for the product service. Calls carrying
+// adminKey or an active key from keys are made as admin, like REST requests.
+func NewServer(cfg config.GRPC, products *controllers.ProductService, broker *stream.Broker, adminKey string, keys *apikeys.Store) *Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryInterceptor(adminKey, keys)),
+		grpc.ChainStreamInterceptor(streamInterceptor(adminKey, keys)),
+	)
+	productv1.RegisterProductServiceServer(server, &productServer{products: products, broker: broker})
+	return &Server{server: server, addr: fmt.Sprintf(":%d", cfg.Port)}
+}
+
+// Start listens on the configured port and serves in the background.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := s.Serve(listener); err != nil {
+			slog.Error("grpc server stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Serve serves on listener until the server is closed.
+func (s *Server) Serve(listener net.Listener) error {
+	slog.Info("grpc listening", "address", listener.Addr().String())
+	err := s.server.Serve(listener)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+// Close stops accepting calls and waits for running ones to finish. Calls
+// still running when ctx is done are cancelled.
+func (s *Server) Close(ctx context.Context) error {
+	var err error
+	s.closeOnce.Do(func() {
+		stopped := make(chan struct{})
+		go func() {
+			s.server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.server.Stop()
+			err = fmt.Errorf("draining grpc calls: %w", ctx.Err())
+		}
+	})
+	return err
+}
+
+// callContext names the caller and request of a call in its context, from the
+// API key and request id in its metadata.
+func callContext(ctx context.Context, adminKey string, keys *apikeys.Store) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	actor := middleware.KeyActor(ctx, adminKey, keys, callAPIKey(md))
+	if actor == "" {
+		actor = middleware.Anonymous
+	}
+
+	requestID := middleware.AdoptRequestID(first(md.Get(requestIDMetadata)))
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, requestID))
+
+	return audit.WithActor(logging.WithRequestID(ctx, requestID), actor)
+}
+
+func callAPIKey(md metadata.MD) string {
+	if key := first(md.Get(strings.ToLower(middleware.APIKeyHeader))); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(first(md.Get("authorization")), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func unaryInterceptor(adminKey string, keys *apikeys.Store) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		ctx = callContext(ctx, adminKey, keys)
+		start := time.Now()
+		defer func() {
+			if r := recover(); r != nil {
+				slog.ErrorContext(ctx, "grpc call panicked", "method", info.FullMethod, "panic", r)
+				err = status.Error(codes.Internal, "internal error")
+			}
+			logCall(ctx, info.FullMethod, start, err)
+		}()
+		return handler(ctx, req)
+	}
+}
+
+func streamInterceptor(adminKey string, keys *apikeys.Store) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx := callContext(ss.Context(), adminKey, keys)
+		start := time.Now()
+		defer func() {
+			if r := recover(); r != nil {
+				slog.ErrorContext(ctx, "grpc call panicked", "method", info.FullMethod, "panic", r)
+				err = status.Error(codes.Internal, "internal error")
+			}
+			logCall(ctx, info.FullMethod, start, err)
+		}()
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream is a stream whose context names its caller.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// logCall logs one line per call once it has been handled, at the levels the
+// REST access log uses for the matching HTTP statuses.
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+
+	level := slog.LevelInfo
+	switch code {
+	case codes.OK, codes.Canceled:
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		level = slog.LevelError
+	default:
+		level = slog.LevelWarn
+	}
+
+	slog.Default().LogAttrs(ctx, level, "grpc call",
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Duration("duration", time.Since(start)),
+	)
+}
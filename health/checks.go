@@ -0,0 +1,49 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/AllanM007/simpler-test/migrations"
+	"gorm.io/gorm"
+)
+
+var ErrShuttingDown = errors.New("service is shutting down")
+
+// Database pings the database behind db.
+func Database(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// Migrations fails until the schema is at the latest version known to the
+// binary.
+func Migrations(migrator *migrations.Migrator) Check {
+	return func(ctx context.Context) error {
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if latest := migrator.Latest(); version != latest {
+			return fmt.Errorf("schema is at version %d, expected %d", version, latest)
+		}
+		return nil
+	}
+}
+
+// Running fails once serving is done, so load balancers stop routing new
+// requests while in-flight ones drain.
+func Running(serving context.Context) Check {
+	return func(ctx context.Context) error {
+		if serving.Err() != nil {
+			return ErrShuttingDown
+		}
+		return nil
+	}
+}
@@ -0,0 +1,131 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "UP"
+	StatusDown = "DOWN"
+)
+
+// Check reports an error when the component it probes is unhealthy. Checks
+// must return once ctx is done.
+type Check func(ctx context.Context) error
+
+type Component struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the outcome of running a set of checks. It is UP only when every
+// component is UP.
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components"`
+}
+
+func (r Report) Healthy() bool {
+	return r.Status == StatusUp
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Registry holds the liveness and readiness checks of the service. Components
+// register their own checks, so new dependencies only need to call
+// AddReadinessCheck when they are set up.
+type Registry struct {
+	Timeout time.Duration
+
+	mu        sync.RWMutex
+	liveness  []namedCheck
+	readiness []namedCheck
+}
+
+// NewRegistry returns an empty registry whose checks each get timeout to run.
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{Timeout: timeout}
+}
+
+// AddLivenessCheck registers a check that fails only when the process cannot
+// recover without a restart.
+func (r *Registry) AddLivenessCheck(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.liveness = append(r.liveness, namedCheck{name, check})
+}
+
+// AddReadinessCheck registers a check that fails while the service should not
+// receive traffic.
+func (r *Registry) AddReadinessCheck(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readiness = append(r.readiness, namedCheck{name, check})
+}
+
+func (r *Registry) Liveness(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]namedCheck(nil), r.liveness...)
+	r.mu.RUnlock()
+	return r.run(ctx, checks)
+}
+
+func (r *Registry) Readiness(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]namedCheck(nil), r.readiness...)
+	r.mu.RUnlock()
+	return r.run(ctx, checks)
+}
+
+// run executes checks concurrently, each bounded by the registry timeout.
+func (r *Registry) run(ctx context.Context, checks []namedCheck) Report {
+	report := Report{Status: StatusUp, Components: make(map[string]Component, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, r.Timeout)
+			defer cancel()
+
+			component := Component{Status: StatusUp}
+			if err := runCheck(checkCtx, c.check); err != nil {
+				component = Component{Status: StatusDown, Error: err.Error()}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[c.name] = component
+			if component.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// runCheck stops waiting for a check that ignores its context once the
+// context is done.
+func runCheck(ctx context.Context, check Check) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- check(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
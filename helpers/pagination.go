@@ -2,11 +2,15 @@ package helpers
 
 import (
 	"errors"
+	"fmt"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
+// MaxLimit is the largest page size listings return.
+const MaxLimit = 100
+
 func GetPagingData(ctx *gin.Context) (page, limit int, err error) {
 	page, err = strconv.Atoi(ctx.DefaultQuery("page", "1"))
 	if err != nil {
@@ -18,6 +22,10 @@ func GetPagingData(ctx *gin.Context) (page, limit int, err error) {
 		err = errors.New("incorrect limit format")
 		return
 	}
+	if limit > MaxLimit {
+		err = fmt.Errorf("limit must be at most %d", MaxLimit)
+		return
+	}
 	return
 }
 
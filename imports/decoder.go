@@ -0,0 +1,290 @@
+package imports
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Upload formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// formulaStarts are the characters that make spreadsheets run a value as a
+// formula.
+const formulaStarts = "=+-@\t\r"
+
+// EscapeCSVText prefixes a value that spreadsheets would run as a formula with
+// a quote, which they show as text. Values already starting with a quote are
+// prefixed too, so CSV uploads can undo the escaping exactly.
+func EscapeCSVText(value string) string {
+	if value != "" && strings.ContainsRune(formulaStarts+"'", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeCSVText undoes EscapeCSVText.
+func unescapeCSVText(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(formulaStarts+"'", rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+// Ignored is the type of a record field whose value is read and thrown away,
+// such as a read-only column of an export being uploaded again.
+type Ignored struct{}
+
+func (*Ignored) UnmarshalJSON([]byte) error {
+	return nil
+}
+
+var ignoredType = reflect.TypeOf(Ignored{})
+
+// RowError is a record that could not be decoded. Decoding can continue with
+// the next record.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Decoder reads an upload one record at a time, so uploads of any size are
+// decoded in constant memory.
+type Decoder interface {
+	// Decode stores the next record in v, a pointer to a struct of the type
+	// the decoder was made for. It returns io.EOF after the last record and a
+	// *RowError for a record that cannot be decoded. Any other error means the
+	// rest of the upload cannot be read.
+	Decode(v interface{}) error
+	// Line is the line of the upload the last record started on.
+	Line() int
+}
+
+// FormatOf returns the format of a file named fileName from its extension, or
+// an empty string when the extension names no format.
+func FormatOf(fileName string) string {
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".csv":
+		return FormatCSV
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON
+	}
+	return ""
+}
+
+// NewDecoder returns a decoder of r in the given format, into structs of the
+// type record points to, whose json tags name the fields of a record. CSV
+// uploads start with a header row naming the column of each field, and a
+// header naming a column that is not a field is rejected straight away. Text
+// escaped by EscapeCSVText is unescaped.
+func NewDecoder(format string, r io.Reader, record interface{}) (Decoder, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVDecoder(r, record)
+	case FormatNDJSON:
+		return &ndjsonDecoder{reader: bufio.NewReader(r)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q, expected %s or %s", format, FormatCSV, FormatNDJSON)
+	}
+}
+
+type csvDecoder struct {
+	reader  *csv.Reader
+	columns []string
+	line    int
+}
+
+func newCSVDecoder(r io.Reader, record interface{}) (*csvDecoder, error) {
+	fields, err := jsonFields(record)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("upload is empty, expected a header row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading header row: %w", err)
+	}
+
+	seen := map[string]bool{}
+	columns := make([]string, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if column == "" || seen[column] {
+			return nil, fmt.Errorf("header row has an empty or repeated column %q", column)
+		}
+		if _, ok := fields[column]; !ok {
+			names := make([]string, 0, len(fields))
+			for name := range fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("header row has an unknown column %q, expected %s", column, strings.Join(names, ", "))
+		}
+		seen[column] = true
+		columns[i] = column
+	}
+	return &csvDecoder{reader: reader, columns: columns}, nil
+}
+
+func (d *csvDecoder) Decode(v interface{}) error {
+	record, err := d.reader.Read()
+	if err == nil {
+		d.line, _ = d.reader.FieldPos(0)
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		d.line = parseErr.StartLine
+		return &RowError{Line: d.line, Err: parseErr.Err}
+	}
+	if err != nil {
+		return err
+	}
+
+	fields, err := jsonFields(v)
+	if err != nil {
+		return err
+	}
+	for i, column := range d.columns {
+		field, ok := fields[column]
+		if !ok {
+			return fmt.Errorf("unknown column %q", column)
+		}
+		if err := setField(field, strings.TrimSpace(record[i])); err != nil {
+			return &RowError{Line: d.line, Err: fmt.Errorf("%s: %w", column, err)}
+		}
+	}
+	return nil
+}
+
+func (d *csvDecoder) Line() int {
+	return d.line
+}
+
+type ndjsonDecoder struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func (d *ndjsonDecoder) Decode(v interface{}) error {
+	for {
+		data, err := d.reader.ReadBytes('\n')
+		if len(data) == 0 && err != nil {
+			return err
+		}
+		d.line++
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(v); err != nil {
+			return &RowError{Line: d.line, Err: err}
+		}
+		if decoder.More() {
+			return &RowError{Line: d.line, Err: errors.New("more than one value on the line")}
+		}
+		return nil
+	}
+}
+
+func (d *ndjsonDecoder) Line() int {
+	return d.line
+}
+
+// jsonFields maps the json names of the struct v points to to its fields,
+// including the fields of embedded structs like encoding/json does.
+func jsonFields(v interface{}) (map[string]reflect.Value, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot decode into %T, expected a pointer to a struct", v)
+	}
+
+	fields := map[string]reflect.Value{}
+	addFields(fields, value.Elem())
+	return fields, nil
+}
+
+func addFields(fields map[string]reflect.Value, value reflect.Value) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addFields(fields, value.Field(i))
+			continue
+		}
+		if name != "" && name != "-" {
+			fields[name] = value.Field(i)
+		}
+	}
+}
+
+// setField parses text into field. Empty text leaves the field unset.
+func setField(field reflect.Value, text string) error {
+	if text == "" || field.Type() == ignoredType {
+		return nil
+	}
+	if field.Kind() == reflect.Pointer {
+		field.Set(reflect.New(field.Type().Elem()))
+		field = field.Elem()
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(unescapeCSVText(text))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", text)
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", text)
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(text, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a number", text)
+		}
+		field.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", text)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("fields of type %s cannot be imported", field.Type())
+	}
+	return nil
+}
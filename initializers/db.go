@@ -1,30 +1,111 @@
 package initializers
 
 import (
+	"context"
+	"database/sql"
+	"expvar"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/logging"
 
-	"github.com/AllanM007/simpler-test/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func ConnectDB() (*gorm.DB, error) {
+// maxConnectBackoff caps the wait between connection attempts.
+const maxConnectBackoff = 30 * time.Second
+
+var (
+	pool        atomic.Pointer[sql.DB]
+	publishOnce sync.Once
+)
+
+// ConnectDB opens the connection pool, retrying with exponential backoff while
+// the database is unreachable, and configures the pool limits. It gives up
+// after the configured number of attempts or once ctx is done.
+func ConnectDB(ctx context.Context, cfg config.Database, timeZone string) (*gorm.DB, error) {
+	dsn := DSN(cfg, timeZone)
+	backoff := cfg.ConnectBackoff
+
+	var db *gorm.DB
 	var err error
-	dsn := fmt.Sprintf("host=%s user=%s password='%s' dbname=%s port=%s TimeZone=Africa/Nairobi", os.Getenv("DB_HOST"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"), os.Getenv("DB_PORT"))
+	for attempt := 1; ; attempt++ {
+		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+			Logger: logging.NewGormLogger(slog.Default(), cfg.SlowQuery),
+			//report unique violations as gorm.ErrDuplicatedKey
+			TranslateError: true,
+		})
+		if err == nil {
+			break
+		}
+		if attempt >= cfg.ConnectAttempts {
+			return nil, fmt.Errorf("connecting to database after %d attempts: %w", attempt, err)
+		}
+
+		slog.Warn("database connection failed, retrying",
+			"attempt", attempt, "attempts", cfg.ConnectAttempts, "backoff", backoff, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connecting to database: %w", ctx.Err())
+		}
+		backoff = min(2*backoff, maxConnectBackoff)
+	}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatalf("error connecting to database : error=%v", err)
+		return nil, err
 	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	publishPoolStats(sqlDB)
 
-	fmt.Printf("Database connection successfully established")
+	slog.Info("database connection established", "address", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)))
 	return db, nil
 }
 
-func MigrateDB(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&models.Product{},
-	)
+// DSN builds a postgres connection URL for the configuration. Every part is
+// escaped, so passwords and names may contain any character.
+func DSN(cfg config.Database, timeZone string) string {
+	query := url.Values{}
+	query.Set("sslmode", cfg.SSLMode)
+	if timeZone != "" {
+		query.Set("TimeZone", timeZone)
+	}
+	if cfg.StatementTimeout > 0 {
+		query.Set("statement_timeout", strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10))
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Path:     "/" + cfg.Name,
+		RawQuery: query.Encode(),
+	}
+	return dsn.String()
+}
+
+// publishPoolStats exposes the connection pool statistics of the most recent
+// connection as the "database" expvar.
+func publishPoolStats(sqlDB *sql.DB) {
+	pool.Store(sqlDB)
+	publishOnce.Do(func() {
+		expvar.Publish("database", expvar.Func(func() any {
+			if db := pool.Load(); db != nil {
+				return db.Stats()
+			}
+			return nil
+		}))
+	})
 }
@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// GormLogger routes GORM's logs through slog. Failed queries are logged as
+// errors, queries slower than SlowQuery as warnings and every other query at
+// debug level.
+type GormLogger struct {
+	Logger    *slog.Logger
+	SlowQuery time.Duration
+	Level     logger.LogLevel
+}
+
+func NewGormLogger(log *slog.Logger, slowQuery time.Duration) *GormLogger {
+	return &GormLogger{
+		Logger:    log,
+		SlowQuery: slowQuery,
+		Level:     logger.Info,
+	}
+}
+
+func (l *GormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	copy := *l
+	copy.Level = level
+	return &copy
+}
+
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.Level >= logger.Info {
+		l.Logger.InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.Level >= logger.Warn {
+		l.Logger.WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.Level >= logger.Error {
+		l.Logger.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.Level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	attrs := func() []any {
+		sql, rows := fc()
+		return []any{slog.String("sql", sql), slog.Int64("rows", rows), slog.Duration("elapsed", elapsed)}
+	}
+
+	switch {
+	//a missing row is an expected outcome, not a failed query
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.Level >= logger.Error:
+		l.Logger.ErrorContext(ctx, "query failed", append(attrs(), slog.String("error", err.Error()))...)
+	case l.SlowQuery > 0 && elapsed > l.SlowQuery && l.Level >= logger.Warn:
+		l.Logger.WarnContext(ctx, "slow query", append(attrs(), slog.Duration("threshold", l.SlowQuery))...)
+	case l.Level >= logger.Info && l.Logger.Enabled(ctx, slog.LevelDebug):
+		l.Logger.DebugContext(ctx, "query", attrs()...)
+	}
+}
@@ -1 +1,110 @@
 package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/AllanM007/simpler-test/apikeys"
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+	RoleAdmin    = "admin"
+	Anonymous    = "anonymous"
+
+	// APIKeyActorPrefix starts the actor of callers using a key issued with
+	// the apikey command, followed by the key name.
+	APIKeyActorPrefix = "apikey:"
+
+	roleContextKey  = "role"
+	actorContextKey = "actor"
+)
+
+// Authenticate marks requests carrying the admin API key or an active key from
+// keys, either in the X-API-Key header or as a bearer token, as admin
+// requests. Requests without a valid key continue anonymously. The request
+// context names the caller for audit entries.
+func Authenticate(adminKey string, keys *apikeys.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if actor := KeyActor(c.Request.Context(), adminKey, keys, requestAPIKey(c)); actor != "" {
+			c.Set(roleContextKey, RoleAdmin)
+			c.Set(actorContextKey, actor)
+		}
+		c.Request = c.Request.WithContext(audit.WithActor(c.Request.Context(), Actor(c)))
+		c.Next()
+	}
+}
+
+// RequireAdmin rejects requests that were not authenticated as admin.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsAdmin(c) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "UNAUTHORIZED", "message": "Admin API key required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func IsAdmin(c *gin.Context) bool {
+	return c.GetString(roleContextKey) == RoleAdmin
+}
+
+// ValidAPIKey reports whether key is the admin API key. No key is valid when
+// adminKey is empty.
+func ValidAPIKey(adminKey, key string) bool {
+	return adminKey != "" && key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) == 1
+}
+
+// KeyActor names the caller presenting key: admin for the admin API key and
+// apikey:<name> for an active key from keys. It returns an empty string for
+// any other key. Failed lookups are logged and treated as unknown keys.
+func KeyActor(ctx context.Context, adminKey string, keys *apikeys.Store, key string) string {
+	if ValidAPIKey(adminKey, key) {
+		return RoleAdmin
+	}
+	if keys == nil || key == "" {
+		return ""
+	}
+
+	record, err := keys.Lookup(ctx, key)
+	if err != nil {
+		if !errors.Is(err, apikeys.ErrNotFound) {
+			slog.WarnContext(ctx, "api key lookup failed", "error", err)
+		}
+		return ""
+	}
+	return APIKeyActorPrefix + record.Name
+}
+
+// AdminActor reports whether actor, as named by KeyActor, is an admin.
+func AdminActor(actor string) bool {
+	return actor == RoleAdmin || strings.HasPrefix(actor, APIKeyActorPrefix)
+}
+
+// Actor names the caller for audit purposes.
+func Actor(c *gin.Context) string {
+	if actor := c.GetString(actorContextKey); actor != "" {
+		return actor
+	}
+	if role := c.GetString(roleContextKey); role != "" {
+		return role
+	}
+	return Anonymous
+}
+
+func requestAPIKey(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
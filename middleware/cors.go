@@ -1,18 +1,132 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/gin-gonic/gin"
+)
+
+// CORS applies the configured cross-origin policy. Requests without an Origin
+// header are not cross-origin and pass through untouched. Allowed origins are
+// echoed back with Vary: Origin; an OPTIONS request carrying
+// Access-Control-Request-Method is answered as a preflight without reaching
+// the handlers.
+func CORS(cfg config.CORS) gin.HandlerFunc {
+	allowAny := false
+	var exact []string
+	var wildcards []wildcardOrigin
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			allowAny = true
+		} else if scheme, domain, ok := strings.Cut(origin, "://*."); ok {
+			wildcards = append(wildcards, wildcardOrigin{prefix: scheme + "://", suffix: "." + domain})
+		} else {
+			exact = append(exact, origin)
+		}
+	}
+
+	allowed := func(origin string) bool {
+		if allowAny {
+			return true
+		}
+		origin = strings.ToLower(origin)
+		for _, o := range exact {
+			if o == origin {
+				return true
+			}
+		}
+		for _, w := range wildcards {
+			if w.matches(origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
 
-func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		if !allowed(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
 			return
 		}
-		c.Next()
+
+		header.Set("Access-Control-Allow-Origin", origin)
+		if cfg.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposed != "" {
+				header.Set("Access-Control-Expose-Headers", exposed)
+			}
+			c.Next()
+			return
+		}
+
+		if !containsFold(cfg.AllowedMethods, c.GetHeader("Access-Control-Request-Method")) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		for _, requested := range strings.Split(c.GetHeader("Access-Control-Request-Headers"), ",") {
+			if requested = strings.TrimSpace(requested); requested != "" && !containsFold(cfg.AllowedHeaders, requested) {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+		}
+
+		header.Set("Access-Control-Allow-Methods", methods)
+		if headers != "" {
+			header.Set("Access-Control-Allow-Headers", headers)
+		}
+		header.Set("Access-Control-Max-Age", maxAge)
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// wildcardOrigin matches any subdomain of a domain, such as
+// https://shop.example.com for https://*.example.com, but not the domain
+// itself.
+type wildcardOrigin struct {
+	prefix string
+	suffix string
+}
+
+func (w wildcardOrigin) matches(origin string) bool {
+	host, ok := strings.CutPrefix(origin, w.prefix)
+	return ok && len(host) > len(w.suffix) && strings.HasSuffix(host, w.suffix)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
 	}
+	return false
 }
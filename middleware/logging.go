@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/AllanM007/simpler-test/logging"
+	"github.com/AllanM007/simpler-test/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits client supplied ids to short tokens that are safe to
+// log and echo back.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID adopts the caller's X-Request-ID, or generates one when it is
+// missing or malformed, and returns it in the response and the request
+// context.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := AdoptRequestID(c.GetHeader(RequestIDHeader))
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), requestID))
+		c.Next()
+	}
+}
+
+// AdoptRequestID returns the request id a caller supplied, or a new one when
+// it is missing or malformed.
+func AdoptRequestID(requestID string) string {
+	if !validRequestID.MatchString(requestID) {
+		return newRequestID()
+	}
+	return requestID
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// AccessLog logs one line per request once it has been handled. Server errors
+// are logged as errors and client errors as warnings.
+func AccessLog(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = metrics.UnmatchedRoute
+		}
+		status := c.Writer.Status()
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		logger.LogAttrs(c.Request.Context(), level, "request",
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		)
+	}
+}
+
+// Recover turns a panic in a handler into a logged error and a 500 response.
+func Recover(logger *slog.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		logger.ErrorContext(c.Request.Context(), "panic handling request",
+			slog.Any("error", err),
+			slog.String("stack", string(debug.Stack())),
+		)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"status": "INTERNAL_SERVER_ERROR", "message": "Internal server error"})
+	})
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/AllanM007/simpler-test/metrics"
+	"github.com/AllanM007/simpler-test/tracing"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TraceIDHeader = "X-Trace-Id"
+
+// Tracing starts a server span for every request, continuing the trace from
+// an incoming traceparent header. The trace id is returned in the X-Trace-Id
+// header and added to JSON error bodies as trace_id.
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracing.Tracer().Start(ctx, c.Request.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.URLPath(c.Request.URL.Path),
+			),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		traceID := tracing.TraceID(ctx)
+		writer := &traceIDWriter{ResponseWriter: c.Writer, traceID: traceID}
+		if traceID != "" {
+			c.Header(TraceIDHeader, traceID)
+			c.Writer = writer
+		}
+
+		c.Next()
+
+		writer.flush()
+		c.Writer = writer.ResponseWriter
+
+		route := c.FullPath()
+		if route == "" {
+			route = metrics.UnmatchedRoute
+		}
+		status := c.Writer.Status()
+		span.SetName(c.Request.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		for _, err := range c.Errors {
+			span.RecordError(err.Err)
+		}
+	}
+}
+
+// traceIDWriter holds back JSON error bodies so the trace id can be added to
+// them once the handler is done.
+type traceIDWriter struct {
+	gin.ResponseWriter
+	traceID  string
+	body     bytes.Buffer
+	buffered bool
+}
+
+func (w *traceIDWriter) Write(data []byte) (int, error) {
+	if w.holdBack() {
+		w.buffered = true
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *traceIDWriter) WriteString(s string) (int, error) {
+	if w.holdBack() {
+		w.buffered = true
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Unwrap lets http.ResponseController reach the connection, such as to lift
+// the write deadline for streams.
+func (w *traceIDWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *traceIDWriter) holdBack() bool {
+	return w.Status() >= http.StatusBadRequest && strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+}
+
+// flush writes the held back body, with trace_id added when it is a JSON
+// object.
+func (w *traceIDWriter) flush() {
+	if !w.buffered {
+		return
+	}
+
+	body := bytes.TrimSpace(w.body.Bytes())
+	if json.Valid(body) && len(body) > 1 && body[0] == '{' {
+		field, _ := json.Marshal(w.traceID)
+		separator := ","
+		if len(bytes.TrimSpace(body[1:len(body)-1])) == 0 {
+			separator = ""
+		}
+		object := append([]byte{}, body[:len(body)-1]...)
+		object = append(object, separator+`"trace_id":`...)
+		object = append(object, field...)
+		body = append(object, '}')
+	}
+	w.ResponseWriter.Write(body)
+}
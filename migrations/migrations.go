@@ -0,0 +1,331 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// files holds the Postgres migrations in sql, and the same migrations written
+// for SQLite, which test databases are built from, in sqlite/sql.
+//
+//go:embed sql/*.sql sqlite/sql/*.sql
+var files embed.FS
+
+// advisoryLockKey identifies the postgres advisory lock held while migrating so
+// replicas starting at the same time apply migrations one after another.
+const advisoryLockKey = 72_461_905
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// SchemaMigration is a row of the schema_migrations table.
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration
+}
+
+// New returns a migrator for the migrations embedded in the binary, written
+// for the dialect of db.
+func New(db *gorm.DB) (*Migrator, error) {
+	fsys := fs.FS(files)
+	if db.Dialector.Name() == "sqlite" {
+		sub, err := fs.Sub(files, "sqlite")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		DB:         db,
+		Migrations: migrations,
+	}, nil
+}
+
+// Load reads migrations named <version>_<name>.<up|down>.sql from the sql
+// directory of fsys, ordered by version. Every version needs both files.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		contents, err := fs.ReadFile(fsys, path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest is the version the schema is at once every migration is applied.
+func (m *Migrator) Latest() int {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Version returns the highest applied migration version, or zero when none
+// has been applied.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	db := m.DB.WithContext(ctx)
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+
+	var version int
+	err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	db := m.DB.WithContext(ctx)
+
+	applied := map[int]SchemaMigration{}
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		var rows []SchemaMigration
+		if err := db.Order("version").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			applied[row.Version] = row
+		}
+	}
+
+	statuses := make([]Status, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	//migrations applied by a newer binary
+	for _, row := range applied {
+		appliedAt := row.AppliedAt
+		statuses = append(statuses, Status{Version: row.Version, Name: row.Name, Applied: true, AppliedAt: &appliedAt})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// Up applies every pending migration and returns the versions applied.
+func (m *Migrator) Up(ctx context.Context) ([]int, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the given number of most recently applied migrations and
+// returns the versions rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]int, error) {
+	if steps < 1 {
+		return nil, errors.New("steps must be at least 1")
+	}
+
+	var changed []int
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		target := 0
+		if steps < len(applied) {
+			target = applied[len(applied)-steps-1]
+		}
+		changed, err = m.migrate(conn, applied, target)
+		return err
+	})
+	return changed, err
+}
+
+// To migrates up or down until the schema is at the given version and returns
+// the versions applied or rolled back.
+func (m *Migrator) To(ctx context.Context, version int) ([]int, error) {
+	if version != 0 && m.find(version) == nil {
+		return nil, fmt.Errorf("unknown migration version %d", version)
+	}
+
+	var changed []int
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		changed, err = m.migrate(conn, applied, version)
+		return err
+	})
+	return changed, err
+}
+
+// migrate rolls back applied migrations above target, newest first, then
+// applies pending migrations up to target, oldest first. Each migration runs
+// in its own transaction together with its schema_migrations bookkeeping.
+func (m *Migrator) migrate(conn *gorm.DB, applied []int, target int) ([]int, error) {
+	var changed []int
+
+	isApplied := map[int]bool{}
+	for _, version := range applied {
+		isApplied[version] = true
+	}
+
+	for i := len(applied) - 1; i >= 0 && applied[i] > target; i-- {
+		migration := m.find(applied[i])
+		if migration == nil {
+			return changed, fmt.Errorf("migration %d is applied but not known to this binary", applied[i])
+		}
+
+		err := conn.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return changed, fmt.Errorf("rolling back migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		changed = append(changed, migration.Version)
+	}
+
+	for _, migration := range m.Migrations {
+		if migration.Version > target || isApplied[migration.Version] {
+			continue
+		}
+
+		err := conn.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return changed, fmt.Errorf("applying migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		changed = append(changed, migration.Version)
+	}
+
+	return changed, nil
+}
+
+// locked runs fn on a single connection holding the migration advisory lock,
+// creating the schema_migrations table first if needed.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.DB.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if conn.Dialector.Name() == "postgres" {
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", advisoryLockKey).Error; err != nil {
+				return fmt.Errorf("acquiring migration lock: %w", err)
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", advisoryLockKey)
+		}
+
+		//SQLite only reads DATETIME columns back as times
+		timestamp := "TIMESTAMPTZ"
+		if conn.Dialector.Name() == "sqlite" {
+			timestamp = "DATETIME"
+		}
+		err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at ` + timestamp + ` NOT NULL
+		)`).Error
+		if err != nil {
+			return err
+		}
+
+		return fn(conn)
+	})
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.Migrations {
+		if m.Migrations[i].Version == version {
+			return &m.Migrations[i]
+		}
+	}
+	return nil
+}
+
+func appliedVersions(conn *gorm.DB) ([]int, error) {
+	var versions []int
+	err := conn.Model(&SchemaMigration{}).Order("version").Pluck("version", &versions).Error
+	return versions, err
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS products (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL,
+    price       DECIMAL NOT NULL,
+    stock_level BIGINT,
+    active      BOOLEAN DEFAULT true,
+    CONSTRAINT uni_products_name UNIQUE (name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
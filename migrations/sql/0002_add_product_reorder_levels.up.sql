@@ -0,0 +1,3 @@
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS reorder_point    BIGINT DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS reorder_quantity BIGINT DEFAULT 0;
@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS suppliers (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    name       TEXT NOT NULL,
+    email      TEXT,
+    phone      TEXT,
+    CONSTRAINT uni_suppliers_name UNIQUE (name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_suppliers_deleted_at ON suppliers (deleted_at);
+
+CREATE TABLE IF NOT EXISTS purchase_orders (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    supplier_id BIGINT NOT NULL,
+    status      TEXT NOT NULL DEFAULT 'DRAFT',
+    approved_at TIMESTAMPTZ,
+    received_at TIMESTAMPTZ,
+    CONSTRAINT fk_purchase_orders_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_orders_deleted_at ON purchase_orders (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_purchase_orders_supplier_id ON purchase_orders (supplier_id);
+
+CREATE TABLE IF NOT EXISTS purchase_order_lines (
+    id                BIGSERIAL PRIMARY KEY,
+    created_at        TIMESTAMPTZ,
+    updated_at        TIMESTAMPTZ,
+    deleted_at        TIMESTAMPTZ,
+    purchase_order_id BIGINT NOT NULL,
+    product_id        BIGINT NOT NULL,
+    quantity          BIGINT NOT NULL,
+    received_quantity BIGINT NOT NULL DEFAULT 0,
+    unit_cost         DECIMAL NOT NULL,
+    CONSTRAINT fk_purchase_orders_lines FOREIGN KEY (purchase_order_id) REFERENCES purchase_orders (id),
+    CONSTRAINT fk_purchase_order_lines_product FOREIGN KEY (product_id) REFERENCES products (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_order_lines_deleted_at ON purchase_order_lines (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_purchase_order_lines_purchase_order_id ON purchase_order_lines (purchase_order_id);
+CREATE INDEX IF NOT EXISTS idx_purchase_order_lines_product_id ON purchase_order_lines (product_id);
@@ -0,0 +1,5 @@
+-- product names only need to be unique among products that are not deleted
+ALTER TABLE products DROP CONSTRAINT IF EXISTS uni_products_name;
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_name_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_products_name ON products (name) WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+-- a failed event waits here for its retry, and a claimed event for the relay publishing it
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ;
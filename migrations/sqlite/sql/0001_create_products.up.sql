@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS products (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME,
+    updated_at  DATETIME,
+    deleted_at  DATETIME,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL,
+    price       REAL NOT NULL,
+    stock_level INTEGER,
+    active      BOOLEAN DEFAULT true,
+    CONSTRAINT uni_products_name UNIQUE (name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
@@ -0,0 +1,2 @@
+ALTER TABLE products ADD COLUMN reorder_point INTEGER DEFAULT 0;
+ALTER TABLE products ADD COLUMN reorder_quantity INTEGER DEFAULT 0;
@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS suppliers (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    name       TEXT NOT NULL,
+    email      TEXT,
+    phone      TEXT,
+    CONSTRAINT uni_suppliers_name UNIQUE (name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_suppliers_deleted_at ON suppliers (deleted_at);
+
+CREATE TABLE IF NOT EXISTS purchase_orders (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME,
+    updated_at  DATETIME,
+    deleted_at  DATETIME,
+    supplier_id INTEGER NOT NULL,
+    status      TEXT NOT NULL DEFAULT 'DRAFT',
+    approved_at DATETIME,
+    received_at DATETIME,
+    CONSTRAINT fk_purchase_orders_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_orders_deleted_at ON purchase_orders (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_purchase_orders_supplier_id ON purchase_orders (supplier_id);
+
+CREATE TABLE IF NOT EXISTS purchase_order_lines (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at        DATETIME,
+    updated_at        DATETIME,
+    deleted_at        DATETIME,
+    purchase_order_id INTEGER NOT NULL,
+    product_id        INTEGER NOT NULL,
+    quantity          INTEGER NOT NULL,
+    received_quantity INTEGER NOT NULL DEFAULT 0,
+    unit_cost         REAL NOT NULL,
+    CONSTRAINT fk_purchase_orders_lines FOREIGN KEY (purchase_order_id) REFERENCES purchase_orders (id),
+    CONSTRAINT fk_purchase_order_lines_product FOREIGN KEY (product_id) REFERENCES products (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_order_lines_deleted_at ON purchase_order_lines (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_purchase_order_lines_purchase_order_id ON purchase_order_lines (purchase_order_id);
+CREATE INDEX IF NOT EXISTS idx_purchase_order_lines_product_id ON purchase_order_lines (product_id);
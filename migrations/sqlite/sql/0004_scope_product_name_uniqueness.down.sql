@@ -0,0 +1,12 @@
+-- deleted products sharing a name with a live or newer deleted product are
+-- renamed, so every name is unique again
+UPDATE products SET name = name || ' (deleted ' || id || ')'
+WHERE deleted_at IS NOT NULL AND EXISTS (
+    SELECT 1 FROM products other
+    WHERE other.name = products.name AND other.id <> products.id
+      AND (other.deleted_at IS NULL OR other.id > products.id)
+);
+
+DROP INDEX IF EXISTS idx_products_name;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uni_products_name ON products (name);
@@ -0,0 +1,24 @@
+-- product names only need to be unique among products that are not deleted.
+-- SQLite cannot drop a table constraint, so the table is built again without it
+CREATE TABLE products_scoped (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at       DATETIME,
+    updated_at       DATETIME,
+    deleted_at       DATETIME,
+    name             TEXT NOT NULL,
+    description      TEXT NOT NULL,
+    price            REAL NOT NULL,
+    stock_level      INTEGER,
+    active           BOOLEAN DEFAULT true,
+    reorder_point    INTEGER DEFAULT 0,
+    reorder_quantity INTEGER DEFAULT 0
+);
+
+INSERT INTO products_scoped (id, created_at, updated_at, deleted_at, name, description, price, stock_level, active, reorder_point, reorder_quantity)
+SELECT id, created_at, updated_at, deleted_at, name, description, price, stock_level, active, reorder_point, reorder_quantity FROM products;
+
+DROP TABLE products;
+ALTER TABLE products_scoped RENAME TO products;
+
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_products_name ON products (name) WHERE deleted_at IS NULL;
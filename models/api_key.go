@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// APIKey is an admin API key issued with the apikey command. Only the SHA-256
+// hash of the key is stored; Prefix holds its first characters so that keys
+// can be told apart.
+type APIKey struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"uniqueIndex:idx_api_keys_name,where:revoked_at IS NULL;not null"`
+	Hash      string `gorm:"uniqueIndex:idx_api_keys_hash;not null"`
+	Prefix    string `gorm:"not null"`
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// FieldChange holds the value of a field before and after a change. Before is
+// null for created entities and After is null for deleted ones.
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditLog records a single change made through the API. Rows are only ever
+// inserted.
+type AuditLog struct {
+	ID         uint                   `gorm:"primaryKey"`
+	Actor      string                 `gorm:"not null"`
+	Action     string                 `gorm:"not null"`
+	EntityType string                 `gorm:"index:idx_audit_logs_entity;not null"`
+	EntityID   uint                   `gorm:"index:idx_audit_logs_entity;not null"`
+	Changes    map[string]FieldChange `gorm:"type:jsonb;serializer:json;not null"`
+	RequestID  string                 `gorm:"not null;default:''"`
+	CreatedAt  time.Time              `gorm:"index"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// OutboxEvent is a domain event waiting to be published. It is inserted in
+// the same transaction as the change it describes and marked published by
+// the relay once a publisher has accepted it. NextAttemptAt holds back an
+// event that failed until its retry is due, and one claimed by a relay until
+// that relay has published it.
+type OutboxEvent struct {
+	ID            uint      `gorm:"primaryKey"`
+	EventType     string    `gorm:"not null"`
+	AggregateType string    `gorm:"not null"`
+	AggregateID   uint      `gorm:"not null"`
+	Payload       string    `gorm:"type:jsonb;not null"`
+	Attempts      int       `gorm:"not null;default:0"`
+	LastError     string    `gorm:"not null;default:''"`
+	CreatedAt     time.Time `gorm:"not null"`
+	NextAttemptAt *time.Time
+	PublishedAt   *time.Time
+}
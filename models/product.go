@@ -7,9 +7,11 @@ import (
 type Product struct {
 	gorm.Model
 	// ID          uint    `gorm:"column:id;primary_key;auto_increment;" json:"id"`
-	Name        string  `gorm:"name;unique;not null"`
-	Description string  `gorm:"description;not null"`
-	Price       float64 `gorm:"price;not null"`
-	StockLevel  int     `gorm:"stockLevel"`
-	Active      bool    `gorm:"active;default:true"`
+	Name            string  `gorm:"name;uniqueIndex:idx_products_name,where:deleted_at IS NULL;not null"`
+	Description     string  `gorm:"description;not null"`
+	Price           float64 `gorm:"price;not null"`
+	StockLevel      int     `gorm:"stockLevel"`
+	ReorderPoint    int     `gorm:"reorderPoint;default:0"`
+	ReorderQuantity int     `gorm:"reorderQuantity;default:0"`
+	Active          bool    `gorm:"active;default:true"`
 }
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PurchaseOrderDraft             = "DRAFT"
+	PurchaseOrderApproved          = "APPROVED"
+	PurchaseOrderPartiallyReceived = "PARTIALLY_RECEIVED"
+	PurchaseOrderReceived          = "RECEIVED"
+)
+
+type PurchaseOrder struct {
+	gorm.Model
+	SupplierID uint `gorm:"supplierId;not null;index"`
+	Supplier   Supplier
+	Status     string `gorm:"status;not null;default:DRAFT"`
+	ApprovedAt *time.Time
+	ReceivedAt *time.Time
+	Lines      []PurchaseOrderLine
+}
+
+type PurchaseOrderLine struct {
+	gorm.Model
+	PurchaseOrderID  uint `gorm:"purchaseOrderId;not null;index"`
+	ProductID        uint `gorm:"productId;not null;index"`
+	Product          Product
+	Quantity         int     `gorm:"quantity;not null"`
+	ReceivedQuantity int     `gorm:"receivedQuantity;not null;default:0"`
+	UnitCost         float64 `gorm:"unitCost;not null"`
+}
+
+// Outstanding is the quantity ordered on the line that has not been received yet.
+func (l PurchaseOrderLine) Outstanding() int {
+	return l.Quantity - l.ReceivedQuantity
+}
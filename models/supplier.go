@@ -0,0 +1,12 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+type Supplier struct {
+	gorm.Model
+	Name  string `gorm:"name;unique;not null"`
+	Email string `gorm:"email"`
+	Phone string `gorm:"phone"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+const (
+	WebhookDeliveryPending   = "PENDING"
+	WebhookDeliverySucceeded = "SUCCEEDED"
+	WebhookDeliveryDead      = "DEAD"
+)
+
+// WebhookSubscription asks for the events of the listed types to be posted to
+// URL, signed with Secret.
+type WebhookSubscription struct {
+	ID         uint     `gorm:"primaryKey"`
+	URL        string   `gorm:"not null"`
+	EventTypes []string `gorm:"type:jsonb;serializer:json;not null"`
+	Secret     string   `gorm:"not null"`
+	Active     bool     `gorm:"not null;default:true"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Subscribes reports whether the subscription wants events of eventType.
+func (s WebhookSubscription) Subscribes(eventType string) bool {
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event to be posted to one subscription. It stays
+// PENDING while attempts are left, then becomes SUCCEEDED or DEAD.
+type WebhookDelivery struct {
+	ID             uint `gorm:"primaryKey"`
+	SubscriptionID uint `gorm:"not null;uniqueIndex:idx_webhook_deliveries_event"`
+	Subscription   WebhookSubscription
+	EventID        uint   `gorm:"not null;uniqueIndex:idx_webhook_deliveries_event"`
+	EventType      string `gorm:"not null"`
+	Payload        string `gorm:"type:jsonb;not null"`
+	Status         string `gorm:"not null;default:PENDING"`
+	Attempts       int    `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time
+	LastError      string `gorm:"not null;default:''"`
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	AttemptLog     []WebhookAttempt `gorm:"foreignKey:DeliveryID"`
+}
+
+// WebhookAttempt records a single attempt to post a delivery. StatusCode is
+// zero when no response was received.
+type WebhookAttempt struct {
+	ID         uint `gorm:"primaryKey"`
+	DeliveryID uint `gorm:"not null;index"`
+	StatusCode int
+	Error      string `gorm:"not null;default:''"`
+	DurationMs int64
+	CreatedAt  time.Time
+}
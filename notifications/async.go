@@ -0,0 +1,88 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// deliveryTimeout bounds a single delivery by the background worker.
+const deliveryTimeout = 10 * time.Second
+
+var (
+	ErrQueueFull = errors.New("low stock alert queue is full")
+	ErrClosed    = errors.New("low stock notifier is closed")
+)
+
+// AsyncNotifier queues alerts and delivers them to the wrapped notifier from
+// a background worker, so slow sinks such as webhooks never hold up a sale.
+type AsyncNotifier struct {
+	next   Notifier
+	alerts chan LowStockAlert
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncNotifier starts a worker delivering to next with room for
+// queueSize pending alerts.
+func NewAsyncNotifier(next Notifier, queueSize int) *AsyncNotifier {
+	n := &AsyncNotifier{
+		next:   next,
+		alerts: make(chan LowStockAlert, queueSize),
+		done:   make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// Notify queues the alert without waiting for delivery. Alerts are dropped
+// with ErrQueueFull when the queue is full.
+func (n *AsyncNotifier) Notify(ctx context.Context, alert LowStockAlert) error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.closed {
+		return ErrClosed
+	}
+
+	select {
+	case n.alerts <- alert:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting alerts and waits for the queued ones to be delivered
+// or for ctx to end, whichever comes first.
+func (n *AsyncNotifier) Close(ctx context.Context) error {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.alerts)
+	}
+	n.mu.Unlock()
+
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (n *AsyncNotifier) run() {
+	defer close(n.done)
+
+	for alert := range n.alerts {
+		ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+		if err := n.next.Notify(ctx, alert); err != nil {
+			slog.Error("failed to deliver low stock alert", "product_id", alert.ProductID, "error", err)
+		}
+		cancel()
+	}
+}
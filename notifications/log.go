@@ -0,0 +1,23 @@
+package notifications
+
+import (
+	"context"
+	"log/slog"
+)
+
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, alert LowStockAlert) error {
+	slog.WarnContext(ctx, "low stock alert",
+		"product_id", alert.ProductID,
+		"name", alert.Name,
+		"stock", alert.Stock,
+		"reorder_point", alert.ReorderPoint,
+		"reorder_quantity", alert.ReorderQuantity,
+	)
+	return nil
+}
@@ -0,0 +1,48 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+)
+
+const LowStockEvent = "low_stock"
+
+// LowStockAlert is emitted when a stock change takes a product from above
+// its reorder point to at or below it.
+type LowStockAlert struct {
+	Event           string    `json:"event"`
+	ProductID       uint      `json:"product_id"`
+	Name            string    `json:"name"`
+	PreviousStock   int       `json:"previous_stock"`
+	Stock           int       `json:"stock"`
+	ReorderPoint    int       `json:"reorder_point"`
+	ReorderQuantity int       `json:"reorder_quantity"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, alert LowStockAlert) error
+}
+
+// CrossedReorderPoint reports whether a stock change from previous to current
+// crossed the reorder point. A reorder point of zero disables alerts.
+func CrossedReorderPoint(previous, current, reorderPoint int) bool {
+	return reorderPoint > 0 && previous > reorderPoint && current <= reorderPoint
+}
+
+// New builds the notifier selected in the configuration, defaulting to log.
+func New(cfg config.LowStock) (Notifier, error) {
+	switch cfg.Notifier {
+	case "", "log":
+		return NewLogNotifier(), nil
+	case "webhook":
+		return NewWebhookNotifier(cfg.WebhookURL), nil
+	case "file":
+		return NewFileNotifier(cfg.FilePath), nil
+	default:
+		return nil, fmt.Errorf("unknown low stock notifier %q", cfg.Notifier)
+	}
+}
@@ -1,24 +1,42 @@
 package routes
 
 import (
-	"log"
+	"expvar"
+	"log/slog"
 	"net/http"
 
+	"github.com/AllanM007/simpler-test/apikeys"
+	"github.com/AllanM007/simpler-test/config"
 	"github.com/AllanM007/simpler-test/controllers"
-	"github.com/AllanM007/simpler-test/initializers"
+	"github.com/AllanM007/simpler-test/graphqlapi"
+	"github.com/AllanM007/simpler-test/health"
+	"github.com/AllanM007/simpler-test/metrics"
 	"github.com/AllanM007/simpler-test/middleware"
+	"github.com/AllanM007/simpler-test/notifications"
+	"github.com/AllanM007/simpler-test/stream"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"gorm.io/gorm"
 )
 
-func Router(db *gorm.DB) *gin.Engine {
-	app := gin.Default()
-
+func Router(db *gorm.DB, cfg *config.Config, notifier notifications.Notifier, stockStream *stream.Broker, checks *health.Registry) *gin.Engine {
 	// set gin mode to release
 	gin.SetMode(gin.ReleaseMode)
 
+	app := gin.New()
+
+	// identify, trace, measure and log every request, recovering from panics
+	logger := slog.Default()
+	app.Use(
+		middleware.RequestID(),
+		middleware.Tracing(),
+		middleware.Metrics(),
+		middleware.AccessLog(logger),
+		middleware.Recover(logger),
+	)
+	app.GET("/metrics", gin.WrapH(metrics.Handler()))
+
 	app.GET("/ping", func(ctx *gin.Context) {
 		ctx.String(
 			http.StatusOK,
@@ -26,23 +44,68 @@ func Router(db *gorm.DB) *gin.Engine {
 		)
 	})
 
+	HealthRepo := controllers.HealthRepository(checks)
+	app.GET("/healthz", HealthRepo.Liveness)
+	app.GET("/readyz", HealthRepo.Readiness)
+
 	// enable cors middleware to apply to all routes
-	app.Use(middleware.CORSMiddleware())
+	app.Use(middleware.CORS(cfg.CORS))
 
-	//initialize database migration from models
-	err := initializers.MigrateDB(db)
-	if err != nil {
-		log.Fatalf("database migration failed")
-	}
+	// identify admin callers from their api key
+	app.Use(middleware.Authenticate(cfg.Auth.AdminAPIKey, apikeys.NewStore(db)))
 
-	ProductsRepo := controllers.ProductsRepository(db)
+	ProductsRepo := controllers.ProductsRepository(db, notifier, cfg.Products)
+	InventoryRepo := controllers.InventoryRepository(db)
+	SuppliersRepo := controllers.SuppliersRepository(db)
+	PurchaseOrdersRepo := controllers.PurchaseOrdersRepository(db)
+	AdminRepo := controllers.AdminRepository(db, cfg.Products.PurgeRetentionDays)
+	AuditRepo := controllers.AuditRepository(db)
+	WebhooksRepo := controllers.WebhooksRepository(db)
+	StreamRepo := controllers.StreamRepository(stockStream, cfg.Stream.HeartbeatInterval)
+	ImportsRepo := controllers.ImportsRepository(db, notifier, cfg.Imports)
+	GraphQL := graphqlapi.NewHandler(db, ProductsRepo.ProductService, cfg.GraphQL)
 
 	app.POST("/api/v1/products", ProductsRepo.CreateProduct)
+	app.POST("/api/v1/products/import", middleware.RequireAdmin(), ImportsRepo.ImportProducts)
+	app.POST("/api/v1/products/batch", middleware.RequireAdmin(), ProductsRepo.BatchProducts)
 	app.GET("/api/v1/products", ProductsRepo.GetProducts)
+	app.GET("/api/v1/products/export", ProductsRepo.ExportProducts)
 	app.GET("/api/v1/products/:id", ProductsRepo.GetProductById)
 	app.PUT("/api/v1/products/:id", ProductsRepo.UpdateProduct)
 	app.PUT("/api/v1/products/:id/sale", ProductsRepo.ProductSale)
+	app.GET("/api/v1/stream/stock", StreamRepo.GetStockStream)
 	app.DELETE("/api/v1/products/:id", ProductsRepo.DeleteProduct)
+	app.POST("/api/v1/products/:id/restore", middleware.RequireAdmin(), ProductsRepo.RestoreProduct)
+	app.PUT("/api/v1/products/:id/activate", middleware.RequireAdmin(), ProductsRepo.ActivateProduct)
+	app.PUT("/api/v1/products/:id/deactivate", middleware.RequireAdmin(), ProductsRepo.DeactivateProduct)
+
+	admin := app.Group("/api/v1/admin", middleware.RequireAdmin())
+	admin.DELETE("/products/purge", AdminRepo.PurgeProducts)
+	admin.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+
+	app.GET("/api/v1/audit", middleware.RequireAdmin(), AuditRepo.GetAuditLogs)
+
+	webhooks := app.Group("/api/v1/webhooks", middleware.RequireAdmin())
+	webhooks.POST("", WebhooksRepo.CreateWebhook)
+	webhooks.GET("", WebhooksRepo.GetWebhooks)
+	webhooks.GET("/:id", WebhooksRepo.GetWebhookById)
+	webhooks.PUT("/:id", WebhooksRepo.UpdateWebhook)
+	webhooks.DELETE("/:id", WebhooksRepo.DeleteWebhook)
+	webhooks.GET("/:id/deliveries", WebhooksRepo.GetWebhookDeliveries)
+	webhooks.POST("/:id/deliveries/:delivery_id/redeliver", WebhooksRepo.RedeliverWebhook)
+
+	app.GET("/api/v1/inventory/low-stock", InventoryRepo.GetLowStock)
+	app.GET("/api/v1/inventory/outstanding", InventoryRepo.GetOutstandingOrders)
+
+	app.POST("/api/v1/suppliers", SuppliersRepo.CreateSupplier)
+	app.GET("/api/v1/suppliers", SuppliersRepo.GetSuppliers)
+
+	app.POST("/api/v1/purchase-orders", PurchaseOrdersRepo.CreatePurchaseOrder)
+	app.GET("/api/v1/purchase-orders/:id", PurchaseOrdersRepo.GetPurchaseOrderById)
+	app.PUT("/api/v1/purchase-orders/:id/approve", PurchaseOrdersRepo.ApprovePurchaseOrder)
+	app.PUT("/api/v1/purchase-orders/:id/receive", PurchaseOrdersRepo.ReceivePurchaseOrder)
+
+	app.POST("/graphql", GraphQL.Serve)
 
 	app.GET("/api/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
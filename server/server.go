@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+)
+
+// Hook releases a resource once the server has stopped serving requests,
+// such as a background worker or the database pool.
+type Hook func(ctx context.Context) error
+
+// New returns an HTTP server for handler with the configured timeouts.
+func New(cfg config.Server, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// Run listens on the server address and serves until ctx is done, then shuts
+// down as described for Serve. The hooks also run when the address cannot be
+// listened on.
+func Run(ctx context.Context, srv *http.Server, shutdownTimeout time.Duration, hooks ...Hook) error {
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return errors.Join(err, runHooks(shutdownCtx, hooks))
+	}
+	return Serve(ctx, srv, listener, shutdownTimeout, hooks...)
+}
+
+// Serve serves on listener until ctx is done. It then stops accepting
+// connections, waits up to shutdownTimeout for in-flight requests to finish
+// and runs the hooks in order with whatever time remains. Requests still
+// running at the deadline have their connections closed.
+func Serve(ctx context.Context, srv *http.Server, listener net.Listener, shutdownTimeout time.Duration, hooks ...Hook) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(listener)
+	}()
+
+	slog.Info("listening", "address", listener.Addr().String())
+
+	select {
+	case err := <-serveErr:
+		//the server failed before being asked to stop
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return errors.Join(err, runHooks(shutdownCtx, hooks))
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, waiting for in-flight requests", "timeout", shutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("draining requests: %w", err))
+		srv.Close()
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, err)
+	}
+	errs = append(errs, runHooks(shutdownCtx, hooks))
+
+	return errors.Join(errs...)
+}
+
+func runHooks(ctx context.Context, hooks []Hook) error {
+	var errs []error
+	for _, hook := range hooks {
+		errs = append(errs, hook(ctx))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,197 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/events"
+)
+
+// subscriberBuffer is how many messages a subscriber may fall behind by before
+// it is disconnected. Disconnected clients reconnect and resume from the
+// broker's buffer.
+const subscriberBuffer = 64
+
+// StockUpdate is the data of a stock message: a StockChanged event's payload
+// with the id and time of the event.
+type StockUpdate struct {
+	EventID uint `json:"event_id"`
+	events.StockChange
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Message is a stock update ready to be streamed. ID is what clients send back
+// as Last-Event-ID to resume after it.
+type Message struct {
+	ID        string
+	ProductID uint
+	Data      []byte
+}
+
+// Broker fans stock changes out to stream subscribers, keeping the most recent
+// ones so reconnecting clients can catch up on what they missed. Messages are
+// numbered in the order they were received; their ids also carry the time
+// the broker started so ids from before a restart are never mistaken for
+// current ones. Each instance's broker is fed every committed stock change by
+// its own outbox follower, so every instance streams all of them, each with
+// its own message ids.
+type Broker struct {
+	mu          sync.Mutex
+	epoch       string
+	next        uint64
+	recent      []Message
+	size        int
+	subscribers map[*Subscriber]struct{}
+	closed      bool
+}
+
+// Subscriber receives the messages about the products it selected, or about
+// every product if it selected none. Messages is closed when the subscriber
+// falls too far behind or the broker is closed.
+type Subscriber struct {
+	Messages <-chan Message
+
+	messages chan Message
+	products map[uint]bool
+}
+
+func (s *Subscriber) wants(productID uint) bool {
+	return len(s.products) == 0 || s.products[productID]
+}
+
+func NewBroker(cfg config.Stream) *Broker {
+	return &Broker{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		next:        1,
+		size:        cfg.BufferSize,
+		subscribers: map[*Subscriber]struct{}{},
+	}
+}
+
+// Published implements events.Listener, streaming StockChanged events and
+// ignoring all others.
+func (b *Broker) Published(event events.Event) {
+	if event.Type != events.StockChanged {
+		return
+	}
+
+	update := StockUpdate{EventID: event.ID, OccurredAt: event.OccurredAt}
+	if err := json.Unmarshal(event.Payload, &update.StockChange); err != nil {
+		slog.Error("failed to decode stock change", "event_id", event.ID, "error", err)
+		return
+	}
+	data, err := json.Marshal(update)
+	if err != nil {
+		slog.Error("failed to encode stock update", "event_id", event.ID, "error", err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	message := Message{ID: fmt.Sprintf("%s-%d", b.epoch, b.next), ProductID: update.ProductID, Data: data}
+	b.next++
+	b.recent = append(b.recent, message)
+	if len(b.recent) > b.size {
+		b.recent = b.recent[len(b.recent)-b.size:]
+	}
+
+	for subscriber := range b.subscribers {
+		if !subscriber.wants(message.ProductID) {
+			continue
+		}
+		select {
+		case subscriber.messages <- message:
+		default:
+			//never hold up the follower for a slow client, it resumes when it reconnects
+			b.remove(subscriber)
+		}
+	}
+}
+
+// Subscribe registers a subscriber to the given products, or to every product
+// if none are given. When lastEventID is set, the buffered messages published
+// after it are returned to be sent first; complete is false if some of them
+// are no longer buffered or lastEventID is unknown, and the client should
+// reload the current stock instead. Subscribe returns a nil subscriber once
+// the broker is closed.
+func (b *Broker) Subscribe(productIDs []uint, lastEventID string) (subscriber *Subscriber, missed []Message, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, nil, false
+	}
+
+	messages := make(chan Message, subscriberBuffer)
+	subscriber = &Subscriber{Messages: messages, messages: messages, products: map[uint]bool{}}
+	for _, id := range productIDs {
+		subscriber.products[id] = true
+	}
+	b.subscribers[subscriber] = struct{}{}
+
+	if lastEventID == "" {
+		return subscriber, nil, true
+	}
+	last, ok := b.sequence(lastEventID)
+	//the first buffered message must directly follow the last one received
+	if !ok || last >= b.next || last+1+uint64(len(b.recent)) < b.next {
+		return subscriber, nil, false
+	}
+	for _, message := range b.recent[len(b.recent)-int(b.next-last-1):] {
+		if subscriber.wants(message.ProductID) {
+			missed = append(missed, message)
+		}
+	}
+	return subscriber, missed, true
+}
+
+// sequence returns the number of a message id issued by this broker.
+func (b *Broker) sequence(id string) (uint64, bool) {
+	epoch, number, found := strings.Cut(id, "-")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+	sequence, err := strconv.ParseUint(number, 10, 64)
+	return sequence, err == nil
+}
+
+// Unsubscribe removes the subscriber. It is safe to call more than once.
+func (b *Broker) Unsubscribe(subscriber *Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(subscriber)
+}
+
+func (b *Broker) remove(subscriber *Subscriber) {
+	if _, ok := b.subscribers[subscriber]; ok {
+		delete(b.subscribers, subscriber)
+		close(subscriber.messages)
+	}
+}
+
+// Subscribers returns the number of connected subscribers.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// Close disconnects every subscriber and refuses new ones, so open streams end
+// when the server shuts down instead of holding it up.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for subscriber := range b.subscribers {
+		b.remove(subscriber)
+	}
+}
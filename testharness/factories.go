@@ -0,0 +1,65 @@
+package testharness
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/models"
+	"gorm.io/gorm"
+)
+
+// ProductOption changes a product built by ProductReq or CreateProduct.
+type ProductOption func(*controllers.ProductCreateReq)
+
+func WithDescription(description string) ProductOption {
+	return func(req *controllers.ProductCreateReq) {
+		req.Description = description
+	}
+}
+
+func WithPrice(price float64) ProductOption {
+	return func(req *controllers.ProductCreateReq) {
+		req.Price = price
+	}
+}
+
+func WithStock(stock int) ProductOption {
+	return func(req *controllers.ProductCreateReq) {
+		req.StockLevel = stock
+	}
+}
+
+func WithReorder(point, quantity int) ProductOption {
+	return func(req *controllers.ProductCreateReq) {
+		req.ReorderPoint = point
+		req.ReorderQuantity = quantity
+	}
+}
+
+// ProductReq returns a valid request creating a product called name, changed
+// by opts.
+func ProductReq(name string, opts ...ProductOption) controllers.ProductCreateReq {
+	req := controllers.ProductCreateReq{
+		Name:        name,
+		Description: "Product created by a test",
+		Price:       10,
+		StockLevel:  10,
+	}
+	for _, opt := range opts {
+		opt(&req)
+	}
+	return req
+}
+
+// CreateProduct creates the product of ProductReq in db through the product
+// service, with its audit entry and event, and returns it. The test fails
+// when the product cannot be created.
+func CreateProduct(t testing.TB, db *gorm.DB, name string, opts ...ProductOption) models.Product {
+	t.Helper()
+	product, err := controllers.NewProductService(db, nil).Create(context.Background(), ProductReq(name, opts...))
+	if err != nil {
+		t.Fatalf("error creating product %q: %v", name, err)
+	}
+	return product
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/apikeys"
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/events"
+	"github.com/AllanM007/simpler-test/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	ctx := context.Background()
+	keys := apikeys.NewStore(db)
+
+	key, record, err := keys.Create(ctx, "deploy-bot")
+	if err != nil {
+		t.Fatalf("error creating api key: %v", err)
+	}
+	assert.True(t, len(key) > len(record.Prefix))
+	assert.Equal(t, key[:len(record.Prefix)], record.Prefix)
+	assert.NotContains(t, record.Hash, key)
+
+	_, _, err = keys.Create(ctx, "deploy-bot")
+	assert.ErrorIs(t, err, apikeys.ErrDuplicateName)
+	_, _, err = keys.Create(ctx, "")
+	assert.ErrorIs(t, err, apikeys.ErrInvalidName)
+
+	//issued keys are admin keys, audited under their name
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/webhooks", controllers.WebhookCreateReq{
+		URL:        "http://localhost:9/hooks",
+		EventTypes: []string{events.ProductCreated},
+	}, map[string]string{"Authorization": "Bearer " + key})
+	if !assert.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String()) {
+		return
+	}
+	var created struct {
+		Data controllers.WebhookData `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	t.Cleanup(func() {
+		performRequest(t, router, http.MethodDelete, fmt.Sprintf("/api/v1/webhooks/%d", created.Data.Id), nil, adminHeaders)
+	})
+
+	entries := getAuditLogs(t, fmt.Sprintf("entity_type=webhook&entity_id=%d", created.Data.Id))
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, middleware.APIKeyActorPrefix+"deploy-bot", entries[0].Actor)
+	}
+
+	//unknown keys are anonymous
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/audit", nil, map[string]string{"Authorization": "Bearer " + key + "0"})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	revoked, err := keys.Revoke(ctx, "deploy-bot")
+	if assert.NoError(t, err) {
+		assert.NotNil(t, revoked.RevokedAt)
+	}
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/audit", nil, map[string]string{"Authorization": "Bearer " + key})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	_, err = keys.Revoke(ctx, "deploy-bot")
+	assert.ErrorIs(t, err, apikeys.ErrNotFound)
+
+	//the name is free again once its key is revoked
+	replacement, _, err := keys.Create(ctx, "deploy-bot")
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, key, replacement)
+		recorder = performRequest(t, router, http.MethodGet, "/api/v1/audit", nil, map[string]string{"Authorization": "Bearer " + replacement})
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	}
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigLayers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	contents := []byte(`
+server:
+  port: 9000
+database:
+  host: yaml-host
+  user: yaml-user
+  name: yaml-db
+  password: yaml-secret
+`)
+	if err := os.WriteFile(path, contents, 0o600); err != nil {
+		t.Fatalf("error writing config file: %v", err)
+	}
+
+	//environment overrides the file and flags override the environment
+	t.Setenv("DB_HOST", "env-host")
+	t.Setenv("DB_USER", "env-user")
+
+	cfg, rest, err := config.Load([]string{"-config", path, "-db-user", "flag-user", "up"})
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+
+	assert.Equal(t, []string{"up"}, rest)
+	assert.Equal(t, 9000, cfg.Server.Port)
+	assert.Equal(t, "env-host", cfg.Database.Host)
+	assert.Equal(t, "flag-user", cfg.Database.User)
+	assert.Equal(t, "yaml-db", cfg.Database.Name)
+	assert.Equal(t, 5432, cfg.Database.Port, "defaults apply to unset values")
+	assert.Equal(t, "log", cfg.LowStock.Notifier)
+}
+
+func TestLoadConfigDotenvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.env")
+	contents := []byte("DB_HOST=dotenv-host\nDB_USER=dotenv-user\nDB_NAME=dotenv-db\nSERVER_PORT=7000\n")
+	if err := os.WriteFile(path, contents, 0o600); err != nil {
+		t.Fatalf("error writing config file: %v", err)
+	}
+
+	cfg, _, err := config.Load([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	assert.Equal(t, "dotenv-host", cfg.Database.Host)
+	assert.Equal(t, 7000, cfg.Server.Port)
+}
+
+func TestConfigValidation(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.Port = 0
+	cfg.LowStock.Notifier = "webhook"
+	cfg.Database.SSLMode = "sometimes"
+	cfg.Database.ConnectAttempts = 0
+
+	err := cfg.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "SERVER_PORT")
+		assert.Contains(t, err.Error(), "DB_HOST is required")
+		assert.Contains(t, err.Error(), "LOW_STOCK_WEBHOOK_URL is required")
+		assert.Contains(t, err.Error(), "DB_SSLMODE")
+		assert.Contains(t, err.Error(), "DB_CONNECT_ATTEMPTS must be at least 1")
+	}
+
+	_, _, err = config.Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.Error(t, err, "an explicitly chosen config file must exist")
+}
+
+func TestConfigRedactsSecrets(t *testing.T) {
+	cfg := config.Default()
+	cfg.Database.Password = "hunter2"
+	cfg.Auth.AdminAPIKey = "admin-key"
+
+	printed := cfg.String()
+	assert.NotContains(t, printed, "hunter2")
+	assert.NotContains(t, printed, "admin-key")
+	assert.Contains(t, printed, "DB_PASSWORD=******")
+	assert.Contains(t, printed, "SERVER_PORT=8080")
+}
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func corsRouter() *gin.Engine {
+	cfg := config.Default().CORS
+	cfg.AllowedOrigins = []string{"https://admin.example.com", "https://*.shop.example.com"}
+	cfg.AllowCredentials = true
+	cfg.MaxAge = 5 * time.Minute
+
+	app := gin.New()
+	app.Use(middleware.CORS(cfg))
+	app.PATCH("/items", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	return app
+}
+
+func corsRequest(t *testing.T, app *gin.Engine, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(method, "/items", nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	if origin != "" {
+		request.Header.Set("Origin", origin)
+	}
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	app := corsRouter()
+
+	for _, origin := range []string{"https://admin.example.com", "https://eu.shop.example.com", "https://a.b.shop.example.com"} {
+		recorder := corsRequest(t, app, http.MethodPatch, origin, nil)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, origin, recorder.Header().Get("Access-Control-Allow-Origin"), origin)
+		assert.Equal(t, "true", recorder.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Contains(t, recorder.Header().Values("Vary"), "Origin")
+		assert.Contains(t, recorder.Header().Get("Access-Control-Expose-Headers"), "X-Request-ID")
+	}
+
+	for _, origin := range []string{"https://shop.example.com", "http://eu.shop.example.com", "https://evil.com", "https://admin.example.com.evil.com"} {
+		recorder := corsRequest(t, app, http.MethodPatch, origin, nil)
+		assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+
+	//same-origin and non-browser requests carry no Origin header
+	recorder := corsRequest(t, app, http.MethodPatch, "", nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, recorder.Header().Values("Vary"))
+}
+
+func TestCORSPreflight(t *testing.T) {
+	app := corsRouter()
+
+	recorder := corsRequest(t, app, http.MethodOptions, "https://admin.example.com", map[string]string{
+		"Access-Control-Request-Method":  http.MethodPatch,
+		"Access-Control-Request-Headers": "content-type, x-api-key",
+	})
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "https://admin.example.com", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, recorder.Header().Get("Access-Control-Allow-Methods"), http.MethodPatch)
+	assert.Contains(t, recorder.Header().Get("Access-Control-Allow-Headers"), "X-API-Key")
+	assert.Equal(t, "300", recorder.Header().Get("Access-Control-Max-Age"))
+
+	recorder = corsRequest(t, app, http.MethodOptions, "https://admin.example.com", map[string]string{
+		"Access-Control-Request-Method": http.MethodTrace,
+	})
+	assert.Equal(t, http.StatusForbidden, recorder.Code, "method not allowed")
+
+	recorder = corsRequest(t, app, http.MethodOptions, "https://admin.example.com", map[string]string{
+		"Access-Control-Request-Method":  http.MethodPatch,
+		"Access-Control-Request-Headers": "x-secret",
+	})
+	assert.Equal(t, http.StatusForbidden, recorder.Code, "header not allowed")
+
+	recorder = corsRequest(t, app, http.MethodOptions, "https://evil.com", map[string]string{
+		"Access-Control-Request-Method": http.MethodPatch,
+	})
+	assert.Equal(t, http.StatusForbidden, recorder.Code, "origin not allowed")
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+
+	//an OPTIONS request that is not a preflight is left to the router
+	recorder = corsRequest(t, app, http.MethodOptions, "", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestCORSDefaultPolicy(t *testing.T) {
+	request, err := http.NewRequest(http.MethodOptions, "/api/v1/products", nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	request.Header.Set("Origin", "https://any.example.org")
+	request.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "https://any.example.org", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Credentials"), "credentials are never allowed for any origin")
+}
+
+func TestCORSConfigValidation(t *testing.T) {
+	cfg := config.Default()
+	cfg.CORS.AllowCredentials = true
+	cfg.CORS.AllowedOrigins = []string{"*", "admin.example.com"}
+
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, "cannot contain * when CORS_ALLOW_CREDENTIALS is enabled")
+	assert.ErrorContains(t, err, `"admin.example.com" must include a scheme`)
+}
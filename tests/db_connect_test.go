@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/initializers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDSNEscapesCredentials(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.Host, cfg.User, cfg.Name = "db.internal", "inventory", "simpler"
+	cfg.Password = "p@ss w:rd/'?&="
+	cfg.SSLMode = "require"
+	cfg.StatementTimeout = 1500 * time.Millisecond
+
+	dsn, err := url.Parse(initializers.DSN(cfg, "Africa/Nairobi"))
+	if err != nil {
+		t.Fatalf("error parsing dsn: %v", err)
+	}
+
+	password, _ := dsn.User.Password()
+	assert.Equal(t, cfg.Password, password)
+	assert.Equal(t, "inventory", dsn.User.Username())
+	assert.Equal(t, "db.internal:5432", dsn.Host)
+	assert.Equal(t, "/simpler", dsn.Path)
+	assert.Equal(t, "require", dsn.Query().Get("sslmode"))
+	assert.Equal(t, "Africa/Nairobi", dsn.Query().Get("TimeZone"))
+	assert.Equal(t, "1500", dsn.Query().Get("statement_timeout"))
+}
+
+// unreachableDatabase returns a configuration pointing at a closed local port.
+func unreachableDatabase(t *testing.T) config.Database {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	cfg := config.Default().Database
+	cfg.Host, cfg.Port, cfg.User, cfg.Name = "127.0.0.1", port, "user", "testdb"
+	cfg.SSLMode = "disable"
+	cfg.ConnectBackoff = 10 * time.Millisecond
+	return cfg
+}
+
+func TestConnectDBRetries(t *testing.T) {
+	cfg := unreachableDatabase(t)
+	cfg.ConnectAttempts = 3
+
+	start := time.Now()
+	db, err := initializers.ConnectDB(context.Background(), cfg, "UTC")
+	assert.Nil(t, db)
+	assert.ErrorContains(t, err, "after 3 attempts")
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond, "waits 10ms then 20ms between attempts")
+}
+
+func TestConnectDBStopsWhenCancelled(t *testing.T) {
+	cfg := unreachableDatabase(t)
+	cfg.ConnectAttempts = 100
+	cfg.ConnectBackoff = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := initializers.ConnectDB(ctx, cfg, "UTC")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestDebugVarsRequireAdmin(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "/api/v1/admin/debug/vars", nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/admin/debug/vars", nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "memstats")
+}
@@ -1,9 +1,13 @@
+//go:build integration
+
 package tests
 
 import (
+	"context"
 	"log"
 	"testing"
 
+	"github.com/AllanM007/simpler-test/config"
 	"github.com/AllanM007/simpler-test/initializers"
 	"github.com/joho/godotenv"
 )
@@ -14,7 +18,11 @@ func TestDBConnection(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error loading .env file: %v", err)
 	}
-	db, err := initializers.ConnectDB()
+	cfg, _, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("Invalid database configuration: %v", err)
+	}
+	db, err := initializers.ConnectDB(context.Background(), cfg.Database, cfg.TimeZone)
 	if err != nil {
 		t.Fatalf("Failed to connect to database: %v", err)
 	}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthz(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "/healthz", nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var report health.Report
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, health.StatusUp, report.Status)
+}
+
+func TestReadyz(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var report health.Report
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, health.StatusUp, report.Status)
+	assert.Equal(t, health.StatusUp, report.Components["database"].Status)
+	assert.Equal(t, health.StatusUp, report.Components["migrations"].Status)
+}
+
+func TestReadinessReportsFailingComponents(t *testing.T) {
+	serving, stop := context.WithCancel(context.Background())
+
+	checks := health.NewRegistry(50 * time.Millisecond)
+	checks.AddReadinessCheck("database", health.Database(db))
+	checks.AddReadinessCheck("shutdown", health.Running(serving))
+	checks.AddReadinessCheck("broker", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	checks.AddReadinessCheck("cache", func(ctx context.Context) error {
+		//ignores its context, so only the registry timeout stops it
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	report := checks.Readiness(context.Background())
+	assert.False(t, report.Healthy())
+	assert.Equal(t, health.StatusUp, report.Components["database"].Status)
+	assert.Equal(t, health.StatusUp, report.Components["shutdown"].Status)
+	assert.Equal(t, health.Component{Status: health.StatusDown, Error: "connection refused"}, report.Components["broker"])
+	assert.Equal(t, health.StatusDown, report.Components["cache"].Status)
+
+	stop()
+	report = checks.Readiness(context.Background())
+	assert.Equal(t, health.Component{Status: health.StatusDown, Error: health.ErrShuttingDown.Error()}, report.Components["shutdown"])
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/logging"
+	"github.com/AllanM007/simpler-test/middleware"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// logLines decodes the JSON log lines written to buf.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("error decoding log line %q: %v", line, err)
+		}
+		lines = append(lines, record)
+	}
+	return lines
+}
+
+func TestRequestID(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "/ping", nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	request.Header.Set(middleware.RequestIDHeader, "checkout-42")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, "checkout-42", recorder.Header().Get(middleware.RequestIDHeader), "a valid caller id is kept")
+
+	request, err = http.NewRequest(http.MethodGet, "/ping", nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Regexp(t, "^[0-9a-f]{32}$", recorder.Header().Get(middleware.RequestIDHeader), "an id is generated when missing")
+
+	request, err = http.NewRequest(http.MethodGet, "/ping", nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	request.Header.Set(middleware.RequestIDHeader, "bad id\nwith newline")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Regexp(t, "^[0-9a-f]{32}$", recorder.Header().Get(middleware.RequestIDHeader), "a malformed id is replaced")
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(config.Log{Level: "info", Format: "json"}, &buf)
+
+	app := gin.New()
+	app.Use(middleware.RequestID(), middleware.AccessLog(logger), middleware.Recover(logger))
+	app.GET("/items/:id", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusNotFound, gin.H{"status": "NOT_FOUND"})
+	})
+	app.GET("/panic", func(ctx *gin.Context) {
+		panic("boom")
+	})
+
+	request, err := http.NewRequest(http.MethodGet, "/items/7", nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	request.Header.Set(middleware.RequestIDHeader, "access-log-test")
+	app.ServeHTTP(httptest.NewRecorder(), request)
+
+	request, err = http.NewRequest(http.MethodGet, "/panic", nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+
+	lines := logLines(t, &buf)
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, "request", lines[0]["msg"])
+		assert.Equal(t, "WARN", lines[0]["level"])
+		assert.Equal(t, "/items/:id", lines[0]["route"])
+		assert.Equal(t, "/items/7", lines[0]["path"])
+		assert.Equal(t, float64(http.StatusNotFound), lines[0]["status"])
+		assert.Equal(t, "access-log-test", lines[0]["request_id"])
+		assert.Contains(t, lines[0], "latency")
+		assert.Contains(t, lines[0], "client_ip")
+
+		assert.Equal(t, "panic handling request", lines[1]["msg"])
+		assert.Equal(t, "ERROR", lines[2]["level"])
+		assert.Equal(t, float64(http.StatusInternalServerError), lines[2]["status"])
+	}
+}
+
+func TestGormLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(config.Log{Level: "debug", Format: "json"}, &buf)
+	ctx := logging.WithRequestID(context.Background(), "gorm-log-test")
+
+	var count int64
+	session := db.Session(&gorm.Session{Logger: logging.NewGormLogger(logger, time.Hour)})
+	session.WithContext(ctx).Model(&models.Product{}).Count(&count)
+
+	lines := logLines(t, &buf)
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "query", lines[0]["msg"])
+		assert.Equal(t, "DEBUG", lines[0]["level"])
+		assert.Contains(t, lines[0]["sql"], "products")
+		assert.Equal(t, "gorm-log-test", lines[0]["request_id"])
+	}
+
+	//every query is slower than a nanosecond
+	buf.Reset()
+	session = db.Session(&gorm.Session{Logger: logging.NewGormLogger(logger, time.Nanosecond)})
+	session.WithContext(ctx).Model(&models.Product{}).Count(&count)
+
+	lines = logLines(t, &buf)
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "slow query", lines[0]["msg"])
+		assert.Equal(t, "WARN", lines[0]["level"])
+	}
+
+	buf.Reset()
+	session.WithContext(ctx).Exec("SELECT * FROM no_such_table")
+
+	lines = logLines(t, &buf)
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "query failed", lines[0]["msg"])
+		assert.Contains(t, lines[0], "error")
+	}
+}
@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/stream"
+	"github.com/AllanM007/simpler-test/testharness"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var db *gorm.DB
+var router *gin.Engine
+var stockStream *stream.Broker
+
+const adminAPIKey = "test-admin-key"
+
+// TestMain serves the API on the test database for all tests and cleans up
+// afterward. The database is an embedded SQLite one, or Postgres in a test
+// container when built with the integration tag.
+func TestMain(m *testing.M) {
+	testDB, cleanup, err := openTestDB()
+	if err != nil {
+		log.Fatalf("Could not set up the test database: %v", err)
+	}
+
+	harness, err := testharness.New(testDB, adminAPIKey)
+	if err != nil {
+		log.Fatalf("Could not set up the test router: %v", err)
+	}
+	//readiness also needs the schema of the test database to be current
+	harness.Checks.AddReadinessCheck("migrations", schemaCheck(testDB))
+	db, router, stockStream = harness.DB, harness.Router, harness.Stream
+
+	// Run tests
+	code := m.Run()
+
+	// Teardown the test database
+	cleanup()
+
+	// Exit with the code returned by m.Run()
+	os.Exit(code)
+}
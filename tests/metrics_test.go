@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/metrics"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	created := testutil.ToFloat64(metrics.ProductsCreated)
+	sold := testutil.ToFloat64(metrics.UnitsSold)
+	rejected := testutil.ToFloat64(metrics.SaleRejections.WithLabelValues(metrics.RejectedInsufficientStock))
+
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/products", controllers.ProductCreateReq{
+		Name:        "Metered Widget",
+		Description: "Product used to test business metrics",
+		Price:       10,
+		StockLevel:  5,
+	}, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	var product models.Product
+	if err := db.Where("name = ?", "Metered Widget").First(&product).Error; err != nil {
+		t.Fatalf("error fetching created product: %v", err)
+	}
+	saleUrl := fmt.Sprintf("/api/v1/products/%d/sale", product.ID)
+
+	recorder = performRequest(t, router, http.MethodPut, saleUrl, controllers.ProductSale{Id: int(product.ID), Count: 3}, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = performRequest(t, router, http.MethodPut, saleUrl, controllers.ProductSale{Id: int(product.ID), Count: 3}, nil)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	assert.Equal(t, created+1, testutil.ToFloat64(metrics.ProductsCreated))
+	assert.Equal(t, sold+3, testutil.ToFloat64(metrics.UnitsSold))
+	assert.Equal(t, rejected+1, testutil.ToFloat64(metrics.SaleRejections.WithLabelValues(metrics.RejectedInsufficientStock)))
+
+	performRequest(t, router, http.MethodGet, "/no/such/route/42", nil, nil)
+
+	recorder = performRequest(t, router, http.MethodGet, "/metrics", nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	//requests are labelled by route template, never by raw path
+	body := recorder.Body.String()
+	assert.Contains(t, body, `simpler_http_requests_total{method="PUT",route="/api/v1/products/:id/sale",status="200"}`)
+	assert.Contains(t, body, `simpler_http_requests_total{method="PUT",route="/api/v1/products/:id/sale",status="403"}`)
+	assert.Contains(t, body, `route="unmatched"`)
+	assert.NotContains(t, body, saleUrl)
+	assert.NotContains(t, body, "/no/such/route")
+	assert.Contains(t, body, "simpler_http_request_duration_seconds_bucket")
+	assert.Contains(t, body, "simpler_http_requests_in_flight")
+}
+
+func TestDatabasePoolMetrics(t *testing.T) {
+	assert.NoError(t, metrics.RegisterDB(db, "testdb"))
+
+	recorder := performRequest(t, router, http.MethodGet, "/metrics", nil, nil)
+	assert.Contains(t, recorder.Body.String(), `go_sql_open_connections{db_name="testdb"}`)
+}
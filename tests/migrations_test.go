@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/AllanM007/simpler-test/migrations"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/testharness"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrationFiles := fstest.MapFS{
+		"sql/0002_add_widgets.up.sql":      {Data: []byte("ALTER TABLE widgets ADD COLUMN size BIGINT;")},
+		"sql/0002_add_widgets.down.sql":    {Data: []byte("ALTER TABLE widgets DROP COLUMN size;")},
+		"sql/0001_create_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id BIGSERIAL PRIMARY KEY);")},
+		"sql/0001_create_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+	}
+
+	loaded, err := migrations.Load(migrationFiles)
+	assert.NoError(t, err)
+	assert.Len(t, loaded, 2)
+	assert.Equal(t, 1, loaded[0].Version)
+	assert.Equal(t, "create_widgets", loaded[0].Name)
+	assert.Equal(t, "DROP TABLE widgets;", loaded[0].Down)
+
+	delete(migrationFiles, "sql/0002_add_widgets.down.sql")
+	_, err = migrations.Load(migrationFiles)
+	assert.Error(t, err, "a migration without a down file is rejected")
+}
+
+func TestMigrationsRollBack(t *testing.T) {
+	ctx := context.Background()
+	sqlite, err := testharness.OpenSQLite(t.Name())
+	if err != nil {
+		t.Fatalf("error opening sqlite database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := sqlite.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	migrator, err := migrations.New(sqlite)
+	if err != nil {
+		t.Fatalf("error loading migrations: %v", err)
+	}
+
+	//names of deleted products can be taken again
+	deleted := testharness.CreateProduct(t, sqlite, "Migrated Widget")
+	assert.NoError(t, sqlite.Delete(&models.Product{}, deleted.ID).Error)
+	older := testharness.CreateProduct(t, sqlite, "Migrated Widget")
+	assert.NoError(t, sqlite.Delete(&models.Product{}, older.ID).Error)
+	live := testharness.CreateProduct(t, sqlite, "Migrated Widget")
+	err = sqlite.Create(&models.Product{Name: "Migrated Widget", Description: "Twin", Price: 1}).Error
+	assert.ErrorIs(t, err, gorm.ErrDuplicatedKey)
+
+	//rolling back the scoped uniqueness renames the deleted duplicates
+	rolledBack, err := migrator.To(ctx, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{9, 8, 7, 6, 5, 4}, rolledBack)
+	names := map[uint]string{}
+	var products []models.Product
+	assert.NoError(t, sqlite.Unscoped().Where("id IN ?", []uint{deleted.ID, older.ID, live.ID}).Find(&products).Error)
+	for _, product := range products {
+		names[product.ID] = product.Name
+	}
+	assert.Equal(t, map[uint]string{
+		deleted.ID: fmt.Sprintf("Migrated Widget (deleted %d)", deleted.ID),
+		older.ID:   fmt.Sprintf("Migrated Widget (deleted %d)", older.ID),
+		live.ID:    "Migrated Widget",
+	}, names)
+
+	//every migration rolls back and applies again
+	_, err = migrator.To(ctx, 0)
+	assert.NoError(t, err)
+	assert.False(t, sqlite.Migrator().HasTable(&models.Product{}))
+	applied, err := migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, applied, migrator.Latest())
+	assert.NoError(t, testharness.Schema(sqlite)(ctx))
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/notifications"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrossedReorderPoint(t *testing.T) {
+	assert.True(t, notifications.CrossedReorderPoint(12, 10, 10))
+	assert.True(t, notifications.CrossedReorderPoint(12, 3, 10))
+	assert.False(t, notifications.CrossedReorderPoint(9, 3, 10), "already below the reorder point")
+	assert.False(t, notifications.CrossedReorderPoint(20, 11, 10), "still above the reorder point")
+	assert.False(t, notifications.CrossedReorderPoint(5, 0, 0), "alerts disabled")
+}
+
+var lowStockAlert = notifications.LowStockAlert{
+	Event:           notifications.LowStockEvent,
+	ProductID:       7,
+	Name:            "Widget",
+	PreviousStock:   12,
+	Stock:           8,
+	ReorderPoint:    10,
+	ReorderQuantity: 50,
+}
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.ndjson")
+	notifier := notifications.NewFileNotifier(path)
+
+	assert.NoError(t, notifier.Notify(context.Background(), lowStockAlert))
+	assert.NoError(t, notifier.Notify(context.Background(), lowStockAlert))
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading alert file: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	assert.Len(t, lines, 2)
+
+	var alert notifications.LowStockAlert
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &alert))
+	assert.Equal(t, lowStockAlert.ProductID, alert.ProductID)
+	assert.Equal(t, lowStockAlert.Stock, alert.Stock)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received notifications.LowStockAlert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	notifier := notifications.NewWebhookNotifier(server.URL)
+	assert.NoError(t, notifier.Notify(context.Background(), lowStockAlert))
+	assert.Equal(t, lowStockAlert.Name, received.Name)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	assert.Error(t, notifications.NewWebhookNotifier(failing.URL).Notify(context.Background(), lowStockAlert))
+}
@@ -0,0 +1,115 @@
+//go:build integration
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/health"
+	"github.com/AllanM007/simpler-test/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func SetupTestContainerDB() (*gorm.DB, func(), error) {
+	ctx := context.Background()
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:13",
+		ExposedPorts: []string{"5432/tcp"},
+		Env: map[string]string{
+			"POSTGRES_USER":     "user",
+			"POSTGRES_PASSWORD": "password",
+			"POSTGRES_DB":       "testdb",
+		},
+		WaitingFor: wait.ForListeningPort("5432/tcp").WithStartupTimeout(60 * time.Second),
+	}
+	pgContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	host, _ := pgContainer.Host(ctx)
+	port, _ := pgContainer.MappedPort(ctx, "5432")
+
+	dsn := fmt.Sprintf("host=%s port=%s user=user password=password dbname=testdb sslmode=disable", host, port.Port())
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cleanup := func() {
+		pgContainer.Terminate(ctx)
+	}
+
+	return db, cleanup, nil
+}
+
+// openTestDB starts Postgres in a test container and applies the schema
+// migrations to it.
+func openTestDB() (*gorm.DB, func(), error) {
+	db, cleanup, err := SetupTestContainerDB()
+	if err != nil {
+		return nil, nil, fmt.Errorf("setting up postgres test container: %w", err)
+	}
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("loading migrations: %w", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("migrating test database: %w", err)
+	}
+	return db, cleanup, nil
+}
+
+func schemaCheck(db *gorm.DB) health.Check {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return func(ctx context.Context) error { return err }
+	}
+	return health.Migrations(migrator)
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	ctx := context.Background()
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("error loading migrations: %v", err)
+	}
+
+	version, err := migrator.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, migrator.Latest(), version)
+
+	rolledBack, err := migrator.Down(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{migrator.Latest()}, rolledBack)
+
+	statuses, err := migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.False(t, statuses[len(statuses)-1].Applied)
+
+	applied, err := migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{migrator.Latest()}, applied)
+
+	//migrating to the current version is a no-op
+	changed, err := migrator.To(ctx, migrator.Latest())
+	assert.NoError(t, err)
+	assert.Empty(t, changed)
+
+	_, err = migrator.To(ctx, 9999)
+	assert.Error(t, err)
+}
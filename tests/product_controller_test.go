@@ -2,99 +2,16 @@ package tests
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
-	"time"
 
 	"github.com/AllanM007/simpler-test/controllers"
 	"github.com/AllanM007/simpler-test/models"
-	"github.com/AllanM007/simpler-test/routes"
-	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"github.com/testcontainers/testcontainers-go"
-	"github.com/testcontainers/testcontainers-go/wait"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
-func SetupTestContainerDB() (*gorm.DB, func(), error) {
-	ctx := context.Background()
-	req := testcontainers.ContainerRequest{
-		Image:        "postgres:13",
-		ExposedPorts: []string{"5432/tcp"},
-		Env: map[string]string{
-			"POSTGRES_USER":     "user",
-			"POSTGRES_PASSWORD": "password",
-			"POSTGRES_DB":       "testdb",
-		},
-		WaitingFor: wait.ForListeningPort("5432/tcp").WithStartupTimeout(60 * time.Second),
-	}
-	pgContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
-		ContainerRequest: req,
-		Started:          true,
-	})
-	if err != nil {
-		return nil, nil, err
-	}
-
-	host, _ := pgContainer.Host(ctx)
-	port, _ := pgContainer.MappedPort(ctx, "5432")
-
-	dsn := fmt.Sprintf("host=%s port=%s user=user password=password dbname=testdb sslmode=disable", host, port.Port())
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, nil, err
-	}
-
-	cleanup := func() {
-		pgContainer.Terminate(ctx)
-	}
-
-	return db, cleanup, nil
-}
-
-var db *gorm.DB
-var router *gin.Engine
-var cleanup func()
-
-// TestMain sets up the test container for all tests and cleans up afterward.
-func TestMain(m *testing.M) {
-	// Setup: Initialize the PostgreSQL container
-	var err error
-	db, cleanup, err = SetupTestContainerDB()
-	if err != nil {
-		log.Fatalf("Could not set up postgres test container: %v", err)
-	}
-
-	//initialize gin router
-	router = routes.Router(db)
-
-	// Wait for the server to be ready with a ping check
-	maxRetries := 10
-	for i := 0; i < maxRetries; i++ {
-		resp, err := http.Get("http://localhost:8080/ping")
-		if err == nil && resp.StatusCode == http.StatusOK {
-			break
-		}
-		time.Sleep(1 * time.Second)
-	}
-
-	// Run tests
-	code := m.Run()
-
-	// Teardown the test container
-	cleanup()
-
-	// Exit with the code returned by m.Run()
-	os.Exit(code)
-}
-
 func TestPing(t *testing.T) {
 
 	recorder := httptest.NewRecorder()
@@ -181,6 +98,20 @@ func TestGetProducts(t *testing.T) {
 	assert.NotEmpty(t, products.Data.Products)
 }
 
+func TestGetProductsLimit(t *testing.T) {
+	for limit, code := range map[string]int{"100": http.StatusOK, "101": http.StatusBadRequest, "ten": http.StatusBadRequest} {
+		recorder := httptest.NewRecorder()
+
+		request, err := http.NewRequest(http.MethodGet, "/api/v1/products?limit="+limit, nil)
+		if err != nil {
+			t.Fatalf("error building request: %v", err)
+		}
+
+		router.ServeHTTP(recorder, request)
+		assert.Equal(t, code, recorder.Code, "limit %s", limit)
+	}
+}
+
 type ProductResponse struct {
 	Status string                  `json:"status"`
 	Data   controllers.ProductData `json:"data"`
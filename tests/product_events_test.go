@@ -0,0 +1,367 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/events"
+	"github.com/AllanM007/simpler-test/metrics"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/testharness"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingPublisher keeps published events and fails those of the products
+// in failing.
+type recordingPublisher struct {
+	mu        sync.Mutex
+	published []events.Event
+	failing   map[uint]bool
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event events.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failing[event.AggregateID] {
+		return errors.New("consumer unavailable")
+	}
+	p.published = append(p.published, event)
+	return nil
+}
+
+func (p *recordingPublisher) forProduct(productId uint) []events.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var matching []events.Event
+	for _, event := range p.published {
+		if event.AggregateID == productId {
+			matching = append(matching, event)
+		}
+	}
+	return matching
+}
+
+// newTestRelay returns a relay publishing to a fresh recording publisher, after
+// publishing every event left over by other tests.
+func newTestRelay(t *testing.T) (*events.Relay, *recordingPublisher) {
+	cfg := config.Default().Events
+	retryNow(t)
+	if _, err := events.NewRelay(db, &recordingPublisher{}, cfg).PublishPending(context.Background()); err != nil {
+		t.Fatalf("error draining outbox: %v", err)
+	}
+
+	publisher := &recordingPublisher{failing: map[uint]bool{}}
+	return events.NewRelay(db, publisher, cfg), publisher
+}
+
+// retryNow makes every unpublished event due, as if its retry or claim had
+// run out.
+func retryNow(t *testing.T) {
+	if err := db.Model(&models.OutboxEvent{}).Where("published_at IS NULL").Update("next_attempt_at", nil).Error; err != nil {
+		t.Fatalf("error rescheduling outbox events: %v", err)
+	}
+}
+
+func createEventProduct(t *testing.T, name string, stock int) models.Product {
+	return testharness.CreateProduct(t, db, name,
+		testharness.WithDescription("Product used to test domain events"),
+		testharness.WithPrice(6),
+		testharness.WithStock(stock),
+	)
+}
+
+func sellProduct(t *testing.T, product models.Product, count int) *httptest.ResponseRecorder {
+	return performRequest(t, router, http.MethodPut, fmt.Sprintf("/api/v1/products/%d/sale", product.ID), controllers.ProductSale{Id: int(product.ID), Count: count}, nil)
+}
+
+func TestProductEvents(t *testing.T) {
+	relay, publisher := newTestRelay(t)
+
+	product := createEventProduct(t, "Evented Widget", 10)
+
+	recorder := performRequest(t, router, http.MethodPut, fmt.Sprintf("/api/v1/products/%d", product.ID), controllers.ProductUpdateReq{
+		Name:        ptr("Evented Gadget"),
+		Description: ptr("Product used to test domain events"),
+	}, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.Equal(t, http.StatusOK, sellProduct(t, product, 4).Code)
+
+	//rejected sales change nothing and emit nothing
+	assert.Equal(t, http.StatusForbidden, sellProduct(t, product, 400).Code)
+
+	recorder = performRequest(t, router, http.MethodDelete, fmt.Sprintf("/api/v1/products/%d", product.ID), nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.Empty(t, publisher.forProduct(product.ID), "events are only published by the relay")
+
+	published, err := relay.PublishPending(context.Background())
+	if err != nil {
+		t.Fatalf("error publishing events: %v", err)
+	}
+	assert.Equal(t, 5, published)
+
+	received := publisher.forProduct(product.ID)
+	var types []string
+	for _, event := range received {
+		types = append(types, event.Type)
+		assert.Equal(t, events.AggregateProduct, event.AggregateType)
+	}
+	assert.Equal(t, []string{events.ProductCreated, events.ProductUpdated, events.StockChanged, events.SaleCompleted, events.ProductDeleted}, types)
+	if len(received) != 5 {
+		return
+	}
+
+	var updated events.Product
+	assert.NoError(t, json.Unmarshal(received[1].Payload, &updated))
+	assert.Equal(t, "Evented Gadget", updated.Name)
+
+	var change events.StockChange
+	assert.NoError(t, json.Unmarshal(received[2].Payload, &change))
+	assert.Equal(t, events.StockChange{ProductID: product.ID, PreviousStock: 10, Stock: 6, Reason: events.ReasonSale}, change)
+
+	var sale events.Sale
+	assert.NoError(t, json.Unmarshal(received[3].Payload, &sale))
+	assert.Equal(t, events.Sale{ProductID: product.ID, Quantity: 4, UnitPrice: 6, Stock: 6}, sale)
+
+	//published events are not published again
+	published, err = relay.PublishPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, published)
+}
+
+func TestProductEventsRetriedInOrder(t *testing.T) {
+	relay, publisher := newTestRelay(t)
+
+	stalled := createEventProduct(t, "Stalled Event Widget", 10)
+	flowing := createEventProduct(t, "Flowing Event Widget", 10)
+	assert.Equal(t, http.StatusOK, sellProduct(t, stalled, 1).Code)
+	assert.Equal(t, http.StatusOK, sellProduct(t, flowing, 1).Code)
+
+	//a failing event holds back later events of the same product only
+	publisher.failing[stalled.ID] = true
+	published, err := relay.PublishPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, published)
+	assert.Empty(t, publisher.forProduct(stalled.ID))
+	assert.Len(t, publisher.forProduct(flowing.ID), 3)
+
+	var failed models.OutboxEvent
+	if err := db.Where("aggregate_id = ?", stalled.ID).Order("id ASC").First(&failed).Error; err != nil {
+		t.Fatalf("error fetching outbox event: %v", err)
+	}
+	assert.Equal(t, events.ProductCreated, failed.EventType)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "consumer unavailable", failed.LastError)
+	assert.Nil(t, failed.PublishedAt)
+	assert.NotNil(t, failed.NextAttemptAt)
+
+	//the failed event is not retried before its backoff runs out
+	delete(publisher.failing, stalled.ID)
+	published, err = relay.PublishPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, published)
+
+	//once it is due the held back events follow in order
+	retryNow(t)
+	published, err = relay.PublishPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, published)
+
+	var types []string
+	for _, event := range publisher.forProduct(stalled.ID) {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{events.ProductCreated, events.StockChanged, events.SaleCompleted}, types)
+}
+
+func TestFailingEventsRetriedWithBackoff(t *testing.T) {
+	relay, publisher := newTestRelay(t)
+	relay.RetryBackoff = time.Minute
+	relay.MaxBackoff = 3 * time.Minute
+	relay.AlertAttempts = 2
+
+	failing := createEventProduct(t, "Backoff Event Widget", 10)
+	assert.Equal(t, http.StatusOK, sellProduct(t, failing, 1).Code)
+
+	//the wait doubles after every failure up to the maximum, and the event is never given up on
+	failures := testutil.ToFloat64(metrics.EventPublishFailures.WithLabelValues(events.ProductCreated))
+	publisher.failing[failing.ID] = true
+	for i, wait := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		retryNow(t)
+		started := time.Now()
+		published, err := relay.PublishPending(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, published)
+
+		var event models.OutboxEvent
+		if err := db.Where("aggregate_id = ? AND event_type = ?", failing.ID, events.ProductCreated).First(&event).Error; err != nil {
+			t.Fatalf("error fetching outbox event: %v", err)
+		}
+		assert.Equal(t, i+1, event.Attempts)
+		assert.Nil(t, event.PublishedAt)
+		if assert.NotNil(t, event.NextAttemptAt) {
+			assert.WithinDuration(t, started.Add(wait), *event.NextAttemptAt, 5*time.Second)
+		}
+	}
+	assert.Equal(t, failures+4, testutil.ToFloat64(metrics.EventPublishFailures.WithLabelValues(events.ProductCreated)))
+
+	//the product's later events waited, and follow the failed one in order
+	var held []models.OutboxEvent
+	if err := db.Where("aggregate_id = ? AND event_type <> ?", failing.ID, events.ProductCreated).Find(&held).Error; err != nil {
+		t.Fatalf("error fetching outbox events: %v", err)
+	}
+	assert.Len(t, held, 2)
+	for _, event := range held {
+		assert.Equal(t, 0, event.Attempts)
+		assert.Nil(t, event.PublishedAt)
+	}
+
+	delete(publisher.failing, failing.ID)
+	retryNow(t)
+	published, err := relay.PublishPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, published)
+
+	var types []string
+	for _, event := range publisher.forProduct(failing.ID) {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{events.ProductCreated, events.StockChanged, events.SaleCompleted}, types)
+}
+
+func TestClaimedEventsHeldForTheirRelay(t *testing.T) {
+	relay, publisher := newTestRelay(t)
+
+	product := createEventProduct(t, "Claimed Event Widget", 10)
+	assert.Equal(t, http.StatusOK, sellProduct(t, product, 1).Code)
+
+	//another relay has claimed the product's first event and is still publishing it
+	var first models.OutboxEvent
+	if err := db.Where("aggregate_id = ?", product.ID).Order("id ASC").First(&first).Error; err != nil {
+		t.Fatalf("error fetching outbox event: %v", err)
+	}
+	if err := db.Model(&first).Update("next_attempt_at", time.Now().Add(time.Minute)).Error; err != nil {
+		t.Fatalf("error claiming outbox event: %v", err)
+	}
+
+	published, err := relay.PublishPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, published)
+	assert.Empty(t, publisher.forProduct(product.ID))
+
+	//once the claim runs out the events are published in order
+	retryNow(t)
+	published, err = relay.PublishPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, published)
+	assert.Len(t, publisher.forProduct(product.ID), 3)
+}
+
+// recordingListener keeps the ids of the events it is told about.
+type recordingListener struct {
+	mu  sync.Mutex
+	ids []uint
+}
+
+func (l *recordingListener) Published(event events.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ids = append(l.ids, event.ID)
+}
+
+func (l *recordingListener) received() []uint {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]uint(nil), l.ids...)
+}
+
+func TestFollowerPassesOnLateEvents(t *testing.T) {
+	listener := &recordingListener{}
+	follower := events.NewFollower(db, config.Default().Events, listener)
+
+	//the first check only finds where the outbox ends
+	createEventProduct(t, "Earlier Followed Widget", 1)
+	found, err := follower.Follow(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, found)
+
+	product := createEventProduct(t, "Followed Widget", 10)
+	assert.Equal(t, http.StatusOK, sellProduct(t, product, 1).Code)
+	var rows []models.OutboxEvent
+	if err := db.Where("aggregate_id = ?", product.ID).Order("id ASC").Find(&rows).Error; err != nil {
+		t.Fatalf("error fetching outbox events: %v", err)
+	}
+	if !assert.Len(t, rows, 3) {
+		return
+	}
+
+	//the stock change has not committed yet when the events after it are found
+	late := rows[1]
+	if err := db.Delete(&late).Error; err != nil {
+		t.Fatalf("error hiding outbox event: %v", err)
+	}
+	found, err = follower.Follow(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, found)
+	assert.Equal(t, []uint{rows[0].ID, rows[2].ID}, listener.received())
+
+	//it is passed on once it commits, whether or not it has been published
+	if err := db.Create(&late).Error; err != nil {
+		t.Fatalf("error committing outbox event: %v", err)
+	}
+	found, err = follower.Follow(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, found)
+	assert.Equal(t, []uint{rows[0].ID, rows[2].ID, late.ID}, listener.received())
+
+	found, err = follower.Follow(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, found)
+}
+
+func TestRelayRunsUntilClosed(t *testing.T) {
+	_, publisher := newTestRelay(t)
+	cfg := config.Default().Events
+	cfg.PollInterval = 10 * time.Millisecond
+	relay := events.NewRelay(db, publisher, cfg)
+	relay.Start()
+
+	product := createEventProduct(t, "Background Event Widget", 3)
+	assert.Eventually(t, func() bool {
+		return len(publisher.forProduct(product.ID)) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, relay.Close(ctx))
+	assert.NoError(t, relay.Close(ctx), "closing twice is harmless")
+}
+
+func TestEventPublisherSelection(t *testing.T) {
+	cfg := config.Default().Events
+	cfg.Publisher = "kafka"
+	_, err := events.New(cfg)
+	assert.Error(t, err)
+
+	invalid := config.Default()
+	invalid.Events.Publisher = "http"
+	invalid.Events.BatchSize = 0
+	invalid.Events.MaxBackoff = time.Millisecond
+	err = invalid.Validate()
+	assert.ErrorContains(t, err, "EVENTS_URL is required")
+	assert.ErrorContains(t, err, "EVENTS_BATCH_SIZE must be positive")
+	assert.ErrorContains(t, err, "EVENTS_MAX_BACKOFF cannot be shorter than EVENTS_RETRY_BACKOFF")
+}
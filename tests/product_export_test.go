@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/testharness"
+	"github.com/stretchr/testify/assert"
+)
+
+func exportedIds(products []controllers.ProductData) map[uint]controllers.ProductData {
+	ids := map[uint]controllers.ProductData{}
+	for _, product := range products {
+		ids[product.Id] = product
+	}
+	return ids
+}
+
+func TestExportProducts(t *testing.T) {
+	listed := createEventProduct(t, "Exported Widget", 12)
+	hidden := createEventProduct(t, "Exported Inactive Widget", 3)
+	deleted := createEventProduct(t, "Exported Deleted Widget", 3)
+	assert.Equal(t, http.StatusOK, performRequest(t, router, http.MethodPut, fmt.Sprintf("/api/v1/products/%d/deactivate", hidden.ID), nil, adminHeaders).Code)
+	assert.Equal(t, http.StatusOK, performRequest(t, router, http.MethodDelete, fmt.Sprintf("/api/v1/products/%d", deleted.ID), nil, nil).Code)
+
+	//csv exports have a header row and one row per product
+	recorder := performRequest(t, router, http.MethodGet, "/api/v1/products/export", nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename="products-\d{8}T\d{6}Z\.csv"$`, recorder.Header().Get("Content-Disposition"))
+
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	if assert.NoError(t, err) && assert.NotEmpty(t, records) {
+		assert.Equal(t, []string{"id", "name", "description", "price", "stock", "reorder_point", "reorder_quantity", "active", "created_at", "updated_at", "deleted_at"}, records[0])
+		rows := map[string][]string{}
+		for _, record := range records[1:] {
+			rows[record[0]] = record
+		}
+		assert.Equal(t, []string{"Exported Widget", "Product used to test domain events", "6", "12"}, rows[strconv.Itoa(int(listed.ID))][1:5])
+		assert.NotContains(t, rows, strconv.Itoa(int(hidden.ID)), "inactive products are only exported for admins")
+		assert.NotContains(t, rows, strconv.Itoa(int(deleted.ID)))
+	}
+
+	//ndjson exports hold one product per line
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/products/export?format=ndjson", nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/x-ndjson", recorder.Header().Get("Content-Type"))
+	var lines []controllers.ProductData
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		var product controllers.ProductData
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &product))
+		lines = append(lines, product)
+	}
+	exported := exportedIds(lines)
+	assert.Contains(t, exported, listed.ID)
+	assert.Contains(t, exported, hidden.ID)
+	assert.NotContains(t, exported, deleted.ID)
+
+	//json exports are a single array, with deleted products on request
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/products/export?format=json&include_deleted=true", nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var products []controllers.ProductData
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &products))
+	exported = exportedIds(products)
+	if assert.Contains(t, exported, deleted.ID) {
+		assert.NotNil(t, exported[deleted.ID].DeletedAt)
+	}
+	for i := 1; i < len(products); i++ {
+		assert.Less(t, products[i-1].Id, products[i].Id, "products are exported oldest first")
+	}
+
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/products/export?format=xlsx", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/products/export?include_deleted=true", nil, nil)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestExportProductsEscapesFormulas(t *testing.T) {
+	formula := testharness.CreateProduct(t, db, "=HYPERLINK(\"http://example.com\")", testharness.WithDescription("@SUM(A1:A9)"))
+	plain := testharness.CreateProduct(t, db, "Exported Plain Widget", testharness.WithDescription("Costs 5 - 10"))
+	quoted := testharness.CreateProduct(t, db, "'Exported Quoted Widget'", testharness.WithDescription("Plain"))
+
+	//cells spreadsheets would run as formulas are exported as text
+	recorder := performRequest(t, router, http.MethodGet, "/api/v1/products/export", nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	if !assert.NoError(t, err) {
+		return
+	}
+	rows := map[string][]string{}
+	for _, record := range records[1:] {
+		rows[record[0]] = record
+	}
+	assert.Equal(t, []string{"'=HYPERLINK(\"http://example.com\")", "'@SUM(A1:A9)"}, rows[strconv.Itoa(int(formula.ID))][1:3])
+	assert.Equal(t, []string{"Exported Plain Widget", "Costs 5 - 10"}, rows[strconv.Itoa(int(plain.ID))][1:3])
+	//a leading quote is escaped too, so imports can tell it from the escaping
+	assert.Equal(t, []string{"''Exported Quoted Widget'", "Plain"}, rows[strconv.Itoa(int(quoted.ID))][1:3])
+
+	//json exports are not opened in spreadsheets and stay unchanged
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/products/export?format=json", nil, adminHeaders)
+	var products []controllers.ProductData
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &products))
+	assert.Equal(t, formula.Name, exportedIds(products)[formula.ID].Name)
+}
+
+// brokenWriter is a response whose client disconnects after the first write.
+type brokenWriter struct {
+	*httptest.ResponseRecorder
+	writes int
+}
+
+func (w *brokenWriter) Write(data []byte) (int, error) {
+	w.writes++
+	if w.writes > 1 {
+		return 0, errors.New("client disconnected")
+	}
+	return w.ResponseRecorder.Write(data)
+}
+
+func TestExportProductsStopsOnDisconnect(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		createEventProduct(t, fmt.Sprintf("Disconnected Export Widget %d", i), 1)
+	}
+
+	request, err := http.NewRequest(http.MethodGet, "/api/v1/products/export?format=ndjson", nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	writer := &brokenWriter{ResponseRecorder: httptest.NewRecorder()}
+	router.ServeHTTP(writer, request)
+
+	//the export stops at the first failed write and releases its connection
+	assert.Equal(t, 2, writer.writes)
+	assert.Equal(t, 1, bytes.Count(writer.Body.Bytes(), []byte("\n")))
+	sqlDB, err := db.DB()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, sqlDB.Stats().InUse)
+	}
+}
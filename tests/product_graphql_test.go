@@ -0,0 +1,400 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/graphqlapi"
+	"github.com/AllanM007/simpler-test/middleware"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/notifications"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+type GraphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []GraphQLError  `json:"errors"`
+}
+
+type GraphQLProduct struct {
+	Id            string `json:"id"`
+	Name          string `json:"name"`
+	Stock         int    `json:"stock"`
+	Active        bool   `json:"active"`
+	LowStock      bool   `json:"lowStock"`
+	IncomingStock int    `json:"incomingStock"`
+	History       []struct {
+		Actor         string   `json:"actor"`
+		Action        string   `json:"action"`
+		ChangedFields []string `json:"changedFields"`
+	} `json:"history"`
+}
+
+// queryGraphQL posts query to the GraphQL endpoint, as admin when admin is
+// set, and decodes its data into data.
+func queryGraphQL(t *testing.T, admin bool, query string, variables map[string]interface{}, data interface{}) []GraphQLError {
+	var headers map[string]string
+	if admin {
+		headers = adminHeaders
+	}
+	recorder := performRequest(t, router, http.MethodPost, "/graphql", graphqlapi.Request{Query: query, Variables: variables}, headers)
+	if !assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String()) {
+		return nil
+	}
+
+	var response GraphQLResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if data != nil && len(response.Data) > 0 {
+		if err := json.Unmarshal(response.Data, data); err != nil {
+			t.Fatalf("error decoding data: %v", err)
+		}
+	}
+	return response.Errors
+}
+
+func errorCodes(errs []GraphQLError) []interface{} {
+	var codes []interface{}
+	for _, err := range errs {
+		codes = append(codes, err.Extensions["code"])
+	}
+	return codes
+}
+
+func TestGraphQLProducts(t *testing.T) {
+	var created struct {
+		CreateProduct GraphQLProduct `json:"createProduct"`
+	}
+	errs := queryGraphQL(t, false, `mutation Create($input: CreateProductInput!) {
+		createProduct(input: $input) { id name stock active lowStock }
+	}`, map[string]interface{}{"input": map[string]interface{}{
+		"name":         "GraphQL Widget",
+		"description":  "Created over GraphQL",
+		"price":        4.5,
+		"stock":        10,
+		"reorderPoint": 3,
+	}}, &created)
+	if !assert.Empty(t, errs) {
+		return
+	}
+	product := created.CreateProduct
+	assert.Equal(t, "GraphQL Widget", product.Name)
+	assert.Equal(t, 10, product.Stock)
+	assert.True(t, product.Active)
+	assert.False(t, product.LowStock)
+
+	var sold struct {
+		SellProduct GraphQLProduct `json:"sellProduct"`
+	}
+	errs = queryGraphQL(t, false, fmt.Sprintf(`mutation { sellProduct(id: %s, quantity: 7) { stock lowStock } }`, product.Id), nil, &sold)
+	assert.Empty(t, errs)
+	assert.Equal(t, 3, sold.SellProduct.Stock)
+	assert.True(t, sold.SellProduct.LowStock)
+
+	var updated struct {
+		UpdateProduct struct {
+			Name         string `json:"name"`
+			Description  string `json:"description"`
+			ReorderPoint int    `json:"reorderPoint"`
+		} `json:"updateProduct"`
+	}
+	errs = queryGraphQL(t, false, `mutation Update($id: ID!) {
+		updateProduct(id: $id, input: {description: "Updated over GraphQL", reorderPoint: 5}) { name description reorderPoint }
+	}`, map[string]interface{}{"id": product.Id}, &updated)
+	assert.Empty(t, errs)
+	assert.Equal(t, "GraphQL Widget", updated.UpdateProduct.Name)
+	assert.Equal(t, "Updated over GraphQL", updated.UpdateProduct.Description)
+	assert.Equal(t, 5, updated.UpdateProduct.ReorderPoint)
+
+	//the caller is read from the request like in the REST API
+	var got struct {
+		Product GraphQLProduct `json:"product"`
+	}
+	errs = queryGraphQL(t, true, fmt.Sprintf(`{ product(id: %s) { name history { actor action changedFields } } }`, product.Id), nil, &got)
+	assert.Empty(t, errs)
+	if assert.Len(t, got.Product.History, 3) {
+		assert.Equal(t, audit.ActionUpdate, got.Product.History[0].Action)
+		assert.Subset(t, got.Product.History[0].ChangedFields, []string{"description", "reorder_point"})
+		assert.Equal(t, audit.ActionCreate, got.Product.History[2].Action)
+		assert.Equal(t, middleware.Anonymous, got.Product.History[2].Actor)
+	}
+
+	var listed struct {
+		Products struct {
+			Items []GraphQLProduct `json:"items"`
+			Total int              `json:"total"`
+		} `json:"products"`
+	}
+	errs = queryGraphQL(t, false, `{ products(filter: {search: "graphql widget", lowStock: true, maxPrice: 5}) { items { name } total } }`, nil, &listed)
+	assert.Empty(t, errs)
+	assert.Equal(t, 1, listed.Products.Total)
+	if assert.Len(t, listed.Products.Items, 1) {
+		assert.Equal(t, "GraphQL Widget", listed.Products.Items[0].Name)
+	}
+	errs = queryGraphQL(t, false, `{ products(filter: {search: "graphql widget", minPrice: 5}) { total } }`, nil, &listed)
+	assert.Empty(t, errs)
+	assert.Zero(t, listed.Products.Total)
+
+	var missing struct {
+		Product *GraphQLProduct `json:"product"`
+	}
+	errs = queryGraphQL(t, false, `{ product(id: 999999) { name } }`, nil, &missing)
+	assert.Empty(t, errs)
+	assert.Nil(t, missing.Product)
+}
+
+func TestGraphQLProductErrors(t *testing.T) {
+	product := createEventProduct(t, "GraphQL Errors Widget", 2)
+
+	//invalid input lists every invalid field
+	errs := queryGraphQL(t, false, `mutation { createProduct(input: {name: "GraphQL Invalid Widget", description: "No price", price: 0, stock: 1}) { id } }`, nil, nil)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, graphqlapi.CodeBadUserInput, errs[0].Extensions["code"])
+		assert.Equal(t, map[string]interface{}{"Price": "Price is required"}, errs[0].Extensions["fields"])
+		assert.Equal(t, []interface{}{"createProduct"}, errs[0].Path)
+	}
+
+	sell := fmt.Sprintf(`mutation { sellProduct(id: %d, quantity: 3) { stock } }`, product.ID)
+	assert.Equal(t, []interface{}{graphqlapi.CodeFailedPrecondition}, errorCodes(queryGraphQL(t, false, sell, nil, nil)))
+	assert.Equal(t, []interface{}{graphqlapi.CodeNotFound}, errorCodes(queryGraphQL(t, false, `mutation { sellProduct(id: 999999, quantity: 1) { stock } }`, nil, nil)))
+	assert.Equal(t, []interface{}{graphqlapi.CodeBadUserInput}, errorCodes(queryGraphQL(t, false, `{ product(id: "abc") { name } }`, nil, nil)))
+	assert.Equal(t, []interface{}{graphqlapi.CodeBadUserInput}, errorCodes(queryGraphQL(t, false, `{ products(limit: 0) { total } }`, nil, nil)))
+	errs = queryGraphQL(t, false, `{ products(limit: 101) { total } }`, nil, nil)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, graphqlapi.CodeBadUserInput, errs[0].Extensions["code"])
+		assert.Equal(t, "limit must be at most 100", errs[0].Message)
+	}
+
+	//queries that do not match the schema are rejected before they run
+	errs = queryGraphQL(t, false, `{ products { items { cost } } }`, nil, nil)
+	if assert.Len(t, errs, 1) {
+		assert.Contains(t, errs[0].Message, `Cannot query field "cost"`)
+	}
+
+	recorder := performRequest(t, router, http.MethodPost, "/graphql", map[string]string{"operationName": "Missing"}, nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestGraphQLFieldAuthorization(t *testing.T) {
+	product := createEventProduct(t, "GraphQL Restricted Widget", 5)
+	performRequest(t, router, http.MethodPut, fmt.Sprintf("/api/v1/products/%d/deactivate", product.ID), nil, adminHeaders)
+	query := `{ products(limit: 100, filter: {search: "graphql restricted"}) { items { name active history { action } } } }`
+
+	var listed struct {
+		Products struct {
+			Items []GraphQLProduct `json:"items"`
+		} `json:"products"`
+	}
+	errs := queryGraphQL(t, true, query, nil, &listed)
+	assert.Empty(t, errs)
+	if assert.Len(t, listed.Products.Items, 1) {
+		assert.False(t, listed.Products.Items[0].Active)
+		assert.Len(t, listed.Products.Items[0].History, 2)
+	}
+
+	//inactive products are only listed for admins
+	errs = queryGraphQL(t, false, query, nil, &listed)
+	assert.Empty(t, errs)
+	assert.Empty(t, listed.Products.Items)
+
+	//admin only fields resolve to null with an error, the rest of the query
+	//still resolves
+	var got struct {
+		Product GraphQLProduct `json:"product"`
+	}
+	errs = queryGraphQL(t, false, fmt.Sprintf(`{ product(id: %d) { name history { action } } }`, product.ID), nil, &got)
+	assert.Equal(t, "GraphQL Restricted Widget", got.Product.Name)
+	assert.Nil(t, got.Product.History)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, graphqlapi.CodeForbidden, errs[0].Extensions["code"])
+		assert.Equal(t, []interface{}{"product", "history"}, errs[0].Path)
+	}
+
+	errs = queryGraphQL(t, false, `{ products(filter: {includeDeleted: true}) { total } }`, nil, nil)
+	assert.Equal(t, []interface{}{graphqlapi.CodeForbidden}, errorCodes(errs))
+}
+
+func TestGraphQLQueryLimits(t *testing.T) {
+	cfg := config.Default().GraphQL
+	cfg.MaxDepth = 4
+	cfg.MaxComplexity = 50
+	handler := graphqlapi.NewHandler(db, controllers.NewProductService(db, notifications.NewLogNotifier()), cfg)
+
+	execute := func(query string, variables map[string]interface{}) []interface{} {
+		var codes []interface{}
+		for _, err := range handler.Execute(audit.WithActor(context.Background(), middleware.RoleAdmin), graphqlapi.Request{Query: query, Variables: variables}).Errors {
+			codes = append(codes, err.Extensions["code"])
+		}
+		return codes
+	}
+
+	//depth counts fields nested through fragments too
+	assert.Empty(t, execute(`{ products(limit: 2) { items { purchaseOrderLines { id } } } }`, nil))
+	assert.Equal(t, []interface{}{graphqlapi.CodeQueryTooDeep}, execute(`{ products(limit: 2) { items { purchaseOrderLines { purchaseOrder { id } } } } }`, nil))
+	assert.Equal(t, []interface{}{graphqlapi.CodeQueryTooDeep}, execute(`
+		{ products(limit: 2) { items { ...lines } } }
+		fragment lines on Product { purchaseOrderLines { purchaseOrder { id } } }`, nil))
+
+	//complexity grows with the page size
+	assert.Empty(t, execute(`query List($limit: Int) { products(limit: $limit) { items { id name stock } } }`, map[string]interface{}{"limit": 10}))
+	assert.Equal(t, []interface{}{graphqlapi.CodeQueryTooComplex}, execute(`query List($limit: Int) { products(limit: $limit) { items { id name stock } } }`, map[string]interface{}{"limit": 20}))
+	assert.Equal(t, []interface{}{graphqlapi.CodeQueryTooComplex}, execute(`{ products { items { id name stock incomingStock lowStock } } }`, nil))
+
+	//and with the number of audit entries asked of each product
+	assert.Empty(t, execute(`{ products(limit: 2) { items { history(limit: 5) { action } } } }`, nil))
+	assert.Equal(t, []interface{}{graphqlapi.CodeQueryTooComplex}, execute(`{ products(limit: 2) { items { history(limit: 30) { action } } } }`, nil))
+
+	//huge limits count as the largest complexity instead of overflowing
+	assert.Equal(t, []interface{}{graphqlapi.CodeQueryTooComplex}, execute(`{ products(limit: 2147483647) { items { history(limit: 2147483647) { action } } } }`, nil))
+	assert.Equal(t, []interface{}{graphqlapi.CodeQueryTooComplex}, execute(`query List($limit: Int, $history: Int) { products(limit: $limit) { items { a: history(limit: $history) { action } b: history(limit: $history) { action } c: history(limit: $history) { action } d: history(limit: $history) { action } } } }`, map[string]interface{}{"limit": 2147483647, "history": 2147483647}))
+
+	//introspection is not limited
+	assert.Empty(t, execute(`{ __schema { types { name fields { name type { name ofType { name ofType { name ofType { name } } } } } } } }`, nil))
+}
+
+func TestGraphQLHistoryLimit(t *testing.T) {
+	product := createEventProduct(t, "GraphQL History Widget", 10)
+	other := createEventProduct(t, "GraphQL Other History Widget", 10)
+	for _, sold := range []models.Product{product, product, product, other} {
+		assert.Equal(t, http.StatusOK, sellProduct(t, sold, 1).Code)
+	}
+
+	//the limit applies to each product, newest entries first
+	var listed struct {
+		Products struct {
+			Items []struct {
+				Name    string                    `json:"name"`
+				Latest  []struct{ Action string } `json:"latest"`
+				History []struct{ Action string } `json:"history"`
+			} `json:"items"`
+		} `json:"products"`
+	}
+	errs := queryGraphQL(t, true, `{ products(filter: {search: "history widget"}) { items { name latest: history(limit: 1) { action } history(limit: 3) { action } } } }`, nil, &listed)
+	assert.Empty(t, errs)
+	histories := map[string][]int{}
+	for _, item := range listed.Products.Items {
+		histories[item.Name] = []int{len(item.Latest), len(item.History)}
+		if assert.NotEmpty(t, item.Latest) {
+			assert.Equal(t, audit.ActionSale, item.Latest[0].Action)
+		}
+	}
+	assert.Equal(t, map[string][]int{"GraphQL History Widget": {1, 3}, "GraphQL Other History Widget": {1, 2}}, histories)
+
+	for _, limit := range []int{0, 101} {
+		errs = queryGraphQL(t, true, fmt.Sprintf(`{ product(id: %d) { history(limit: %d) { action } } }`, product.ID, limit), nil, nil)
+		assert.Equal(t, []interface{}{graphqlapi.CodeBadUserInput}, errorCodes(errs))
+	}
+}
+
+// queryCounter counts the statements run by a database session.
+type queryCounter struct {
+	logger.Interface
+	queries atomic.Int64
+}
+
+func (c *queryCounter) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	c.queries.Add(1)
+}
+
+func TestGraphQLBatching(t *testing.T) {
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/suppliers", controllers.SupplierCreateReq{Name: "GraphQL Batch Supplier"}, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	var supplier models.Supplier
+	if err := db.Where("name = ?", "GraphQL Batch Supplier").First(&supplier).Error; err != nil {
+		t.Fatalf("error fetching supplier: %v", err)
+	}
+
+	var lines []controllers.PurchaseOrderLineReq
+	for i := 1; i <= 4; i++ {
+		product := createEventProduct(t, "GraphQL Batched Widget "+strconv.Itoa(i), 5)
+		lines = append(lines, controllers.PurchaseOrderLineReq{ProductId: product.ID, Quantity: 10 * i, UnitCost: 2})
+	}
+	recorder = performRequest(t, router, http.MethodPost, "/api/v1/purchase-orders", controllers.PurchaseOrderCreateReq{SupplierId: supplier.ID, Lines: lines}, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	var order PurchaseOrderResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &order); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	recorder = performRequest(t, router, http.MethodPut, fmt.Sprintf("/api/v1/purchase-orders/%d/approve", order.Data.Id), nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	counter := &queryCounter{Interface: logger.Discard}
+	counted := db.Session(&gorm.Session{Logger: counter})
+	handler := graphqlapi.NewHandler(counted, controllers.NewProductService(counted, notifications.NewLogNotifier()), config.Default().GraphQL)
+
+	result := handler.Execute(audit.WithActor(context.Background(), middleware.RoleAdmin), graphqlapi.Request{Query: `{
+		products(filter: {search: "graphql batched widget"}) {
+			items {
+				name
+				incomingStock
+				history { action }
+				purchaseOrderLines {
+					quantity
+					product { name }
+					purchaseOrder { status supplier { name } }
+				}
+			}
+		}
+	}`})
+	if !assert.Empty(t, result.Errors) {
+		return
+	}
+
+	//one query per relation however many products are listed: the page, its
+	//count, and the incoming stock, history, lines, products, orders and
+	//suppliers
+	assert.Equal(t, int64(8), counter.queries.Load())
+
+	data, err := json.Marshal(result.Data)
+	if err != nil {
+		t.Fatalf("error marshalling json %v", err)
+	}
+	var listed struct {
+		Products struct {
+			Items []struct {
+				Name               string `json:"name"`
+				IncomingStock      int    `json:"incomingStock"`
+				PurchaseOrderLines []struct {
+					Quantity      int `json:"quantity"`
+					Product       struct{ Name string }
+					PurchaseOrder struct {
+						Status   string
+						Supplier struct{ Name string }
+					} `json:"purchaseOrder"`
+				} `json:"purchaseOrderLines"`
+			} `json:"items"`
+		} `json:"products"`
+	}
+	if err := json.Unmarshal(data, &listed); err != nil {
+		t.Fatalf("error decoding data: %v", err)
+	}
+	if assert.Len(t, listed.Products.Items, 4) {
+		//newest first
+		item := listed.Products.Items[0]
+		assert.Equal(t, "GraphQL Batched Widget 4", item.Name)
+		assert.Equal(t, 40, item.IncomingStock)
+		if assert.Len(t, item.PurchaseOrderLines, 1) {
+			assert.Equal(t, item.Name, item.PurchaseOrderLines[0].Product.Name)
+			assert.Equal(t, models.PurchaseOrderApproved, item.PurchaseOrderLines[0].PurchaseOrder.Status)
+			assert.Equal(t, "GraphQL Batch Supplier", item.PurchaseOrderLines[0].PurchaseOrder.Supplier.Name)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/apikeys"
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/events"
+	productv1 "github.com/AllanM007/simpler-test/gen/product/v1"
+	"github.com/AllanM007/simpler-test/grpcapi"
+	"github.com/AllanM007/simpler-test/middleware"
+	"github.com/AllanM007/simpler-test/notifications"
+	"github.com/AllanM007/simpler-test/stream"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newGRPCClient serves the gRPC API over an in-memory connection and returns
+// a client for it.
+func newGRPCClient(t *testing.T, broker *stream.Broker) productv1.ProductServiceClient {
+	cfg := config.Default()
+	server := grpcapi.NewServer(cfg.GRPC, controllers.NewProductService(db, notifications.NewLogNotifier()), broker, adminAPIKey, apikeys.NewStore(db))
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("error dialing grpc server: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Close(context.Background())
+	})
+	return productv1.NewProductServiceClient(conn)
+}
+
+func adminContext() context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+adminAPIKey)
+}
+
+func TestGRPCProducts(t *testing.T) {
+	client := newGRPCClient(t, stream.NewBroker(config.Default().Stream))
+	ctx := metadata.AppendToOutgoingContext(adminContext(), "x-request-id", "grpc-products")
+
+	var header metadata.MD
+	created, err := client.CreateProduct(ctx, &productv1.CreateProductRequest{
+		Name:         "gRPC Widget",
+		Description:  "Created over gRPC",
+		Price:        4.5,
+		Stock:        10,
+		ReorderPoint: 3,
+	}, grpc.Header(&header))
+	if !assert.NoError(t, err) {
+		return
+	}
+	product := created.GetProduct()
+	assert.NotZero(t, product.GetId())
+	assert.Equal(t, int64(10), product.GetStock())
+	assert.True(t, product.GetActive())
+	assert.Equal(t, []string{"grpc-products"}, header.Get("x-request-id"))
+
+	//changes are audited like REST ones, naming the caller and request
+	entries := getAuditLogs(t, fmt.Sprintf("entity_type=product&action=create&entity_id=%d", product.GetId()))
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, middleware.RoleAdmin, entries[0].Actor)
+		assert.Equal(t, "grpc-products", entries[0].RequestId)
+	}
+
+	got, err := client.GetProduct(context.Background(), &productv1.GetProductRequest{Id: product.GetId()})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Created over gRPC", got.GetProduct().GetDescription())
+	}
+
+	listed, err := client.ListProducts(context.Background(), &productv1.ListProductsRequest{Limit: 1})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(1), listed.GetPage())
+		assert.Len(t, listed.GetProducts(), 1)
+		assert.Positive(t, listed.GetTotal())
+	}
+
+	updated, err := client.UpdateProduct(context.Background(), &productv1.UpdateProductRequest{
+		Id:           product.GetId(),
+		Description:  ptr("Updated over gRPC"),
+		ReorderPoint: ptr(int64(5)),
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "gRPC Widget", updated.GetProduct().GetName())
+		assert.Equal(t, "Updated over gRPC", updated.GetProduct().GetDescription())
+		assert.Equal(t, int64(5), updated.GetProduct().GetReorderPoint())
+	}
+
+	//updates change only the fields they set
+	updated, err = client.UpdateProduct(context.Background(), &productv1.UpdateProductRequest{Id: product.GetId(), Price: ptr(6.25)})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 6.25, updated.GetProduct().GetPrice())
+		assert.Equal(t, "gRPC Widget", updated.GetProduct().GetName())
+		assert.Equal(t, "Updated over gRPC", updated.GetProduct().GetDescription())
+		assert.Equal(t, int64(5), updated.GetProduct().GetReorderPoint())
+	}
+
+	sold, err := client.SellProduct(context.Background(), &productv1.SellProductRequest{Id: product.GetId(), Quantity: 4})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(6), sold.GetProduct().GetStock())
+	}
+
+	_, err = client.DeleteProduct(context.Background(), &productv1.DeleteProductRequest{Id: product.GetId()})
+	assert.NoError(t, err)
+	_, err = client.GetProduct(context.Background(), &productv1.GetProductRequest{Id: product.GetId()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPCProductErrors(t *testing.T) {
+	client := newGRPCClient(t, stream.NewBroker(config.Default().Stream))
+	product := createEventProduct(t, "gRPC Errors Widget", 2)
+
+	//invalid requests list every invalid field
+	_, err := client.CreateProduct(context.Background(), &productv1.CreateProductRequest{Name: "gRPC Invalid Widget", Description: "No price", Stock: 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	details := status.Convert(err).Details()
+	if assert.Len(t, details, 1) {
+		if badRequest, ok := details[0].(*errdetails.BadRequest); assert.True(t, ok) {
+			assert.Equal(t, "Price", badRequest.GetFieldViolations()[0].GetField())
+			assert.Equal(t, "Price is required", badRequest.GetFieldViolations()[0].GetDescription())
+		}
+	}
+
+	_, err = client.SellProduct(context.Background(), &productv1.SellProductRequest{Id: uint64(product.ID), Quantity: 0})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.SellProduct(context.Background(), &productv1.SellProductRequest{Id: uint64(product.ID), Quantity: 3})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.UpdateProduct(context.Background(), &productv1.UpdateProductRequest{Id: 999999, Name: ptr("Missing")})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.UpdateProduct(context.Background(), &productv1.UpdateProductRequest{Id: uint64(product.ID), Price: ptr(-1.0)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	//listings are capped like the REST ones
+	_, err = client.ListProducts(context.Background(), &productv1.ListProductsRequest{Limit: 100})
+	assert.NoError(t, err)
+	_, err = client.ListProducts(context.Background(), &productv1.ListProductsRequest{Limit: 1000000})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	//inactive products cannot be sold and are only listed for admins
+	performRequest(t, router, http.MethodPut, fmt.Sprintf("/api/v1/products/%d/deactivate", product.ID), nil, adminHeaders)
+	_, err = client.SellProduct(context.Background(), &productv1.SellProductRequest{Id: uint64(product.ID), Quantity: 1})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	listedIds := func(ctx context.Context) []uint64 {
+		listed, err := client.ListProducts(ctx, &productv1.ListProductsRequest{Limit: 100})
+		assert.NoError(t, err)
+		var ids []uint64
+		for _, listedProduct := range listed.GetProducts() {
+			ids = append(ids, listedProduct.GetId())
+		}
+		return ids
+	}
+	assert.NotContains(t, listedIds(context.Background()), uint64(product.ID))
+	assert.Contains(t, listedIds(adminContext()), uint64(product.ID))
+	wrongKey := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "wrong-key")
+	assert.NotContains(t, listedIds(wrongKey), uint64(product.ID))
+}
+
+func TestGRPCDuplicateProduct(t *testing.T) {
+	client := newGRPCClient(t, stream.NewBroker(config.Default().Stream))
+	createEventProduct(t, "gRPC Duplicate Widget", 2)
+
+	_, err := client.CreateProduct(context.Background(), &productv1.CreateProductRequest{Name: "gRPC Duplicate Widget", Description: "Again", Price: 1, Stock: 1})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestGRPCWatchStock(t *testing.T) {
+	broker := stream.NewBroker(config.Default().Stream)
+	client := newGRPCClient(t, broker)
+	follower := events.NewFollower(db, config.Default().Events, broker)
+	followEvents(t, follower)
+	watched := createEventProduct(t, "gRPC Watched Widget", 10)
+	other := createEventProduct(t, "gRPC Unwatched Widget", 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	watch, err := client.WatchStock(ctx, &productv1.WatchStockRequest{ProductIds: []uint64{uint64(watched.ID)}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	//the stream is open once the broker counts its subscriber
+	assert.Eventually(t, func() bool { return broker.Subscribers() == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	_, err = client.SellProduct(context.Background(), &productv1.SellProductRequest{Id: uint64(other.ID), Quantity: 1})
+	assert.NoError(t, err)
+	_, err = client.SellProduct(context.Background(), &productv1.SellProductRequest{Id: uint64(watched.ID), Quantity: 3})
+	assert.NoError(t, err)
+	followEvents(t, follower)
+
+	response, err := watch.Recv()
+	if !assert.NoError(t, err) {
+		return
+	}
+	update := response.GetUpdate()
+	assert.False(t, response.GetReset_())
+	assert.Equal(t, uint64(watched.ID), update.GetProductId())
+	assert.Equal(t, int64(10), update.GetPreviousStock())
+	assert.Equal(t, int64(7), update.GetStock())
+	assert.Equal(t, events.ReasonSale, update.GetReason())
+	assert.NotEmpty(t, update.GetId())
+
+	//resuming from an unknown update tells the client to reload its stock
+	resumed, err := client.WatchStock(ctx, &productv1.WatchStockRequest{LastEventId: "unknown"})
+	if assert.NoError(t, err) {
+		response, err := resumed.Recv()
+		assert.NoError(t, err)
+		assert.True(t, response.GetReset_())
+	}
+
+	//closing the broker ends open streams
+	broker.Close()
+	_, err = watch.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	closed, err := client.WatchStock(ctx, &productv1.WatchStockRequest{})
+	if assert.NoError(t, err) {
+		_, err = closed.Recv()
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	}
+}
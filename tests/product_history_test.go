@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/middleware"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/testharness"
+	"github.com/stretchr/testify/assert"
+)
+
+type AuditResponse struct {
+	Status string                             `json:"status"`
+	Data   controllers.AuditPaginatedResponse `json:"data"`
+}
+
+func getAuditLogs(t *testing.T, query string) []controllers.AuditLogData {
+	recorder := performRequest(t, router, http.MethodGet, "/api/v1/audit?"+query, nil, adminHeaders)
+	if !assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String()) {
+		return nil
+	}
+
+	var response AuditResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	return response.Data.Entries
+}
+
+func TestAuditLog(t *testing.T) {
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/products", controllers.ProductCreateReq{
+		Name:        "Audited Widget",
+		Description: "Product used to test the audit log",
+		Price:       8,
+		StockLevel:  20,
+	}, map[string]string{middleware.RequestIDHeader: "audit-create"})
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	var product models.Product
+	if err := db.Where("name = ?", "Audited Widget").First(&product).Error; err != nil {
+		t.Fatalf("error fetching product: %v", err)
+	}
+	productUrl := fmt.Sprintf("/api/v1/products/%d", product.ID)
+
+	recorder = performRequest(t, router, http.MethodPut, productUrl, controllers.ProductUpdateReq{
+		Name:        ptr("Audited Gadget"),
+		Description: ptr("Product used to test the audit log"),
+	}, map[string]string{middleware.RequestIDHeader: "audit-update"})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = performRequest(t, router, http.MethodPut, productUrl+"/sale", controllers.ProductSale{Id: int(product.ID), Count: 5}, map[string]string{middleware.RequestIDHeader: "audit-sale"})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	//rejected sales change nothing and are not recorded
+	recorder = performRequest(t, router, http.MethodPut, productUrl+"/sale", controllers.ProductSale{Id: int(product.ID), Count: 500}, map[string]string{middleware.RequestIDHeader: "audit-rejected"})
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = performRequest(t, router, http.MethodDelete, productUrl, nil, map[string]string{middleware.RequestIDHeader: "audit-delete"})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	entries := getAuditLogs(t, fmt.Sprintf("entity_type=product&entity_id=%d", product.ID))
+	if !assert.Len(t, entries, 4) {
+		return
+	}
+
+	//newest first
+	del, sale, update, create := entries[0], entries[1], entries[2], entries[3]
+
+	assert.Equal(t, "create", create.Action)
+	assert.Equal(t, middleware.Anonymous, create.Actor)
+	assert.Equal(t, "audit-create", create.RequestId)
+	assert.Nil(t, create.Changes["name"].Before)
+	assert.Equal(t, "Audited Widget", create.Changes["name"].After)
+
+	assert.Equal(t, "update", update.Action)
+	assert.Equal(t, "audit-update", update.RequestId)
+	assert.Equal(t, models.FieldChange{Before: "Audited Widget", After: "Audited Gadget"}, update.Changes["name"])
+	assert.NotContains(t, update.Changes, "description", "unchanged fields are left out")
+
+	assert.Equal(t, "sale", sale.Action)
+	assert.Equal(t, models.FieldChange{Before: float64(20), After: float64(15)}, sale.Changes["stock"])
+
+	assert.Equal(t, "delete", del.Action)
+	assert.Equal(t, "Audited Gadget", del.Changes["name"].Before)
+	assert.Nil(t, del.Changes["name"].After)
+
+	//filters
+	entries = getAuditLogs(t, "request_id=audit-update")
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, product.ID, entries[0].EntityId)
+	}
+	entries = getAuditLogs(t, fmt.Sprintf("entity_id=%d&action=sale", product.ID))
+	assert.Len(t, entries, 1)
+	assert.Empty(t, getAuditLogs(t, "request_id=audit-rejected"))
+	assert.Empty(t, getAuditLogs(t, "from=2999-01-01T00:00:00Z"))
+
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/audit?from=yesterday", nil, adminHeaders)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/audit?entity_id=widget", nil, adminHeaders)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestAuditLogRecordsAdminActor(t *testing.T) {
+	product := testharness.CreateProduct(t, db, "Audited Seasonal Widget",
+		testharness.WithDescription("Product used to test audited activation"),
+		testharness.WithPrice(4),
+		testharness.WithStock(3),
+	)
+
+	recorder := performRequest(t, router, http.MethodPut, fmt.Sprintf("/api/v1/products/%d/deactivate", product.ID), nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	entries := getAuditLogs(t, fmt.Sprintf("entity_type=product&entity_id=%d&action=deactivate", product.ID))
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, middleware.RoleAdmin, entries[0].Actor)
+		assert.Equal(t, models.FieldChange{Before: true, After: false}, entries[0].Changes["active"])
+	}
+
+	entries = getAuditLogs(t, fmt.Sprintf("entity_id=%d&actor=admin", product.ID))
+	assert.Len(t, entries, 1)
+}
+
+func TestAuditLogRequiresAdmin(t *testing.T) {
+	recorder := performRequest(t, router, http.MethodGet, "/api/v1/audit", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
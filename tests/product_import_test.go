@@ -0,0 +1,251 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/events"
+	"github.com/AllanM007/simpler-test/health"
+	"github.com/AllanM007/simpler-test/middleware"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/notifications"
+	"github.com/AllanM007/simpler-test/routes"
+	"github.com/AllanM007/simpler-test/stream"
+	"github.com/AllanM007/simpler-test/testharness"
+	"github.com/stretchr/testify/assert"
+)
+
+type ImportResponse struct {
+	Status string                   `json:"status"`
+	Data   controllers.ImportReport `json:"data"`
+}
+
+// importHeaders authenticates an import as the admin and names the format of
+// its upload.
+func importHeaders(contentType string) map[string]string {
+	return map[string]string{
+		"Content-Type":          contentType,
+		middleware.APIKeyHeader: adminAPIKey,
+	}
+}
+
+// decodeImport returns the report of an import response.
+func decodeImport(t *testing.T, recorder *httptest.ResponseRecorder) controllers.ImportReport {
+	var response ImportResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	return response.Data
+}
+
+func importStatuses(report controllers.ImportReport) map[int]string {
+	statuses := map[int]string{}
+	for _, row := range report.Rows {
+		statuses[row.Line] = row.Status
+	}
+	return statuses
+}
+
+func TestImportProductsCSV(t *testing.T) {
+	existing := createEventProduct(t, "Imported Existing Widget", 5)
+
+	upload := strings.Join([]string{
+		"name,description,price,stock,reorder_point",
+		"Imported Widget A,First imported widget,12.5,40,5",
+		"Imported Widget B,Second imported widget,abc,10,",
+		"Imported Widget C,Third imported widget,3,0,",
+		`"Imported Widget D","Quoted, with a comma",7,8,`,
+		"Imported Widget A,Repeated widget,1,1,",
+		"Imported Existing Widget,Already there,1,1,",
+		"Imported Widget E,Too few columns",
+	}, "\n")
+
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/products/import", strings.NewReader(upload), importHeaders("text/csv"))
+	report := decodeImport(t, recorder)
+	if !assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String()) {
+		return
+	}
+	assert.Equal(t, controllers.ImportInsert, report.Mode)
+	assert.Equal(t, controllers.ImportSummary{Total: 7, Created: 2, Failed: 5}, report.Summary)
+	assert.Equal(t, map[int]string{
+		2: controllers.ImportCreated,
+		3: controllers.ImportFailed,
+		4: controllers.ImportFailed,
+		5: controllers.ImportCreated,
+		6: controllers.ImportFailed,
+		7: controllers.ImportFailed,
+		8: controllers.ImportFailed,
+	}, importStatuses(report))
+	if len(report.Rows) != 7 {
+		return
+	}
+
+	//every failure says why
+	assert.Contains(t, report.Rows[1].Errors["row"], "price")
+	assert.Equal(t, "StockLevel is required", report.Rows[2].Errors["StockLevel"])
+	assert.Equal(t, "Name repeats line 2", report.Rows[4].Errors["Name"])
+	assert.Equal(t, existing.ID, report.Rows[5].Id)
+	assert.Equal(t, "Product already exists", report.Rows[5].Errors["Name"])
+	assert.NotEmpty(t, report.Rows[6].Errors["row"])
+
+	var product models.Product
+	if assert.NoError(t, db.Where("name = ?", "Imported Widget D").First(&product).Error) {
+		assert.Equal(t, report.Rows[3].Id, product.ID)
+		assert.Equal(t, "Quoted, with a comma", product.Description)
+		assert.Equal(t, 8, product.StockLevel)
+	}
+	var unchanged models.Product
+	assert.NoError(t, db.Where("id = ?", existing.ID).First(&unchanged).Error)
+	assert.Equal(t, "Product used to test domain events", unchanged.Description, "insert mode never changes existing products")
+}
+
+func TestImportProductsUpsert(t *testing.T) {
+	relay, publisher := newTestRelay(t)
+	changed := createEventProduct(t, "Upserted Changed Widget", 5)
+	same := createEventProduct(t, "Upserted Same Widget", 5)
+
+	upload := strings.Join([]string{
+		`{"name": "Upserted Changed Widget", "description": "Restocked", "price": 6, "stock": 25}`,
+		``,
+		`{"name": "Upserted Same Widget", "description": "Product used to test domain events", "price": 6, "stock": 5}`,
+		`{"name": "Upserted New Widget", "description": "Brand new", "price": 2, "stock": 3, "reorder_quantity": 10}`,
+		`{"name": "Upserted Odd Widget", "colour": "blue"}`,
+	}, "\n")
+
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/products/import?mode=upsert", strings.NewReader(upload), importHeaders("application/x-ndjson"))
+	report := decodeImport(t, recorder)
+	if !assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String()) {
+		return
+	}
+	assert.Equal(t, controllers.ImportSummary{Total: 4, Created: 1, Updated: 1, Unchanged: 1, Failed: 1}, report.Summary)
+	assert.Equal(t, map[int]string{
+		1: controllers.ImportUpdated,
+		3: controllers.ImportUnchanged,
+		4: controllers.ImportCreated,
+		5: controllers.ImportFailed,
+	}, importStatuses(report))
+
+	var product models.Product
+	assert.NoError(t, db.Where("id = ?", changed.ID).First(&product).Error)
+	assert.Equal(t, "Restocked", product.Description)
+	assert.Equal(t, 25, product.StockLevel)
+
+	//updates are announced like any other, with the stock change attributed to the import
+	_, err := relay.PublishPending(context.Background())
+	assert.NoError(t, err)
+	received := publisher.forProduct(changed.ID)
+	if assert.Len(t, received, 3) {
+		assert.Equal(t, events.ProductUpdated, received[1].Type)
+		var change events.StockChange
+		assert.NoError(t, json.Unmarshal(received[2].Payload, &change))
+		assert.Equal(t, events.StockChange{ProductID: changed.ID, PreviousStock: 5, Stock: 25, Reason: events.ReasonImport}, change)
+	}
+	assert.Len(t, publisher.forProduct(same.ID), 1, "unchanged products emit nothing")
+
+	entries := getAuditLogs(t, fmt.Sprintf("entity_type=product&action=update&entity_id=%d", changed.ID))
+	assert.Len(t, entries, 1)
+}
+
+func TestImportProductsDryRun(t *testing.T) {
+	upload := "name,description,price,stock\nDry Run Widget,Never written,1,1\nDry Run Widget 2,,1,1\n"
+
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/products/import?dry_run=true", strings.NewReader(upload), importHeaders("text/csv"))
+	report := decodeImport(t, recorder)
+	if !assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String()) {
+		return
+	}
+	assert.True(t, report.DryRun)
+	assert.Equal(t, controllers.ImportSummary{Total: 2, Created: 1, Failed: 1}, report.Summary)
+	assert.Zero(t, report.Rows[0].Id)
+
+	var count int64
+	db.Model(&models.Product{}).Where("name LIKE ?", "Dry Run Widget%").Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestImportProductsUploads(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.AdminAPIKey = adminAPIKey
+	cfg.Imports.BatchSize = 2
+	cfg.Imports.MaxBytes = 1024
+	handler := routes.Router(db, cfg, notifications.NewLogNotifier(), stream.NewBroker(cfg.Stream), health.NewRegistry(time.Second))
+
+	//multipart uploads are written in batches and detected from the file name
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	writer.WriteField("note", "ignored")
+	file, _ := writer.CreateFormFile("file", "products.csv")
+	io.WriteString(file, "name,description,price,stock\n")
+	for _, name := range []string{"Batched Widget 1", "Batched Widget 2", "Batched Widget 3", "Batched Widget 4", "Batched Widget 5"} {
+		io.WriteString(file, name+",Imported in batches,1,1\n")
+	}
+	writer.Close()
+
+	recorder := performRequest(t, handler, http.MethodPost, "/api/v1/products/import", &form, importHeaders(writer.FormDataContentType()))
+	report := decodeImport(t, recorder)
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, 5, report.Summary.Created)
+
+	recorder = performRequest(t, handler, http.MethodPost, "/api/v1/products/import", strings.NewReader("name,description,price,stock\n"+strings.Repeat("Too Big Widget,Big,1,1\n", 100)), importHeaders("text/csv"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	recorder = performRequest(t, handler, http.MethodPost, "/api/v1/products/import", strings.NewReader("<products/>"), importHeaders("application/xml"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+
+	recorder = performRequest(t, handler, http.MethodPost, "/api/v1/products/import?format=csv", strings.NewReader("name,colour\nWidget,blue\n"), importHeaders("application/octet-stream"))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	//a misspelt column is rejected even when no row follows the header
+	recorder = performRequest(t, handler, http.MethodPost, "/api/v1/products/import", strings.NewReader("name,descripton,price,stock\n"), importHeaders("text/csv"))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `unknown column \"descripton\"`)
+
+	recorder = performRequest(t, handler, http.MethodPost, "/api/v1/products/import?mode=replace", strings.NewReader(""), importHeaders("text/csv"))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	//only admins can import
+	request, _ := http.NewRequest(http.MethodPost, "/api/v1/products/import", strings.NewReader(""))
+	request.Header.Set("Content-Type", "text/csv")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestImportUpsertLowStockAlerts(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.AdminAPIKey = adminAPIKey
+	sink := &recordingNotifier{}
+	handler := routes.Router(db, cfg, sink, stream.NewBroker(cfg.Stream), health.NewRegistry(time.Second))
+	product := testharness.CreateProduct(t, db, "Upserted Alert Widget", testharness.WithStock(12), testharness.WithReorder(10, 40))
+
+	//an upsert taking stock across the reorder point alerts like a sale
+	recorder := performRequest(t, handler, http.MethodPost, "/api/v1/products/import?mode=upsert", strings.NewReader(
+		"name,description,price,stock,reorder_point,reorder_quantity\nUpserted Alert Widget,Restocked by import,10,5,10,40\n"), importHeaders("text/csv"))
+	report := decodeImport(t, recorder)
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, 1, report.Summary.Updated)
+
+	//stock staying below the reorder point does not alert again
+	recorder = performRequest(t, handler, http.MethodPost, "/api/v1/products/import?mode=upsert", strings.NewReader(
+		"name,description,price,stock,reorder_point,reorder_quantity\nUpserted Alert Widget,Restocked by import,10,4,10,40\n"), importHeaders("text/csv"))
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if assert.Len(t, sink.alerts, 1) {
+		assert.Equal(t, product.ID, sink.alerts[0].ProductID)
+		assert.Equal(t, 12, sink.alerts[0].PreviousStock)
+		assert.Equal(t, 5, sink.alerts[0].Stock)
+	}
+}
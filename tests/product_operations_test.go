@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/events"
+	"github.com/AllanM007/simpler-test/health"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/notifications"
+	"github.com/AllanM007/simpler-test/routes"
+	"github.com/AllanM007/simpler-test/stream"
+	"github.com/stretchr/testify/assert"
+)
+
+// decodeBatch returns the body of a batch response.
+func decodeBatch(t *testing.T, recorder *httptest.ResponseRecorder) controllers.ProductBatchResponse {
+	var response controllers.ProductBatchResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	return response
+}
+
+func batchStatuses(response controllers.ProductBatchResponse) []int {
+	var statuses []int
+	for _, result := range response.Data.Results {
+		statuses = append(statuses, result.Status)
+	}
+	return statuses
+}
+
+func batchProduct(t *testing.T, product interface{}) json.RawMessage {
+	data, err := json.Marshal(product)
+	if err != nil {
+		t.Fatalf("error marshalling json %v", err)
+	}
+	return data
+}
+
+// ptr returns a pointer to value, for the optional fields of requests.
+func ptr[T any](value T) *T {
+	return &value
+}
+
+func TestBatchProducts(t *testing.T) {
+	relay, publisher := newTestRelay(t)
+	updated := createEventProduct(t, "Batch Updated Widget", 10)
+	deleted := createEventProduct(t, "Batch Deleted Widget", 10)
+
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/products/batch", controllers.ProductBatchReq{
+		Operations: []controllers.ProductBatchOperation{
+			{Op: controllers.BatchCreate, Product: batchProduct(t, controllers.ProductCreateReq{Name: "Batch Created Widget", Description: "Created in a batch", Price: 3, StockLevel: 4})},
+			{Op: controllers.BatchUpdate, Id: updated.ID, Product: batchProduct(t, controllers.ProductUpdateReq{Name: ptr("Batch Updated Widget"), Description: ptr("Updated in a batch")})},
+			{Op: controllers.BatchAdjustStock, Id: updated.ID, Delta: -3},
+			{Op: controllers.BatchDelete, Id: deleted.ID},
+			{Op: controllers.BatchDelete, Id: 999999},
+			{Op: controllers.BatchAdjustStock, Id: updated.ID, Delta: -100},
+			{Op: controllers.BatchCreate, Product: batchProduct(t, map[string]interface{}{"name": "Batch Invalid Widget", "description": "No price", "stock": 1})},
+			{Op: controllers.BatchAdjustStock, Delta: 1},
+		},
+	}, adminHeaders)
+	response := decodeBatch(t, recorder)
+	if !assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String()) {
+		return
+	}
+
+	//failed operations never stop the others
+	assert.Equal(t, controllers.BatchPartial, response.Status)
+	assert.Equal(t, []int{201, 200, 200, 200, 404, 403, 400, 400}, batchStatuses(response))
+	assert.Equal(t, "Product not found!!", response.Data.Results[4].Body["message"])
+	assert.Equal(t, map[string]interface{}{"Price": "Price is required"}, response.Data.Results[6].Body["errors"])
+
+	var product models.Product
+	assert.NoError(t, db.Where("name = ?", "Batch Created Widget").First(&product).Error)
+	product = models.Product{}
+	assert.NoError(t, db.Where("id = ?", updated.ID).First(&product).Error)
+	assert.Equal(t, "Updated in a batch", product.Description)
+	assert.Equal(t, 7, product.StockLevel)
+	assert.Error(t, db.Where("id = ?", deleted.ID).First(&models.Product{}).Error)
+
+	//adjustments are audited and announced like any other stock change
+	entries := getAuditLogs(t, fmt.Sprintf("entity_type=product&action=%s&entity_id=%d", audit.ActionAdjust, updated.ID))
+	assert.Len(t, entries, 1)
+
+	_, err := relay.PublishPending(context.Background())
+	assert.NoError(t, err)
+	received := publisher.forProduct(updated.ID)
+	if assert.Len(t, received, 3) {
+		assert.Equal(t, events.ProductUpdated, received[1].Type)
+		var change events.StockChange
+		assert.NoError(t, json.Unmarshal(received[2].Payload, &change))
+		assert.Equal(t, events.StockChange{ProductID: updated.ID, PreviousStock: 10, Stock: 7, Reason: events.ReasonAdjustment}, change)
+	}
+}
+
+func TestBatchUpdatePrice(t *testing.T) {
+	product := createEventProduct(t, "Batch Repriced Widget", 10)
+
+	//an update changes the fields it sets and no others
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/products/batch", controllers.ProductBatchReq{
+		Operations: []controllers.ProductBatchOperation{
+			{Op: controllers.BatchUpdate, Id: product.ID, Product: batchProduct(t, controllers.ProductUpdateReq{Price: ptr(12.5)})},
+			{Op: controllers.BatchUpdate, Id: product.ID, Product: batchProduct(t, map[string]interface{}{"price": 0})},
+			{Op: controllers.BatchUpdate, Id: product.ID, Product: batchProduct(t, map[string]interface{}{"stockLevel": 50})},
+		},
+	}, adminHeaders)
+	response := decodeBatch(t, recorder)
+	if !assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String()) {
+		return
+	}
+	assert.Equal(t, []int{200, 400, 400}, batchStatuses(response))
+	//stock is only changed by adjust_stock
+	assert.Contains(t, response.Data.Results[2].Body["message"], `unknown field "stockLevel"`)
+
+	var updated models.Product
+	if assert.NoError(t, db.Where("id = ?", product.ID).First(&updated).Error) {
+		assert.Equal(t, 12.5, updated.Price)
+		assert.Equal(t, product.Name, updated.Name)
+		assert.Equal(t, product.Description, updated.Description)
+		assert.Equal(t, product.StockLevel, updated.StockLevel)
+	}
+}
+
+func TestBatchProductsAtomic(t *testing.T) {
+	product := createEventProduct(t, "Atomic Batch Widget", 10)
+
+	//an atomic batch stops at its first failure and keeps none of its changes
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/products/batch", controllers.ProductBatchReq{
+		Atomic: true,
+		Operations: []controllers.ProductBatchOperation{
+			{Op: controllers.BatchCreate, Product: batchProduct(t, controllers.ProductCreateReq{Name: "Atomic Batch Created Widget", Description: "Rolled back", Price: 3, StockLevel: 4})},
+			{Op: controllers.BatchAdjustStock, Id: product.ID, Delta: 5},
+			{Op: controllers.BatchAdjustStock, Id: product.ID, Delta: -20},
+			{Op: controllers.BatchDelete, Id: product.ID},
+		},
+	}, adminHeaders)
+	response := decodeBatch(t, recorder)
+	if !assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String()) {
+		return
+	}
+	assert.Equal(t, controllers.BatchRolledBack, response.Status)
+	assert.Equal(t, []int{424, 424, 403, 424}, batchStatuses(response))
+	assert.Equal(t, "ROLLED_BACK", response.Data.Results[0].Body["status"])
+	assert.Equal(t, "NOT_ATTEMPTED", response.Data.Results[3].Body["status"])
+
+	var count int64
+	db.Model(&models.Product{}).Where("name = ?", "Atomic Batch Created Widget").Count(&count)
+	assert.Zero(t, count)
+	var unchanged models.Product
+	assert.NoError(t, db.Where("id = ?", product.ID).First(&unchanged).Error)
+	assert.Equal(t, 10, unchanged.StockLevel)
+
+	recorder = performRequest(t, router, http.MethodPost, "/api/v1/products/batch", controllers.ProductBatchReq{
+		Atomic: true,
+		Operations: []controllers.ProductBatchOperation{
+			{Op: controllers.BatchAdjustStock, Id: product.ID, Delta: 5},
+			{Op: controllers.BatchAdjustStock, Id: product.ID, Delta: -15},
+		},
+	}, adminHeaders)
+	response = decodeBatch(t, recorder)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, controllers.BatchOK, response.Status)
+	assert.Equal(t, []int{200, 200}, batchStatuses(response))
+	unchanged = models.Product{}
+	assert.NoError(t, db.Where("id = ?", product.ID).First(&unchanged).Error)
+	assert.Zero(t, unchanged.StockLevel)
+}
+
+func TestBatchProductsLimits(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.AdminAPIKey = adminAPIKey
+	cfg.Products.BatchMaxOperations = 2
+	handler := routes.Router(db, cfg, notifications.NewLogNotifier(), stream.NewBroker(cfg.Stream), health.NewRegistry(time.Second))
+
+	deletes := []controllers.ProductBatchOperation{{Op: controllers.BatchDelete, Id: 999997}, {Op: controllers.BatchDelete, Id: 999998}, {Op: controllers.BatchDelete, Id: 999999}}
+	recorder := performRequest(t, handler, http.MethodPost, "/api/v1/products/batch", controllers.ProductBatchReq{Operations: deletes}, adminHeaders)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = performRequest(t, handler, http.MethodPost, "/api/v1/products/batch", controllers.ProductBatchReq{Operations: deletes[:2]}, adminHeaders)
+	response := decodeBatch(t, recorder)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []int{404, 404}, batchStatuses(response))
+
+	recorder = performRequest(t, handler, http.MethodPost, "/api/v1/products/batch", controllers.ProductBatchReq{Operations: []controllers.ProductBatchOperation{{Op: "rename", Id: 1}}}, adminHeaders)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = performRequest(t, handler, http.MethodPost, "/api/v1/products/batch", controllers.ProductBatchReq{}, adminHeaders)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	//only admins can run batches
+	recorder = performRequest(t, router, http.MethodPost, "/api/v1/products/batch", controllers.ProductBatchReq{Operations: deletes[:1]}, nil)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
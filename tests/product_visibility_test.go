@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/testharness"
+	"github.com/stretchr/testify/assert"
+)
+
+func listsProduct(t *testing.T, body []byte, id uint) bool {
+	var products ProductsResponse
+	if err := json.Unmarshal(body, &products); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	for _, product := range products.Data.Products {
+		if product.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDeactivateProduct(t *testing.T) {
+	product := testharness.CreateProduct(t, db, "Seasonal Widget",
+		testharness.WithDescription("Product used to test the active flag"),
+		testharness.WithPrice(8),
+	)
+	assert.True(t, product.Active)
+
+	deactivateUrl := fmt.Sprintf("/api/v1/products/%d/deactivate", product.ID)
+
+	recorder := performRequest(t, router, http.MethodPut, deactivateUrl, nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = performRequest(t, router, http.MethodPut, deactivateUrl, nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	//inactive products are hidden from non-admin listings only
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/products?limit=100", nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.False(t, listsProduct(t, recorder.Body.Bytes(), product.ID))
+
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/products?limit=100", nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, listsProduct(t, recorder.Body.Bytes(), product.ID))
+
+	recorder = performRequest(t, router, http.MethodPut, fmt.Sprintf("/api/v1/products/%d/sale", product.ID), controllers.ProductSale{Id: int(product.ID), Count: 1}, nil)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	var response controllers.Response
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	assert.Equal(t, "PRODUCT_INACTIVE", response.Status)
+
+	recorder = performRequest(t, router, http.MethodPut, fmt.Sprintf("/api/v1/products/%d/activate", product.ID), nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = performRequest(t, router, http.MethodPut, fmt.Sprintf("/api/v1/products/%d/sale", product.ID), controllers.ProductSale{Id: int(product.ID), Count: 1}, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = performRequest(t, router, http.MethodPut, "/api/v1/products/1000001/deactivate", nil, adminHeaders)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
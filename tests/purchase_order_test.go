@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/testharness"
+	"github.com/stretchr/testify/assert"
+)
+
+type PurchaseOrderResponse struct {
+	Status string                        `json:"status"`
+	Data   controllers.PurchaseOrderData `json:"data"`
+}
+
+type OutstandingResponse struct {
+	Status string                        `json:"status"`
+	Data   []controllers.OutstandingData `json:"data"`
+}
+
+func TestPurchaseOrderReceipts(t *testing.T) {
+
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/suppliers", controllers.SupplierCreateReq{
+		Name:  "Acme Wholesale",
+		Email: "orders@acme.test",
+	}, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	product := testharness.CreateProduct(t, db, "Restock Widget",
+		testharness.WithDescription("Product used to test purchase order receipts"),
+		testharness.WithPrice(12),
+		testharness.WithStock(5),
+	)
+
+	var supplier models.Supplier
+	if err := db.Where("name = ?", "Acme Wholesale").First(&supplier).Error; err != nil {
+		t.Fatalf("error fetching supplier: %v", err)
+	}
+
+	recorder = performRequest(t, router, http.MethodPost, "/api/v1/purchase-orders", controllers.PurchaseOrderCreateReq{
+		SupplierId: supplier.ID,
+		Lines: []controllers.PurchaseOrderLineReq{
+			{ProductId: product.ID, Quantity: 20, UnitCost: 7.5},
+		},
+	}, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	var order PurchaseOrderResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &order); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	assert.Equal(t, models.PurchaseOrderDraft, order.Data.Status)
+	assert.Len(t, order.Data.Lines, 1)
+	lineId := order.Data.Lines[0].Id
+	orderUrl := fmt.Sprintf("/api/v1/purchase-orders/%d", order.Data.Id)
+
+	//draft orders cannot be received
+	receipt := controllers.PurchaseOrderReceiptReq{
+		Lines: []controllers.PurchaseOrderReceiptLineReq{{LineId: lineId, Quantity: 8}},
+	}
+	recorder = performRequest(t, router, http.MethodPut, orderUrl+"/receive", receipt, nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+
+	recorder = performRequest(t, router, http.MethodPut, orderUrl+"/approve", nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = performRequest(t, router, http.MethodPut, orderUrl+"/receive", receipt, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	if err := json.Unmarshal(recorder.Body.Bytes(), &order); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	assert.Equal(t, models.PurchaseOrderPartiallyReceived, order.Data.Status)
+	assert.Equal(t, 12, order.Data.Lines[0].Outstanding)
+
+	if err := db.First(&product, product.ID).Error; err != nil {
+		t.Fatalf("error fetching product: %v", err)
+	}
+	assert.Equal(t, 13, product.StockLevel)
+
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/inventory/outstanding", nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var outstanding OutstandingResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &outstanding); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	assert.Contains(t, outstanding.Data, controllers.OutstandingData{ProductId: product.ID, Name: product.Name, Outstanding: 12})
+
+	//receiving more than is outstanding is rejected
+	receipt.Lines[0].Quantity = 13
+	recorder = performRequest(t, router, http.MethodPut, orderUrl+"/receive", receipt, nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	receipt.Lines[0].Quantity = 12
+	recorder = performRequest(t, router, http.MethodPut, orderUrl+"/receive", receipt, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	if err := json.Unmarshal(recorder.Body.Bytes(), &order); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	assert.Equal(t, models.PurchaseOrderReceived, order.Data.Status)
+	assert.NotNil(t, order.Data.ReceivedAt)
+}
+
+func TestPurchaseOrderReceiptForDeletedProduct(t *testing.T) {
+
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/suppliers", controllers.SupplierCreateReq{
+		Name:  "Retired Goods Ltd",
+		Email: "orders@retired.test",
+	}, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	var supplier models.Supplier
+	if err := db.Where("name = ?", "Retired Goods Ltd").First(&supplier).Error; err != nil {
+		t.Fatalf("error fetching supplier: %v", err)
+	}
+
+	product := testharness.CreateProduct(t, db, "Retired Widget", testharness.WithStock(4))
+
+	recorder = performRequest(t, router, http.MethodPost, "/api/v1/purchase-orders", controllers.PurchaseOrderCreateReq{
+		SupplierId: supplier.ID,
+		Lines: []controllers.PurchaseOrderLineReq{
+			{ProductId: product.ID, Quantity: 10, UnitCost: 3},
+		},
+	}, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	var order PurchaseOrderResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &order); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	lineId := order.Data.Lines[0].Id
+	orderUrl := fmt.Sprintf("/api/v1/purchase-orders/%d", order.Data.Id)
+
+	recorder = performRequest(t, router, http.MethodPut, orderUrl+"/approve", nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	if err := db.Delete(&product).Error; err != nil {
+		t.Fatalf("error deleting product: %v", err)
+	}
+
+	//the receipt is rejected rather than losing the units
+	receipt := controllers.PurchaseOrderReceiptReq{
+		Lines: []controllers.PurchaseOrderReceiptLineReq{{LineId: lineId, Quantity: 10}},
+	}
+	recorder = performRequest(t, router, http.MethodPut, orderUrl+"/receive", receipt, nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), fmt.Sprintf("Line %d", lineId))
+
+	var line models.PurchaseOrderLine
+	if err := db.First(&line, lineId).Error; err != nil {
+		t.Fatalf("error fetching line: %v", err)
+	}
+	assert.Equal(t, 0, line.ReceivedQuantity)
+
+	//once the product is restored the receipt goes through
+	if err := db.Unscoped().Model(&product).Update("deleted_at", nil).Error; err != nil {
+		t.Fatalf("error restoring product: %v", err)
+	}
+	recorder = performRequest(t, router, http.MethodPut, orderUrl+"/receive", receipt, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	if err := db.First(&product, product.ID).Error; err != nil {
+		t.Fatalf("error fetching product: %v", err)
+	}
+	assert.Equal(t, 14, product.StockLevel)
+}
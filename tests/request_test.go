@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/middleware"
+)
+
+// adminHeaders authenticates a request with the admin API key.
+var adminHeaders = map[string]string{middleware.APIKeyHeader: adminAPIKey}
+
+// performRequest sends a request to handler and returns its response. A body
+// that is an io.Reader is sent as it is, and any other body that is not nil is
+// sent as JSON. headers are set last, so they may override the content type.
+func performRequest(t *testing.T, handler http.Handler, method, path string, body interface{}, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var payload io.Reader
+	switch body := body.(type) {
+	case nil:
+	case io.Reader:
+		payload = body
+	default:
+		var encoded bytes.Buffer
+		if err := json.NewEncoder(&encoded).Encode(body); err != nil {
+			t.Fatalf("error marshalling json %v", err)
+		}
+		payload = &encoded
+	}
+
+	request, err := http.NewRequest(method, path, payload)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	if _, ok := body.(io.Reader); body != nil && !ok {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
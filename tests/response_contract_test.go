@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/testharness"
+	"github.com/stretchr/testify/assert"
+)
+
+var productFields = []string{
+	"active", "created_at", "description", "id", "name", "price",
+	"reorder_point", "reorder_quantity", "stock", "updated_at",
+}
+
+var purchaseOrderFields = []string{
+	"approved_at", "created_at", "id", "lines", "received_at", "status", "supplier_id", "updated_at",
+}
+
+func decodeEnvelope(t *testing.T, body []byte) map[string]interface{} {
+	var envelope map[string]interface{}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	assert.Equal(t, "OK", envelope["status"])
+	return envelope
+}
+
+func objectFields(t *testing.T, value interface{}) []string {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a JSON object, got %T", value)
+	}
+
+	fields := make([]string, 0, len(object))
+	for field := range object {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestProductResponseContract(t *testing.T) {
+	contract := controllers.ProductCreateReq{
+		Name:            "Contract Widget",
+		Description:     "Product used to lock down response shapes",
+		Price:           19.99,
+		StockLevel:      30,
+		ReorderPoint:    5,
+		ReorderQuantity: 25,
+	}
+
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/products", contract, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	created := decodeEnvelope(t, recorder.Body.Bytes())
+	assert.Equal(t, productFields, objectFields(t, created["data"]))
+
+	data := created["data"].(map[string]interface{})
+	assert.Equal(t, contract.Price, data["price"])
+	assert.Equal(t, true, data["active"])
+	id := uint(data["id"].(float64))
+	assert.Equal(t, fmt.Sprintf("/api/v1/products/%d", id), recorder.Header().Get("Location"))
+
+	//single product is returned as an object, not a list
+	recorder = performRequest(t, router, http.MethodGet, recorder.Header().Get("Location"), nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	fetched := decodeEnvelope(t, recorder.Body.Bytes())
+	assert.Equal(t, productFields, objectFields(t, fetched["data"]))
+	assert.Equal(t, contract.Price, fetched["data"].(map[string]interface{})["price"])
+
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/products?limit=1", nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	list := decodeEnvelope(t, recorder.Body.Bytes())
+	assert.Equal(t, []string{"meta", "products"}, objectFields(t, list["data"]))
+
+	page := list["data"].(map[string]interface{})
+	assert.Equal(t, []string{"current_page", "limit", "total_products"}, objectFields(t, page["meta"]))
+	products := page["products"].([]interface{})
+	assert.Len(t, products, 1)
+	assert.Equal(t, productFields, objectFields(t, products[0]))
+
+	recorder = performRequest(t, router, http.MethodPut, fmt.Sprintf("/api/v1/products/%d", id), controllers.ProductUpdateReq{
+		Name:        ptr("Contract Widget v2"),
+		Description: ptr("Updated product used to lock down response shapes"),
+	}, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	updated := decodeEnvelope(t, recorder.Body.Bytes())
+	assert.Equal(t, productFields, objectFields(t, updated["data"]))
+	assert.Equal(t, "Contract Widget v2", updated["data"].(map[string]interface{})["name"])
+}
+
+func TestPurchaseOrderResponseContract(t *testing.T) {
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/suppliers", controllers.SupplierCreateReq{Name: "Contract Supplies"}, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	supplier := decodeEnvelope(t, recorder.Body.Bytes())
+	assert.Equal(t, []string{"created_at", "email", "id", "name", "phone"}, objectFields(t, supplier["data"]))
+	supplierId := uint(supplier["data"].(map[string]interface{})["id"].(float64))
+
+	productId := testharness.CreateProduct(t, db, "Contract Order Widget",
+		testharness.WithDescription("Product used to lock down purchase order shapes"),
+		testharness.WithPrice(4),
+		testharness.WithStock(1),
+	).ID
+
+	recorder = performRequest(t, router, http.MethodPost, "/api/v1/purchase-orders", controllers.PurchaseOrderCreateReq{
+		SupplierId: supplierId,
+		Lines:      []controllers.PurchaseOrderLineReq{{ProductId: productId, Quantity: 3, UnitCost: 2}},
+	}, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.NotEmpty(t, recorder.Header().Get("Location"))
+
+	order := decodeEnvelope(t, recorder.Body.Bytes())
+	assert.Equal(t, purchaseOrderFields, objectFields(t, order["data"]))
+	lines := order["data"].(map[string]interface{})["lines"].([]interface{})
+	assert.Equal(t, []string{"id", "outstanding", "product_id", "quantity", "received_quantity", "unit_cost"}, objectFields(t, lines[0]))
+
+	recorder = performRequest(t, router, http.MethodGet, recorder.Header().Get("Location"), nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, purchaseOrderFields, objectFields(t, decodeEnvelope(t, recorder.Body.Bytes())["data"]))
+}
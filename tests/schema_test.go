@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/AllanM007/simpler-test/migrations"
+	"github.com/AllanM007/simpler-test/testharness"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// TestMigrationsMatchModels checks that the migrations of the test database,
+// SQLite or Postgres, and the models describe the same tables and columns.
+func TestMigrationsMatchModels(t *testing.T) {
+	migrator := db.Migrator()
+
+	modelTables := map[string]bool{}
+	for _, model := range testharness.Models() {
+		statement := &gorm.Statement{DB: db}
+		if err := statement.Parse(model); err != nil {
+			t.Fatalf("error parsing %T: %v", model, err)
+		}
+		table := statement.Schema.Table
+		modelTables[table] = true
+
+		if !assert.True(t, migrator.HasTable(model), "table %s of %T is not created by the migrations", table, model) {
+			continue
+		}
+		columnTypes, err := migrator.ColumnTypes(model)
+		if err != nil {
+			t.Fatalf("error reading columns of %s: %v", table, err)
+		}
+		columns := map[string]bool{}
+		for _, column := range columnTypes {
+			columns[column.Name()] = true
+		}
+
+		for _, field := range statement.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			assert.True(t, columns[field.DBName], "column %s.%s of %T is not created by the migrations", table, field.DBName, model)
+			delete(columns, field.DBName)
+		}
+		for column := range columns {
+			assert.Fail(t, "migrated column has no model field", "column %s.%s is missing from %T", table, column, model)
+		}
+	}
+
+	tables, err := migrator.GetTables()
+	if err != nil {
+		t.Fatalf("error listing tables: %v", err)
+	}
+	for _, table := range tables {
+		//sqlite_sequence is SQLite's own table of AUTOINCREMENT counters
+		if table == (migrations.SchemaMigration{}).TableName() || table == "sqlite_sequence" {
+			continue
+		}
+		assert.True(t, modelTables[table], "migrated table %s has no model in testharness.Models", table)
+	}
+}
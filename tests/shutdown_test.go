@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/notifications"
+	"github.com/AllanM007/simpler-test/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("sold"))
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	srv := server.New(config.Default().Server, handler)
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Serve(ctx, srv, listener, 5*time.Second, func(ctx context.Context) error {
+			record("hook")
+			return nil
+		})
+	}()
+
+	responses := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/api/v1/products/1/sale")
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		record("response")
+		responses <- string(body)
+	}()
+
+	//shut down while the request is still being handled
+	<-started
+	stop()
+
+	assert.Equal(t, "sold", <-responses)
+	assert.NoError(t, <-stopped)
+	assert.Equal(t, []string{"response", "hook"}, events, "hooks run once requests have drained")
+
+	_, err = http.Get("http://" + listener.Addr().String() + "/ping")
+	assert.Error(t, err, "no new connections are accepted after shutdown")
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Serve(ctx, server.New(config.Default().Server, handler), listener, 100*time.Millisecond)
+	}()
+
+	go http.Get("http://" + listener.Addr().String() + "/")
+	<-started
+	stop()
+
+	select {
+	case err := <-stopped:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop at the shutdown deadline")
+	}
+}
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	alerts []notifications.LowStockAlert
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, alert notifications.LowStockAlert) error {
+	time.Sleep(10 * time.Millisecond)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func TestAsyncNotifierDrainsOnClose(t *testing.T) {
+	sink := &recordingNotifier{}
+	notifier := notifications.NewAsyncNotifier(sink, 2)
+
+	assert.NoError(t, notifier.Notify(context.Background(), lowStockAlert))
+	assert.NoError(t, notifier.Notify(context.Background(), lowStockAlert))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, notifier.Close(ctx))
+	assert.Len(t, sink.alerts, 2, "queued alerts are delivered before close returns")
+
+	assert.ErrorIs(t, notifier.Notify(context.Background(), lowStockAlert), notifications.ErrClosed)
+}
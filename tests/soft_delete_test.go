@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type PurgeResponse struct {
+	Status string                `json:"status"`
+	Data   controllers.PurgeData `json:"data"`
+}
+
+func TestSoftDeleteLifecycle(t *testing.T) {
+	recyclable := controllers.ProductCreateReq{
+		Name:        "Recyclable Widget",
+		Description: "Product used to test soft delete management",
+		Price:       3,
+		StockLevel:  10,
+	}
+
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/products", recyclable, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	var original models.Product
+	if err := db.Where("name = ?", recyclable.Name).First(&original).Error; err != nil {
+		t.Fatalf("error fetching product: %v", err)
+	}
+
+	recorder = performRequest(t, router, http.MethodDelete, fmt.Sprintf("/api/v1/products/%d", original.ID), nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	//the name is free again once the product is deleted
+	recorder = performRequest(t, router, http.MethodPost, "/api/v1/products", recyclable, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/products?include_deleted=true", nil, nil)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = performRequest(t, router, http.MethodGet, "/api/v1/products?include_deleted=true&limit=100", nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var products ProductsResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &products); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	deletedListed := false
+	for _, product := range products.Data.Products {
+		if product.Id == original.ID {
+			deletedListed = true
+			assert.NotNil(t, product.DeletedAt)
+		}
+	}
+	assert.True(t, deletedListed, "expected deleted product to be listed")
+
+	restoreUrl := fmt.Sprintf("/api/v1/products/%d/restore", original.ID)
+
+	recorder = performRequest(t, router, http.MethodPost, restoreUrl, nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	//restoring while an active product has the same name conflicts
+	recorder = performRequest(t, router, http.MethodPost, restoreUrl, nil, adminHeaders)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+
+	var replacement models.Product
+	if err := db.Where("name = ?", recyclable.Name).First(&replacement).Error; err != nil {
+		t.Fatalf("error fetching product: %v", err)
+	}
+	recorder = performRequest(t, router, http.MethodDelete, fmt.Sprintf("/api/v1/products/%d", replacement.ID), nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = performRequest(t, router, http.MethodPost, restoreUrl, nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = performRequest(t, router, http.MethodPost, restoreUrl, nil, adminHeaders)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	//purging respects the retention period
+	recorder = performRequest(t, router, http.MethodDelete, "/api/v1/admin/products/purge?older_than_days=1", nil, adminHeaders)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	if err := db.Unscoped().Model(&replacement).Update("deleted_at", time.Now().AddDate(0, 0, -45)).Error; err != nil {
+		t.Fatalf("error backdating deletion: %v", err)
+	}
+
+	recorder = performRequest(t, router, http.MethodDelete, "/api/v1/admin/products/purge", nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var purge PurgeResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &purge); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	assert.GreaterOrEqual(t, purge.Data.Purged, int64(1))
+
+	var remaining int64
+	db.Unscoped().Model(&models.Product{}).Where("id = ?", replacement.ID).Count(&remaining)
+	assert.Equal(t, int64(0), remaining)
+}
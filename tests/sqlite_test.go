@@ -0,0 +1,29 @@
+//go:build !integration
+
+package tests
+
+import (
+	"github.com/AllanM007/simpler-test/health"
+	"github.com/AllanM007/simpler-test/testharness"
+	"gorm.io/gorm"
+)
+
+// openTestDB opens an in-memory SQLite database, so that the tests need
+// neither Docker nor a configured database.
+func openTestDB() (*gorm.DB, func(), error) {
+	db, err := testharness.OpenSQLite("tests")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cleanup := func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+	return db, cleanup, nil
+}
+
+func schemaCheck(db *gorm.DB) health.Check {
+	return testharness.Schema(db)
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/health"
+	"github.com/AllanM007/simpler-test/routes"
+	"github.com/AllanM007/simpler-test/stream"
+	"github.com/AllanM007/simpler-test/testharness"
+	"github.com/stretchr/testify/assert"
+)
+
+type LowStockResponse struct {
+	Status string                                `json:"status"`
+	Data   controllers.LowStockPaginatedResponse `json:"data"`
+}
+
+// lowStockReport returns the products reported as low on stock by id.
+func lowStockReport(t *testing.T, handler http.Handler) map[uint]controllers.LowStockData {
+	recorder := performRequest(t, handler, http.MethodGet, "/api/v1/inventory/low-stock?limit=100", nil, nil)
+	if !assert.Equal(t, http.StatusOK, recorder.Code) {
+		return nil
+	}
+
+	var report LowStockResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	products := map[uint]controllers.LowStockData{}
+	for _, product := range report.Data.Products {
+		products[product.Id] = product
+	}
+	return products
+}
+
+func TestLowStockReport(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.AdminAPIKey = adminAPIKey
+	sink := &recordingNotifier{}
+	handler := routes.Router(db, cfg, sink, stream.NewBroker(cfg.Stream), health.NewRegistry(time.Second))
+
+	created := testharness.CreateProduct(t, db, "Reorder Widget",
+		testharness.WithDescription("Product used to test the low stock report"),
+		testharness.WithStock(12),
+		testharness.WithReorder(10, 40),
+	)
+	assert.NotContains(t, lowStockReport(t, handler), created.ID)
+
+	//sell enough units to cross the reorder point
+	recorder := performRequest(t, handler, http.MethodPut, fmt.Sprintf("/api/v1/products/%d/sale", created.ID), controllers.ProductSale{Id: int(created.ID), Count: 5}, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	sink.mu.Lock()
+	if assert.Len(t, sink.alerts, 1) {
+		assert.Equal(t, created.ID, sink.alerts[0].ProductID)
+		assert.Equal(t, 12, sink.alerts[0].PreviousStock)
+		assert.Equal(t, 7, sink.alerts[0].Stock)
+		assert.Equal(t, 40, sink.alerts[0].ReorderQuantity)
+	}
+	sink.mu.Unlock()
+
+	product, ok := lowStockReport(t, handler)[created.ID]
+	if assert.True(t, ok, "expected product to be reported as low stock") {
+		assert.Equal(t, 7, product.Stock)
+		assert.Equal(t, 10, product.ReorderPoint)
+	}
+
+	//inactive products are not reordered
+	recorder = performRequest(t, handler, http.MethodPut, fmt.Sprintf("/api/v1/products/%d/deactivate", created.ID), nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, lowStockReport(t, handler), created.ID)
+}
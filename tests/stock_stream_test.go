@@ -0,0 +1,272 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/events"
+	"github.com/AllanM007/simpler-test/health"
+	"github.com/AllanM007/simpler-test/notifications"
+	"github.com/AllanM007/simpler-test/routes"
+	"github.com/AllanM007/simpler-test/stream"
+	"github.com/stretchr/testify/assert"
+)
+
+// sseEvent is one server-sent event, or a comment when only Comment is set.
+type sseEvent struct {
+	ID      string
+	Event   string
+	Data    string
+	Comment string
+}
+
+type sseClient struct {
+	response *http.Response
+	events   chan sseEvent
+}
+
+// openStockStream connects to the stock stream of server and reads its events
+// in the background until the stream ends.
+func openStockStream(t *testing.T, server *httptest.Server, query string, lastEventId string) *sseClient {
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/stream/stock"+query, nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	if lastEventId != "" {
+		request.Header.Set("Last-Event-ID", lastEventId)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("error opening stream: %v", err)
+	}
+	client := &sseClient{response: response, events: make(chan sseEvent, 100)}
+	t.Cleanup(client.close)
+
+	go func() {
+		defer close(client.events)
+		var event sseEvent
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			field, value, _ := strings.Cut(scanner.Text(), ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "":
+				if value != "" {
+					event.Comment = value
+				}
+				if event != (sseEvent{}) {
+					client.events <- event
+				}
+				event = sseEvent{}
+			case "id":
+				event.ID = value
+			case "event":
+				event.Event = value
+			case "data":
+				event.Data = value
+			}
+		}
+	}()
+	return client
+}
+
+func (c *sseClient) close() {
+	c.response.Body.Close()
+}
+
+// next returns the next event that is not a comment.
+func (c *sseClient) next(t *testing.T) sseEvent {
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event, ok := <-c.events:
+			if !ok {
+				t.Fatal("stream ended")
+			}
+			if event.Event != "" {
+				return event
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for a stream event")
+		}
+	}
+}
+
+func stockUpdate(t *testing.T, event sseEvent) stream.StockUpdate {
+	var update stream.StockUpdate
+	if err := json.Unmarshal([]byte(event.Data), &update); err != nil {
+		t.Fatalf("error decoding stock update %q: %v", event.Data, err)
+	}
+	return update
+}
+
+// newStreamFollower returns a follower pushing the stock changes committed
+// from now on to the test router's stream.
+func newStreamFollower(t *testing.T) *events.Follower {
+	follower := events.NewFollower(db, config.Default().Events, stockStream)
+	followEvents(t, follower)
+	return follower
+}
+
+func followEvents(t *testing.T, follower *events.Follower) {
+	if _, err := follower.Follow(context.Background()); err != nil {
+		t.Fatalf("error following events: %v", err)
+	}
+}
+
+func TestStockStream(t *testing.T) {
+	follower := newStreamFollower(t)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	watched := createEventProduct(t, "Streamed Widget", 10)
+	ignored := createEventProduct(t, "Unstreamed Widget", 10)
+
+	client := openStockStream(t, server, fmt.Sprintf("?product_ids=%d", watched.ID), "")
+	assert.Equal(t, http.StatusOK, client.response.StatusCode)
+	assert.Equal(t, "text/event-stream", client.response.Header.Get("Content-Type"))
+	everything := openStockStream(t, server, "", "")
+
+	assert.Equal(t, http.StatusOK, sellProduct(t, ignored, 1).Code)
+	assert.Equal(t, http.StatusOK, sellProduct(t, watched, 3).Code)
+	followEvents(t, follower)
+
+	//clients only get the products they selected
+	event := client.next(t)
+	assert.Equal(t, "stock", event.Event)
+	assert.NotEmpty(t, event.ID)
+	update := stockUpdate(t, event)
+	assert.Equal(t, watched.ID, update.ProductID)
+	assert.Equal(t, 10, update.PreviousStock)
+	assert.Equal(t, 7, update.Stock)
+	assert.Equal(t, events.ReasonSale, update.Reason)
+	assert.NotZero(t, update.EventID)
+
+	assert.Equal(t, ignored.ID, stockUpdate(t, everything.next(t)).ProductID)
+	assert.Equal(t, watched.ID, stockUpdate(t, everything.next(t)).ProductID)
+
+	//resuming replays the changes missed while disconnected
+	client.close()
+	assert.Equal(t, http.StatusOK, sellProduct(t, watched, 1).Code)
+	assert.Equal(t, http.StatusOK, sellProduct(t, ignored, 1).Code)
+	assert.Equal(t, http.StatusOK, sellProduct(t, watched, 2).Code)
+	followEvents(t, follower)
+
+	resumed := openStockStream(t, server, fmt.Sprintf("?product_ids=%d", watched.ID), event.ID)
+	assert.Equal(t, 6, stockUpdate(t, resumed.next(t)).Stock)
+	assert.Equal(t, 4, stockUpdate(t, resumed.next(t)).Stock)
+
+	//an unknown id cannot be resumed from
+	reset := openStockStream(t, server, "", "unknown-1")
+	assert.Equal(t, "reset", reset.next(t).Event)
+
+	recorder := performRequest(t, router, http.MethodGet, "/api/v1/stream/stock?product_ids=1,abc", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestStockStreamWhilePublisherFails(t *testing.T) {
+	relay, publisher := newTestRelay(t)
+	follower := newStreamFollower(t)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	product := createEventProduct(t, "Unpublished Stream Widget", 10)
+	client := openStockStream(t, server, fmt.Sprintf("?product_ids=%d", product.ID), "")
+
+	//stock changes are streamed once committed, even though the publisher rejects them
+	publisher.failing[product.ID] = true
+	assert.Equal(t, http.StatusOK, sellProduct(t, product, 2).Code)
+	published, err := relay.PublishPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, published)
+	followEvents(t, follower)
+
+	update := stockUpdate(t, client.next(t))
+	assert.Equal(t, product.ID, update.ProductID)
+	assert.Equal(t, 8, update.Stock)
+}
+
+func TestStockStreamHeartbeatAndDisconnect(t *testing.T) {
+	cfg := config.Default()
+	cfg.Stream.HeartbeatInterval = 10 * time.Millisecond
+	broker := stream.NewBroker(cfg.Stream)
+	server := httptest.NewServer(routes.Router(db, cfg, notifications.NewLogNotifier(), broker, health.NewRegistry(time.Second)))
+	t.Cleanup(server.Close)
+
+	client := openStockStream(t, server, "", "")
+	select {
+	case event := <-client.events:
+		assert.Equal(t, "heartbeat", event.Comment)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a heartbeat")
+	}
+	assert.Equal(t, 1, broker.Subscribers())
+
+	//disconnected clients are unsubscribed
+	client.close()
+	assert.Eventually(t, func() bool {
+		return broker.Subscribers() == 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	//closing the broker ends open streams and refuses new ones
+	client = openStockStream(t, server, "", "")
+	broker.Close()
+	assert.Eventually(t, func() bool {
+		_, open := <-client.events
+		return !open
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, broker.Subscribers())
+	assert.Equal(t, http.StatusServiceUnavailable, openStockStream(t, server, "", "").response.StatusCode)
+}
+
+func TestStockStreamBuffer(t *testing.T) {
+	broker := stream.NewBroker(config.Stream{BufferSize: 2, HeartbeatInterval: time.Second})
+	publish := func(id uint, stock int) {
+		payload, _ := json.Marshal(events.StockChange{ProductID: 1, Stock: stock, Reason: events.ReasonSale})
+		broker.Published(events.Event{ID: id, Type: events.StockChanged, AggregateID: 1, Payload: payload})
+	}
+
+	subscriber, _, _ := broker.Subscribe(nil, "")
+	publish(1, 3)
+	first := <-subscriber.Messages
+	publish(2, 2)
+	publish(3, 1)
+	second := <-subscriber.Messages
+
+	//other events are not streamed
+	broker.Published(events.Event{ID: 4, Type: events.ProductUpdated, AggregateID: 1})
+	publish(5, 0)
+
+	_, missed, complete := broker.Subscribe(nil, second.ID)
+	assert.True(t, complete)
+	if assert.Len(t, missed, 2) {
+		assert.Contains(t, string(missed[0].Data), `"event_id":3`)
+		assert.Contains(t, string(missed[1].Data), `"event_id":5`)
+	}
+
+	//the message after the first one is no longer buffered
+	_, missed, complete = broker.Subscribe(nil, first.ID)
+	assert.False(t, complete)
+	assert.Empty(t, missed)
+
+	//a subscriber that falls too far behind is dropped
+	for i := 0; i < 100; i++ {
+		publish(uint(10+i), i)
+	}
+	assert.Equal(t, 0, broker.Subscribers())
+	received := 0
+	for range subscriber.Messages {
+		received++
+	}
+	assert.Less(t, received, 100)
+	broker.Unsubscribe(subscriber)
+}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/audit"
+	"github.com/AllanM007/simpler-test/migrations"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/testharness"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarnessSchema(t *testing.T) {
+	sqlite, err := testharness.OpenSQLite(t.Name())
+	if err != nil {
+		t.Fatalf("error opening sqlite database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := sqlite.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	check := testharness.Schema(sqlite)
+	assert.NoError(t, check(context.Background()))
+
+	migrator, err := migrations.New(sqlite)
+	if err != nil {
+		t.Fatalf("error loading migrations: %v", err)
+	}
+	_, err = migrator.Down(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Error(t, check(context.Background()))
+}
+
+func TestHarnessCreateProduct(t *testing.T) {
+	product := testharness.CreateProduct(t, db, "Factory Widget",
+		testharness.WithPrice(12.5),
+		testharness.WithStock(4),
+		testharness.WithReorder(2, 8),
+	)
+	assert.NotZero(t, product.ID)
+	assert.Equal(t, 12.5, product.Price)
+	assert.Equal(t, 4, product.StockLevel)
+	assert.Equal(t, 2, product.ReorderPoint)
+	assert.Equal(t, 8, product.ReorderQuantity)
+	assert.True(t, product.Active)
+
+	//factory products are audited like products created through the API
+	var entries int64
+	db.Model(&models.AuditLog{}).Where("entity_type = ? AND entity_id = ? AND action = ?", audit.EntityProduct, product.ID, audit.ActionCreate).Count(&entries)
+	assert.Equal(t, int64(1), entries)
+}
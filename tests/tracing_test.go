@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AllanM007/simpler-test/middleware"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const incomingTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+// recordSpans installs a tracer provider recording every span for the
+// duration of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	return spans
+}
+
+func tracedRequest(t *testing.T, method, url string) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	request.Header.Set("traceparent", "00-"+incomingTraceID+"-00f067aa0ba902b7-01")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestTracingSpans(t *testing.T) {
+	spans := recordSpans(t)
+
+	recorder := tracedRequest(t, http.MethodGet, "/api/v1/products")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, incomingTraceID, recorder.Header().Get(middleware.TraceIDHeader))
+
+	var server sdktrace.ReadOnlySpan
+	var queries []sdktrace.ReadOnlySpan
+	for _, span := range spans.Ended() {
+		switch {
+		case span.SpanKind() == trace.SpanKindServer:
+			server = span
+		case span.Name() == "gorm.query":
+			queries = append(queries, span)
+		}
+	}
+
+	if assert.NotNil(t, server, "a server span is recorded") {
+		assert.Equal(t, "GET /api/v1/products", server.Name())
+		assert.Equal(t, incomingTraceID, server.SpanContext().TraceID().String(), "the incoming trace is continued")
+	}
+
+	//the count and the page are separate queries under the request span
+	assert.Len(t, queries, 2)
+	for _, query := range queries {
+		assert.Equal(t, server.SpanContext().SpanID(), query.Parent().SpanID())
+		assert.Equal(t, trace.SpanKindClient, query.SpanKind())
+	}
+}
+
+func TestTraceIDInErrorResponses(t *testing.T) {
+	recordSpans(t)
+
+	recorder := tracedRequest(t, http.MethodGet, "/api/v1/products/999999")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	assert.Equal(t, "NOT_FOUND", body["status"])
+	assert.Equal(t, incomingTraceID, body["trace_id"])
+
+	//successful responses are left untouched
+	recorder = tracedRequest(t, http.MethodGet, "/api/v1/products")
+	assert.NotContains(t, recorder.Body.String(), "trace_id")
+}
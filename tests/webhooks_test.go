@@ -0,0 +1,385 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/controllers"
+	"github.com/AllanM007/simpler-test/events"
+	"github.com/AllanM007/simpler-test/models"
+	"github.com/AllanM007/simpler-test/webhooks"
+	"github.com/stretchr/testify/assert"
+)
+
+type WebhookCreatedResponse struct {
+	Status string                         `json:"status"`
+	Data   controllers.WebhookCreatedData `json:"data"`
+}
+
+type WebhookDeliveriesResponse struct {
+	Status string                                         `json:"status"`
+	Data   controllers.WebhookDeliveriesPaginatedResponse `json:"data"`
+}
+
+// webhookReceiver is a partner endpoint checking signatures with secret and
+// answering with status. during, when set, runs as each request arrives.
+type webhookReceiver struct {
+	*httptest.Server
+	during func(r *http.Request)
+
+	mu       sync.Mutex
+	secret   string
+	status   int
+	received []events.Event
+	errors   []error
+}
+
+func newWebhookReceiver(t *testing.T) *webhookReceiver {
+	receiver := &webhookReceiver{status: http.StatusOK}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if receiver.during != nil {
+			receiver.during(r)
+		}
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+
+		body, _ := io.ReadAll(r.Body)
+		if err := webhooks.Verify(receiver.secret, r.Header.Get(webhooks.SignatureHeader), r.Header.Get(webhooks.TimestampHeader), body, time.Minute); err != nil {
+			receiver.errors = append(receiver.errors, err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var event events.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			receiver.errors = append(receiver.errors, err)
+		}
+		if event.Type != r.Header.Get(webhooks.EventHeader) {
+			receiver.errors = append(receiver.errors, fmt.Errorf("event header %q does not match %q", r.Header.Get(webhooks.EventHeader), event.Type))
+		}
+		receiver.received = append(receiver.received, event)
+		w.WriteHeader(receiver.status)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (r *webhookReceiver) respondWith(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *webhookReceiver) events() ([]events.Event, []error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]events.Event(nil), r.received...), append([]error(nil), r.errors...)
+}
+
+// subscribeWebhook subscribes the receiver and removes the subscription when
+// the test ends.
+func subscribeWebhook(t *testing.T, receiver *webhookReceiver, eventTypes ...string) controllers.WebhookCreatedData {
+	recorder := performRequest(t, router, http.MethodPost, "/api/v1/webhooks", controllers.WebhookCreateReq{
+		URL:        receiver.URL,
+		EventTypes: eventTypes,
+	}, adminHeaders)
+	if !assert.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String()) {
+		t.FailNow()
+	}
+
+	var response WebhookCreatedResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	receiver.mu.Lock()
+	receiver.secret = response.Data.Secret
+	receiver.mu.Unlock()
+
+	t.Cleanup(func() {
+		performRequest(t, router, http.MethodDelete, fmt.Sprintf("/api/v1/webhooks/%d", response.Data.Id), nil, adminHeaders)
+	})
+	return response.Data
+}
+
+func webhookDeliveries(t *testing.T, webhookId uint) []controllers.WebhookDeliveryData {
+	recorder := performRequest(t, router, http.MethodGet, fmt.Sprintf("/api/v1/webhooks/%d/deliveries?limit=100", webhookId), nil, adminHeaders)
+	if !assert.Equal(t, http.StatusOK, recorder.Code) {
+		return nil
+	}
+
+	var response WebhookDeliveriesResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	return response.Data.Deliveries
+}
+
+// newWebhookPipeline returns a relay queueing webhook deliveries and a
+// dispatcher sending them, retrying after a millisecond.
+func newWebhookPipeline(t *testing.T, maxAttempts int) (*events.Relay, *webhooks.Dispatcher) {
+	newTestRelay(t)
+
+	cfg := config.Default()
+	cfg.Webhooks.MaxAttempts = maxAttempts
+	cfg.Webhooks.RetryBackoff = time.Millisecond
+	return events.NewRelay(db, events.NewLogPublisher(), cfg.Events, webhooks.Queue{}), webhooks.NewDispatcher(db, cfg.Webhooks)
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	relay, dispatcher := newWebhookPipeline(t, 3)
+	receiver := newWebhookReceiver(t)
+	subscription := subscribeWebhook(t, receiver, events.ProductCreated, events.SaleCompleted)
+	assert.Len(t, subscription.Secret, 64, "a secret is generated when none is given")
+
+	product := createEventProduct(t, "Webhook Widget", 8)
+	assert.Equal(t, http.StatusOK, sellProduct(t, product, 2).Code)
+
+	if _, err := relay.PublishPending(context.Background()); err != nil {
+		t.Fatalf("error publishing events: %v", err)
+	}
+	//queueing an event again does not deliver it twice
+	var outbox []models.OutboxEvent
+	db.Where("aggregate_id = ?", product.ID).Find(&outbox)
+	for _, row := range outbox {
+		assert.NoError(t, webhooks.Queue{}.Queue(db, events.Event{ID: row.ID, Type: row.EventType, Payload: json.RawMessage(row.Payload)}))
+	}
+
+	sent, err := dispatcher.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sent)
+
+	received, errs := receiver.events()
+	assert.Empty(t, errs)
+	if assert.Len(t, received, 2) {
+		assert.Equal(t, events.ProductCreated, received[0].Type)
+		assert.Equal(t, events.SaleCompleted, received[1].Type)
+		assert.Equal(t, product.ID, received[1].AggregateID)
+	}
+
+	deliveries := webhookDeliveries(t, subscription.Id)
+	if assert.Len(t, deliveries, 2) {
+		assert.Equal(t, models.WebhookDeliverySucceeded, deliveries[0].Status)
+		assert.NotNil(t, deliveries[0].DeliveredAt)
+		assert.Nil(t, deliveries[0].NextAttemptAt)
+		if assert.Len(t, deliveries[0].AttemptLog, 1) {
+			assert.Equal(t, http.StatusOK, deliveries[0].AttemptLog[0].StatusCode)
+		}
+	}
+
+	sent, err = dispatcher.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent, "succeeded deliveries are not sent again")
+}
+
+func TestWebhookDeliveriesClaimedWhileSent(t *testing.T) {
+	relay, dispatcher := newWebhookPipeline(t, 3)
+	other := webhooks.NewDispatcher(db, config.Default().Webhooks)
+	receiver := newWebhookReceiver(t)
+
+	//another dispatcher checking while the delivery is being sent leaves it alone
+	var concurrent []int
+	receiver.during = func(r *http.Request) {
+		sent, err := other.DeliverPending(context.Background())
+		assert.NoError(t, err)
+		concurrent = append(concurrent, sent)
+	}
+	subscription := subscribeWebhook(t, receiver, events.ProductCreated)
+
+	createEventProduct(t, "Claimed Webhook Widget", 8)
+	if _, err := relay.PublishPending(context.Background()); err != nil {
+		t.Fatalf("error publishing events: %v", err)
+	}
+
+	sent, err := dispatcher.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []int{0}, concurrent)
+
+	received, _ := receiver.events()
+	assert.Len(t, received, 1)
+	deliveries := webhookDeliveries(t, subscription.Id)
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, models.WebhookDeliverySucceeded, deliveries[0].Status)
+		assert.Len(t, deliveries[0].AttemptLog, 1)
+	}
+}
+
+func TestWebhookDeliveryCancelled(t *testing.T) {
+	relay, dispatcher := newWebhookPipeline(t, 3)
+	receiver := newWebhookReceiver(t)
+
+	//the dispatcher is closed while the receiver is still answering
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	receiver.during = func(r *http.Request) {
+		cancel()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}
+	subscription := subscribeWebhook(t, receiver, events.ProductCreated)
+
+	createEventProduct(t, "Cancelled Webhook Widget", 8)
+	if _, err := relay.PublishPending(context.Background()); err != nil {
+		t.Fatalf("error publishing events: %v", err)
+	}
+
+	sent, err := dispatcher.DeliverPending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	//the abandoned attempt is not counted and the delivery is due again
+	var delivery models.WebhookDelivery
+	if err := db.Where("subscription_id = ?", subscription.Id).First(&delivery).Error; err != nil {
+		t.Fatalf("error fetching delivery: %v", err)
+	}
+	assert.Equal(t, models.WebhookDeliveryPending, delivery.Status)
+	assert.Equal(t, 0, delivery.Attempts)
+	assert.False(t, delivery.NextAttemptAt.After(time.Now()))
+
+	receiver.during = nil
+	sent, err = dispatcher.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+}
+
+func TestWebhookRetriesAndRedelivery(t *testing.T) {
+	relay, dispatcher := newWebhookPipeline(t, 2)
+	receiver := newWebhookReceiver(t)
+	receiver.respondWith(http.StatusServiceUnavailable)
+	subscription := subscribeWebhook(t, receiver, events.ProductCreated)
+
+	createEventProduct(t, "Unlucky Webhook Widget", 8)
+	if _, err := relay.PublishPending(context.Background()); err != nil {
+		t.Fatalf("error publishing events: %v", err)
+	}
+
+	sent, err := dispatcher.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	deliveries := webhookDeliveries(t, subscription.Id)
+	if !assert.Len(t, deliveries, 1) {
+		return
+	}
+	assert.Equal(t, models.WebhookDeliveryPending, deliveries[0].Status)
+	assert.Equal(t, "webhook responded with status 503", deliveries[0].LastError)
+	assert.NotNil(t, deliveries[0].NextAttemptAt)
+
+	//the second failure exhausts the attempts and dead-letters the delivery
+	time.Sleep(5 * time.Millisecond)
+	sent, err = dispatcher.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	deliveries = webhookDeliveries(t, subscription.Id)
+	assert.Equal(t, models.WebhookDeliveryDead, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	if assert.Len(t, deliveries[0].AttemptLog, 2) {
+		assert.Equal(t, http.StatusServiceUnavailable, deliveries[0].AttemptLog[1].StatusCode)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	sent, err = dispatcher.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent, "dead deliveries are not retried")
+
+	//a manual redelivery gets a fresh set of attempts and keeps the log
+	receiver.respondWith(http.StatusNoContent)
+	recorder := performRequest(t, router, http.MethodPost, fmt.Sprintf("/api/v1/webhooks/%d/deliveries/%d/redeliver", subscription.Id, deliveries[0].Id), nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	sent, err = dispatcher.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	deliveries = webhookDeliveries(t, subscription.Id)
+	assert.Equal(t, models.WebhookDeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.NotNil(t, deliveries[0].DeliveredAt)
+	assert.Len(t, deliveries[0].AttemptLog, 3)
+
+	//redelivering a delivered event starts it over
+	recorder = performRequest(t, router, http.MethodPost, fmt.Sprintf("/api/v1/webhooks/%d/deliveries/%d/redeliver", subscription.Id, deliveries[0].Id), nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	deliveries = webhookDeliveries(t, subscription.Id)
+	assert.Equal(t, models.WebhookDeliveryPending, deliveries[0].Status)
+	assert.Equal(t, 0, deliveries[0].Attempts)
+	assert.Nil(t, deliveries[0].DeliveredAt)
+	assert.Empty(t, deliveries[0].LastError)
+
+	sent, err = dispatcher.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	recorder = performRequest(t, router, http.MethodPost, fmt.Sprintf("/api/v1/webhooks/%d/deliveries/%d/redeliver", subscription.Id+1000, deliveries[0].Id), nil, adminHeaders)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestWebhookSubscriptions(t *testing.T) {
+	recorder := performRequest(t, router, http.MethodGet, "/api/v1/webhooks", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	for _, invalid := range []controllers.WebhookCreateReq{
+		{URL: "ftp://partner.example.com/hook", EventTypes: []string{events.ProductCreated}},
+		{URL: "/relative", EventTypes: []string{events.ProductCreated}},
+		{URL: "https://partner.example.com/hook", EventTypes: []string{"product.exploded"}},
+		{URL: "https://partner.example.com/hook"},
+	} {
+		recorder = performRequest(t, router, http.MethodPost, "/api/v1/webhooks", invalid, adminHeaders)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, invalid)
+	}
+
+	recorder = performRequest(t, router, http.MethodPost, "/api/v1/webhooks", controllers.WebhookCreateReq{
+		URL:        "https://partner.example.com/hook",
+		EventTypes: []string{events.StockChanged},
+		Secret:     "partner-chosen-secret",
+	}, adminHeaders)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	var created WebhookCreatedResponse
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	assert.Equal(t, "partner-chosen-secret", created.Data.Secret)
+	webhookUrl := fmt.Sprintf("/api/v1/webhooks/%d", created.Data.Id)
+
+	paused := false
+	recorder = performRequest(t, router, http.MethodPut, webhookUrl, controllers.WebhookUpdateReq{
+		URL:        "https://partner.example.com/v2/hook",
+		EventTypes: []string{events.StockChanged, events.ProductDeleted},
+		Active:     &paused,
+	}, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = performRequest(t, router, http.MethodGet, webhookUrl, nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"url":"https://partner.example.com/v2/hook"`)
+	assert.Contains(t, recorder.Body.String(), `"active":false`)
+	assert.NotContains(t, recorder.Body.String(), "partner-chosen-secret", "the secret is only shown on creation")
+
+	recorder = performRequest(t, router, http.MethodDelete, webhookUrl, nil, adminHeaders)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = performRequest(t, router, http.MethodGet, webhookUrl, nil, adminHeaders)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	now := time.Now()
+	timestamp := fmt.Sprint(now.Unix())
+	signature := webhooks.Sign("secret", now, body)
+
+	assert.NoError(t, webhooks.Verify("secret", signature, timestamp, body, time.Minute))
+	assert.ErrorIs(t, webhooks.Verify("other", signature, timestamp, body, time.Minute), webhooks.ErrInvalidSignature)
+	assert.ErrorIs(t, webhooks.Verify("secret", signature, timestamp, []byte(`{"id":2}`), time.Minute), webhooks.ErrInvalidSignature)
+
+	old := now.Add(-time.Hour)
+	assert.ErrorIs(t, webhooks.Verify("secret", webhooks.Sign("secret", old, body), fmt.Sprint(old.Unix()), body, time.Minute), webhooks.ErrStaleTimestamp)
+}
@@ -0,0 +1,280 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AllanM007/simpler-test/config"
+	"github.com/AllanM007/simpler-test/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Dispatcher sends the webhook deliveries that are due. A failed delivery is
+// retried with exponential backoff until it succeeds or runs out of attempts,
+// when it is dead-lettered and only sent again if redelivered by hand.
+type Dispatcher struct {
+	DB           *gorm.DB
+	Client       *http.Client
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	MaxBackoff   time.Duration
+	BatchSize    int
+	PollInterval time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func NewDispatcher(db *gorm.DB, cfg config.Webhooks) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		DB:           db,
+		Client:       &http.Client{Timeout: cfg.Timeout},
+		MaxAttempts:  cfg.MaxAttempts,
+		RetryBackoff: cfg.RetryBackoff,
+		MaxBackoff:   cfg.MaxBackoff,
+		BatchSize:    cfg.BatchSize,
+		PollInterval: cfg.PollInterval,
+		ctx:          ctx,
+		cancel:       cancel,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// Start sends due deliveries in the background every PollInterval until Close
+// is called.
+func (d *Dispatcher) Start() {
+	go d.run()
+}
+
+// Close stops the dispatcher and waits for the batch being sent to finish or
+// for ctx to end, whichever comes first. When ctx ends first the requests in
+// flight are cancelled, and the deliveries not sent are left due for the next
+// run.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.once.Do(func() {
+		close(d.stop)
+	})
+	defer d.cancel()
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		//keep going while full batches are due, then wait for the next check
+		for {
+			sent, err := d.DeliverPending(d.ctx)
+			if err != nil {
+				slog.Error("failed to send webhook deliveries", "error", err)
+			}
+			if err != nil || sent < d.BatchSize {
+				break
+			}
+			select {
+			case <-d.stop:
+				return
+			default:
+			}
+		}
+
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverPending attempts up to BatchSize due deliveries of active
+// subscriptions and returns how many were attempted, successfully or not.
+// The deliveries are claimed first, so other dispatchers skip them while they
+// are being sent, and each attempt is then recorded on its own. No transaction
+// is held open while the receivers are called.
+func (d *Dispatcher) DeliverPending(ctx context.Context) (int, error) {
+	due, err := d.claim(ctx)
+	if err != nil || len(due) == 0 {
+		return 0, err
+	}
+
+	subscriptions := map[uint]models.WebhookSubscription{}
+	ids := make([]uint, 0, len(due))
+	for _, delivery := range due {
+		ids = append(ids, delivery.SubscriptionID)
+	}
+	var found []models.WebhookSubscription
+	if err := d.DB.WithContext(ctx).Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return 0, err
+	}
+	for _, subscription := range found {
+		subscriptions[subscription.ID] = subscription
+	}
+
+	//record attempts even when ctx ends, the receiver has already been called
+	db := d.DB.WithContext(context.WithoutCancel(ctx))
+	attempted := 0
+	var released []uint
+	for i := range due {
+		if ctx.Err() != nil {
+			released = append(released, due[i].ID)
+			continue
+		}
+		subscription, ok := subscriptions[due[i].SubscriptionID]
+		if !ok {
+			//the subscription was deleted since, and its deliveries with it
+			continue
+		}
+		if err := d.attempt(ctx, db, &due[i], subscription); err != nil {
+			if errors.Is(err, errCancelled) {
+				released = append(released, due[i].ID)
+				continue
+			}
+			return attempted, err
+		}
+		attempted++
+	}
+
+	//deliveries left unsent by shutdown are due again straight away
+	if len(released) > 0 {
+		if err := db.Model(&models.WebhookDelivery{}).Where("id IN ?", released).Update("next_attempt_at", time.Now()).Error; err != nil {
+			return attempted, err
+		}
+	}
+	return attempted, nil
+}
+
+// claim takes up to BatchSize due deliveries of active subscriptions, skipping
+// those locked by another dispatcher, and pushes their next attempt back for as
+// long as sending all of them may take, so no other dispatcher sends them in
+// the meantime.
+func (d *Dispatcher) claim(ctx context.Context) ([]models.WebhookDelivery, error) {
+	var due []models.WebhookDelivery
+	err := d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+			Where("subscription_id IN (?)", tx.Model(&models.WebhookSubscription{}).Select("id").Where("active = ?", true)).
+			Order("id ASC").
+			Limit(d.BatchSize).
+			Find(&due).Error
+		if err != nil || len(due) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(due))
+		for i, delivery := range due {
+			ids[i] = delivery.ID
+		}
+		lease := now.Add(time.Duration(len(due)+1) * d.Client.Timeout)
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", lease).Error
+	})
+	return due, err
+}
+
+// errCancelled reports an attempt abandoned because the dispatcher is closing.
+var errCancelled = errors.New("webhook delivery cancelled")
+
+// attempt posts the delivery once, then records the attempt and schedules the
+// next one if it failed, in a transaction of its own.
+func (d *Dispatcher) attempt(ctx context.Context, db *gorm.DB, delivery *models.WebhookDelivery, subscription models.WebhookSubscription) error {
+	started := time.Now()
+	statusCode, err := d.post(ctx, delivery, subscription)
+	if err != nil && ctx.Err() != nil {
+		return errCancelled
+	}
+
+	attempt := models.WebhookAttempt{
+		DeliveryID: delivery.ID,
+		StatusCode: statusCode,
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	delivery.Attempts++
+	switch {
+	case err == nil:
+		now := time.Now()
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	case delivery.Attempts >= d.MaxAttempts:
+		attempt.Error = err.Error()
+		delivery.Status = models.WebhookDeliveryDead
+		delivery.LastError = err.Error()
+		slog.WarnContext(ctx, "webhook delivery dead-lettered", "delivery_id", delivery.ID, "url", subscription.URL, "attempts", delivery.Attempts, "error", err)
+	default:
+		attempt.Error = err.Error()
+		delivery.NextAttemptAt = time.Now().Add(d.backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Save(delivery).Error
+	})
+}
+
+// post sends the signed delivery and returns the response status, treating
+// any non-2xx response as a failure.
+func (d *Dispatcher) post(ctx context.Context, delivery *models.WebhookDelivery, subscription models.WebhookSubscription) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	//drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff is the wait after the given number of failed attempts: RetryBackoff
+// doubled after every failure, capped at MaxBackoff.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.RetryBackoff
+	for i := 1; i < attempts && wait < d.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.MaxBackoff {
+		wait = d.MaxBackoff
+	}
+	return wait
+}
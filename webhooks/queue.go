@@ -0,0 +1,50 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/AllanM007/simpler-test/events"
+	"github.com/AllanM007/simpler-test/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Queue is an events.Queue creating a delivery of each published event for
+// every active subscription to its type. The deliveries are sent by a
+// Dispatcher.
+type Queue struct{}
+
+func (Queue) Queue(tx *gorm.DB, event events.Event) error {
+	var subscriptions []models.WebhookSubscription
+	if err := tx.Where("active = ?", true).Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	var deliveries []models.WebhookDelivery
+	for _, subscription := range subscriptions {
+		if subscription.Subscribes(event.Type) {
+			deliveries = append(deliveries, models.WebhookDelivery{
+				SubscriptionID: subscription.ID,
+				EventID:        event.ID,
+				EventType:      event.Type,
+				Status:         models.WebhookDeliveryPending,
+				NextAttemptAt:  time.Now(),
+			})
+		}
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for i := range deliveries {
+		deliveries[i].Payload = string(payload)
+	}
+
+	//an event is never delivered twice to the same subscription
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(&deliveries).Error
+}